@@ -0,0 +1,269 @@
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/CyrusJavan/tf-bench/internal/proxy"
+	"github.com/CyrusJavan/tf-bench/internal/util"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// topActions is how many of the most frequent API calls of a resource type are reported.
+const topActions = 3
+
+// APIReport attributes the API calls recorded by the API proxy to the
+// resource types whose refresh they were made during.
+type APIReport struct {
+	Calls        int              // Calls is the number of API calls recorded
+	Unattributed int              // Unattributed calls were made outside any refresh, such as provider configuration
+	Failed       int              // Failed calls got no response or an error status
+	Injected     int              // Injected errors, which are included in Failed
+	Types        []*APITypeReport // Types sorted by the number of calls
+}
+
+// APITypeReport is the API calls made during the refreshes of a resource type.
+// Calls made while several resources were refreshing are split between them.
+type APITypeReport struct {
+	Name        string
+	Refreshes   int           // Refreshes of instances of the type over all iterations
+	Calls       float64       // Calls attributed to the refreshes
+	RefreshTime time.Duration // RefreshTime is the sum of the refresh times
+	NetworkTime time.Duration // NetworkTime is the part of the refresh times spent waiting for API calls
+	Actions     []*APIAction  // Actions sorted by the number of calls
+}
+
+// APIAction is the number of calls of one API action or path.
+type APIAction struct {
+	Name  string
+	Calls float64
+}
+
+// ProviderTime is the part of the refresh times not spent waiting for API calls.
+func (r *APITypeReport) ProviderTime() time.Duration {
+	if r.NetworkTime > r.RefreshTime {
+		return 0
+	}
+	return r.RefreshTime - r.NetworkTime
+}
+
+// perRefresh divides d over the refreshes of the type.
+func (r *APITypeReport) perRefresh(d time.Duration) time.Duration {
+	if r.Refreshes == 0 {
+		return 0
+	}
+	return d / time.Duration(r.Refreshes)
+}
+
+// apiProxy records the API calls of a benchmark.
+type apiProxy struct {
+	*proxy.Proxy
+	dir string
+}
+
+// startAPIProxy starts the API proxy for the terraform child processes.
+func startAPIProxy(cfg *Config) (*apiProxy, error) {
+	dir, err := util.MkdirTemp("tf-bench-proxy.")
+	if err != nil {
+		return nil, fmt.Errorf("could not create API proxy dir: %w", err)
+	}
+	p, err := proxy.Start(dir, proxy.Options{
+		InsecureUpstream: cfg.APIProxyInsecure,
+		Faults:           cfg.Faults,
+		ExemptHosts:      append(append([]string{}, proxy.RegistryHosts...), backendHosts(".")...),
+		Seed:             cfg.Seed,
+	})
+	if err != nil {
+		util.RemoveTempDir(dir)
+		return nil, fmt.Errorf("could not start API proxy: %w", err)
+	}
+	return &apiProxy{Proxy: p, dir: dir}, nil
+}
+
+func (p *apiProxy) Close() {
+	_ = p.Proxy.Close()
+	util.RemoveTempDir(p.dir)
+}
+
+// backendState is the part of .terraform/terraform.tfstate, written by
+// terraform init, with the configuration of the state backend.
+type backendState struct {
+	Backend *struct {
+		Type   string                 `json:"type"`
+		Config map[string]interface{} `json:"config"`
+	} `json:"backend"`
+}
+
+// backendHosts returns globs of the hosts the state backend of the workspace
+// in dir is reached at, so faults injected into every host spare it. It is
+// empty for local state, and for backends whose host is shared with the APIs
+// of providers.
+func backendHosts(dir string) []string {
+	b, err := os.ReadFile(filepath.Join(dir, ".terraform", "terraform.tfstate"))
+	if err != nil {
+		return nil
+	}
+	var state backendState
+	if json.Unmarshal(b, &state) != nil || state.Backend == nil {
+		return nil
+	}
+	config := func(key string) string {
+		s, _ := state.Backend.Config[key].(string)
+		return s
+	}
+	urlHosts := func(keys ...string) []string {
+		var hosts []string
+		for _, key := range keys {
+			if u, err := url.Parse(config(key)); err == nil && u.Hostname() != "" {
+				hosts = append(hosts, u.Hostname())
+			}
+		}
+		return hosts
+	}
+	switch state.Backend.Type {
+	case "remote", "cloud":
+		if hostname := config("hostname"); hostname != "" {
+			return []string{hostname}
+		}
+		return []string{"app.terraform.io"}
+	case "http":
+		return urlHosts("address", "lock_address", "unlock_address")
+	case "consul":
+		if address := config("address"); address != "" {
+			return []string{strings.Split(address, ":")[0]}
+		}
+		return []string{"localhost", "127.0.0.1"}
+	case "s3":
+		if endpoint := urlHosts("endpoint"); len(endpoint) > 0 {
+			return endpoint
+		}
+		// Virtual hosted-style addresses of the bucket, the regional S3
+		// hosts also serve the S3 calls of the AWS provider.
+		if bucket := config("bucket"); bucket != "" {
+			return []string{bucket + ".s3.amazonaws.com", bucket + ".s3.*.amazonaws.com", bucket + ".s3-*.amazonaws.com"}
+		}
+	case "gcs":
+		return []string{"storage.googleapis.com"}
+	case "azurerm":
+		if account := config("storage_account_name"); account != "" {
+			return []string{account + ".blob.core.windows.net"}
+		}
+	}
+	return nil
+}
+
+// attributeAPICalls assigns every recorded call to the refreshes that were
+// running when it started, splitting it evenly when several were.
+func attributeAPICalls(samples []refreshSample, records []proxy.Record) *APIReport {
+	sorted := append([]refreshSample{}, samples...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Start.Before(sorted[j].Start)
+	})
+	report := &APIReport{Calls: len(records)}
+	types := map[string]*APITypeReport{}
+	actions := map[string]map[string]float64{}
+	typeReport := func(s refreshSample) *APITypeReport {
+		name := s.name()
+		tr, ok := types[name]
+		if !ok {
+			tr = &APITypeReport{Name: name}
+			types[name] = tr
+			actions[name] = map[string]float64{}
+		}
+		return tr
+	}
+	for _, s := range sorted {
+		tr := typeReport(s)
+		tr.Refreshes++
+		tr.RefreshTime += s.Duration
+	}
+	for _, rec := range records {
+		if rec.Status == 0 || rec.Status >= 400 {
+			report.Failed++
+		}
+		if rec.Injected {
+			report.Injected++
+		}
+		// Only refreshes that started before the call can contain it.
+		n := sort.Search(len(sorted), func(i int) bool {
+			return sorted[i].Start.After(rec.Start)
+		})
+		var running []refreshSample
+		for _, s := range sorted[:n] {
+			if !s.Start.Add(s.Duration).Before(rec.Start) {
+				running = append(running, s)
+			}
+		}
+		if len(running) == 0 {
+			report.Unattributed++
+			continue
+		}
+		share := 1 / float64(len(running))
+		for _, s := range running {
+			tr := typeReport(s)
+			tr.Calls += share
+			tr.NetworkTime += time.Duration(share * float64(rec.Duration))
+			actions[tr.Name][rec.Name()] += share
+		}
+	}
+	for name, tr := range types {
+		for action, calls := range actions[name] {
+			tr.Actions = append(tr.Actions, &APIAction{Name: action, Calls: calls})
+		}
+		sort.Slice(tr.Actions, func(i, j int) bool {
+			if tr.Actions[i].Calls != tr.Actions[j].Calls {
+				return tr.Actions[i].Calls > tr.Actions[j].Calls
+			}
+			return tr.Actions[i].Name < tr.Actions[j].Name
+		})
+		report.Types = append(report.Types, tr)
+	}
+	sort.Slice(report.Types, func(i, j int) bool {
+		if report.Types[i].Calls != report.Types[j].Calls {
+			return report.Types[i].Calls > report.Types[j].Calls
+		}
+		return report.Types[i].Name < report.Types[j].Name
+	})
+	return report
+}
+
+func (r *APIReport) String() string {
+	if r.Calls == 0 {
+		return "API calls: none were recorded, the providers may not send their calls through HTTP_PROXY/HTTPS_PROXY\n"
+	}
+	t := table.NewWriter()
+	t.Style().Format.Header = text.FormatDefault
+	t.AppendHeader(table.Row{"Resource Type", "Refreshes", "API Calls", "Calls Per Refresh",
+		"Network Time Per Refresh", "Provider Time Per Refresh", "Most Frequent Calls"})
+	for _, tr := range r.Types {
+		var perRefresh float64
+		if tr.Refreshes > 0 {
+			perRefresh = tr.Calls / float64(tr.Refreshes)
+		}
+		var top []string
+		for i, a := range tr.Actions {
+			if i == topActions {
+				break
+			}
+			top = append(top, fmt.Sprintf("%s (%.1f)", a.Name, a.Calls/float64(tr.Refreshes)))
+		}
+		t.AppendRow(table.Row{tr.Name, tr.Refreshes, fmt.Sprintf("%.1f", tr.Calls), fmt.Sprintf("%.1f", perRefresh),
+			tr.perRefresh(tr.NetworkTime).Round(time.Millisecond), tr.perRefresh(tr.ProviderTime()).Round(time.Millisecond),
+			strings.Join(top, ", ")})
+	}
+	var injected string
+	if r.Injected > 0 {
+		injected = fmt.Sprintf(" (%d injected)", r.Injected)
+	}
+	return fmt.Sprintf(`API calls: %d recorded, %d outside any refresh, %d failed%s
+Calls made while several resources were refreshing are split between them.
+%s
+`, r.Calls, r.Unattributed, r.Failed, injected, t.Render())
+}
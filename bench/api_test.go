@@ -0,0 +1,78 @@
+package bench
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CyrusJavan/tf-bench/internal/proxy"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttributeAPICalls(t *testing.T) {
+	t0 := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time {
+		return t0.Add(time.Duration(ms) * time.Millisecond)
+	}
+	samples := []refreshSample{
+		{Addr: "aviatrix_vpc.a", Type: "aviatrix_vpc", Start: at(0), Duration: 1000 * time.Millisecond},
+		{Addr: "aviatrix_vpc.b", Type: "aviatrix_vpc", Start: at(500), Duration: 1000 * time.Millisecond},
+		{Addr: "data.aviatrix_account.acc", Type: "aviatrix_account", Mode: "data", Start: at(2000), Duration: 500 * time.Millisecond},
+	}
+	records := []proxy.Record{
+		{Start: at(100), Duration: 200 * time.Millisecond, Action: "get_vpc", Status: 200},
+		// Both vpcs are refreshing, the call is split between them.
+		{Start: at(600), Duration: 200 * time.Millisecond, Action: "list_vpcs", Status: 200},
+		{Start: at(1200), Duration: 100 * time.Millisecond, Action: "get_vpc", Status: 500},
+		{Start: at(2100), Duration: 300 * time.Millisecond, Method: "GET", Path: "/v1/accounts", Status: 200},
+		{Start: at(3000), Duration: 100 * time.Millisecond, Action: "login"},
+	}
+	report := attributeAPICalls(samples, records)
+	require.Equal(t, 5, report.Calls)
+	require.Equal(t, 1, report.Unattributed)
+	require.Equal(t, 2, report.Failed)
+	require.Len(t, report.Types, 2)
+
+	vpc := report.Types[0]
+	require.Equal(t, "aviatrix_vpc", vpc.Name)
+	require.Equal(t, 2, vpc.Refreshes)
+	require.InDelta(t, 3, vpc.Calls, 1e-9)
+	require.Equal(t, 2*time.Second, vpc.RefreshTime)
+	require.Equal(t, 500*time.Millisecond, vpc.NetworkTime)
+	require.Equal(t, 1500*time.Millisecond, vpc.ProviderTime())
+	require.Equal(t, "get_vpc", vpc.Actions[0].Name)
+	require.InDelta(t, 2, vpc.Actions[0].Calls, 1e-9)
+
+	account := report.Types[1]
+	require.Equal(t, "data.aviatrix_account", account.Name)
+	require.InDelta(t, 1, account.Calls, 1e-9)
+	require.Equal(t, "GET /v1/accounts", account.Actions[0].Name)
+	require.Contains(t, report.String(), "5 recorded, 1 outside any refresh, 2 failed")
+
+	require.Contains(t, attributeAPICalls(samples, nil).String(), "none were recorded")
+}
+
+func TestBackendHosts(t *testing.T) {
+	dir := t.TempDir()
+	require.Empty(t, backendHosts(dir))
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, ".terraform"), 0700))
+	for _, tc := range []struct {
+		state string
+		hosts []string
+	}{
+		{`{"backend": {"type": "remote", "config": {"organization": "acme"}}}`, []string{"app.terraform.io"}},
+		{`{"backend": {"type": "cloud", "config": {"hostname": "tfe.example.com"}}}`, []string{"tfe.example.com"}},
+		{`{"backend": {"type": "http", "config": {"address": "https://state.example.com/tf", "lock_address": "https://lock.example.com:8443/tf"}}}`,
+			[]string{"state.example.com", "lock.example.com"}},
+		{`{"backend": {"type": "s3", "config": {"bucket": "tfstate", "region": "us-east-1"}}}`,
+			[]string{"tfstate.s3.amazonaws.com", "tfstate.s3.*.amazonaws.com", "tfstate.s3-*.amazonaws.com"}},
+		{`{"backend": {"type": "s3", "config": {"bucket": "tfstate", "endpoint": "https://minio.example.com:9000"}}}`, []string{"minio.example.com"}},
+		{`{"backend": {"type": "local", "config": {"path": "terraform.tfstate"}}}`, nil},
+		{`{"version": 3}`, nil},
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, ".terraform", "terraform.tfstate"), []byte(tc.state), 0600))
+		require.Equal(t, tc.hosts, backendHosts(dir), tc.state)
+	}
+}
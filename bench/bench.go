@@ -1,33 +1,25 @@
 package bench
 
 import (
-	"bufio"
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"regexp"
 	"sort"
 	"strings"
 	"time"
 
 	"github.com/AviatrixSystems/terraform-provider-aviatrix/v2/goaviatrix"
+	"github.com/CyrusJavan/tf-bench/internal/proxy"
 	"github.com/CyrusJavan/tf-bench/internal/util"
-	"github.com/hashicorp/go-version"
-	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclwrite"
 	"github.com/itchyny/gojq"
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/jedib0t/go-pretty/v6/text"
 	"github.com/schollz/progressbar/v3"
 	log "github.com/sirupsen/logrus"
-	"github.com/zclconf/go-cty/cty"
 	"go.uber.org/zap"
-	"gonum.org/v1/gonum/stat"
 )
 
 const (
@@ -35,61 +27,204 @@ const (
 	defaultParallelism = 10
 )
 
-var (
-	tf15 = version.Must(version.NewVersion("v0.15"))
-)
-
-type TerraformRunner struct {
-	execPath string
+type Config struct {
+	SkipControllerVersion bool
+	Iterations            int
+	VarFile               string
+	Method                Method         // Method selects how refresh time is measured
+	SecretsSafe           bool           // SecretsSafe keeps variable values out of generated configurations
+	GroupBy               GroupBy        // GroupBy selects how event log measurements are aggregated
+	Groups                []*CustomGroup // Groups are reported in addition to the GroupBy aggregation
+	DataSources           bool           // DataSources includes data source reads in event log measurements
+	Sample                int            // Sample is the number of instances of every resource type to measure, 0 to measure all
+	SampleFraction        float64        // SampleFraction is the fraction of instances of every resource type to measure
+	Seed                  int64          // Seed of the random sample
+	APIProxy              bool           // APIProxy records the API calls of providers through a local proxy
+	APIProxyInsecure      bool           // APIProxyInsecure skips verifying the certificates of the APIs behind the proxy
+	Faults                []*proxy.Fault // Faults are injected into API calls through the proxy, which runs whenever Faults is not nil
+	TraceLog              bool           // TraceLog breaks refresh times down from the TF_LOG=trace output of terraform
+	MaxLoad               float64        // MaxLoad is the load average per CPU above which the host is busy, 0 for no threshold
+	MaxSteal              float64        // MaxSteal is the CPU steal percentage above which the host is busy, 0 for no threshold
+	AbortOnNoise          bool           // AbortOnNoise aborts the measurement when the host is busy instead of warning
 }
 
-func (tr *TerraformRunner) Run(arg ...string) ([]byte, error) {
-	return util.RunCommand(tr.execPath, arg...)
+type Resource struct {
+	Name            string
+	Count           int
+	Module          string          // Module is the module call path when only the resources in that module are measured
+	ModuleInstances []string        // ModuleInstances are the module instance paths of the resources, empty for the root module
+	Providers       []*ProviderAddr // Providers are the provider configurations of these resources
+	Addrs           []string        // Addrs are the addresses of the resource blocks in state
 }
 
-func (tr *TerraformRunner) RunAsync(arg ...string) (io.Reader, func() error, error) {
-	c := exec.Command(tr.execPath, arg...)
-	pipe, err := c.StdoutPipe()
-	if err != nil {
-		return nil, nil, fmt.Errorf("could not get StdoutPipe of command: %w", err)
-	}
-	err = c.Start()
-	if err != nil {
-		return nil, nil, fmt.Errorf("could not start command: %w", err)
+// usesProvider reports whether any of the resources belong to a root module
+// configuration of the provider with the given local name and source.
+func (r *Resource) usesProvider(localName, source string) bool {
+	for _, p := range r.Providers {
+		if p.Module == "" && p.matches(localName, source) {
+			return true
+		}
 	}
-	return pipe, c.Wait, nil
+	return false
 }
 
-var SystemTerraform = &TerraformRunner{execPath: "terraform"}
-
-type Config struct {
-	SkipControllerVersion bool
-	Iterations            int
-	VarFile               string
-	EventLog              bool
+// usesProviderAnywhere is like usesProvider for configurations in any module.
+func (r *Resource) usesProviderAnywhere(localName, source string) bool {
+	for _, p := range r.Providers {
+		if p.matches(localName, source) {
+			return true
+		}
+	}
+	return false
 }
 
-type Resource struct {
-	Name  string
-	Count int
+// usesProviderConfig reports whether any of the resources belong to the
+// configuration with the given alias of the provider in module.
+func (r *Resource) usesProviderConfig(module, localName, source, alias string) bool {
+	for _, p := range r.Providers {
+		if p.Module == module && p.Alias == alias && p.matches(localName, source) {
+			return true
+		}
+	}
+	return false
 }
 
 type ResourceReport struct {
 	Name      string        // Name of the resource
+	Module    string        // Module is the module call path of the resources for per-module results, empty for the root module
+	Provider  string        // Provider is the provider source of the resources when grouped by provider
 	Count     int           // Count is the number of these resources in the workspace
 	TotalTime time.Duration // TotalTime is the time for refreshing just these resources
 	Max       time.Duration
 	Min       time.Duration
 	StdDev    time.Duration
-	MaxID     string // MaxID is the ID of the resources with Max refresh time.
-	MinID     string // MinID is the ID of the resource with Min refresh time.
+	MaxID     string          // MaxID is the ID of the resources with Max refresh time.
+	MinID     string          // MinID is the ID of the resource with Min refresh time.
+	Sampled   int             // Sampled is the number of resources measured when only a sample of them was
+	StdErr    time.Duration   // StdErr is the sampling error of TotalTime
+	CPUTime   time.Duration   // CPUTime is the average user and system CPU time of terraform and its providers, for methods that measure a whole resource type
+	MaxRSS    int64           // MaxRSS is the peak memory in bytes of terraform or a provider, for methods that measure a whole resource type
+	Quantiles []time.Duration // Quantiles of the refresh time at reportQuantiles, of refreshing a resource for per-instance methods and of refreshing all of them for the others
+	// Observations is the number of refresh times the quantiles are of, and
+	// ObservedTime their sum.
+	Observations int
+	ObservedTime time.Duration
 }
 
 type TerraformState struct {
-	Resources []struct {
-		Type      string
-		Mode      string
-		Instances []struct{}
+	Resources []*StateResource
+}
+
+// StateResource is a resource or data source block recorded in state.
+type StateResource struct {
+	Module    string // Module path of the resource, empty for the root module
+	Type      string
+	Name      string
+	Mode      string
+	Provider  string // Provider is the address of the provider configuration
+	Instances []StateInstance
+}
+
+// StateInstance is an instance of a resource recorded in state.
+type StateInstance struct {
+	IndexKey interface{} `json:"index_key"` // IndexKey is the count index or for_each key, nil for a single instance
+}
+
+// InstanceAddr returns the address of the instance of r with the given index
+// key, for example aviatrix_vpc.a[0] or aviatrix_vpc.b["east"].
+func (r *StateResource) InstanceAddr(key interface{}) string {
+	switch k := key.(type) {
+	case float64:
+		return fmt.Sprintf("%s[%d]", r.Addr(), int64(k))
+	case string:
+		return fmt.Sprintf("%s[%q]", r.Addr(), k)
+	}
+	return r.Addr()
+}
+
+// Addr returns the address of the resource block, for example
+// module.network[0].data.aviatrix_account.acc.
+func (r *StateResource) Addr() string {
+	addr := r.Type + "." + r.Name
+	if r.Mode == "data" {
+		addr = "data." + addr
+	}
+	if r.Module != "" {
+		addr = r.Module + "." + addr
+	}
+	return addr
+}
+
+// ProviderAddr parses the provider configuration address of the resource.
+// State that does not record one is assumed to use the default configuration
+// of the provider named by the resource type prefix.
+func (r *StateResource) ProviderAddr() *ProviderAddr {
+	if r.Provider != "" {
+		if p, err := parseProviderAddr(r.Provider); err == nil {
+			return p
+		}
+	}
+	return &ProviderAddr{Type: strings.Split(r.Type, "_")[0]}
+}
+
+// resourcesByType groups the resources of the given mode in state by type.
+func (s *TerraformState) resourcesByType(mode string) map[string]*Resource {
+	resources := map[string]*Resource{}
+	for _, r := range s.Resources {
+		if mode != "" && r.Mode != mode {
+			continue
+		}
+		resource, ok := resources[r.Type]
+		if !ok {
+			resource = &Resource{Name: r.Type}
+			resources[r.Type] = resource
+		}
+		resource.add(r)
+	}
+	return resources
+}
+
+// resourcesByModule groups the resources of the given mode and type in state by module call path.
+func (s *TerraformState) resourcesByModule(mode, resourceType string) map[string]*Resource {
+	resources := map[string]*Resource{}
+	for _, r := range s.Resources {
+		if r.Type != resourceType || (mode != "" && r.Mode != mode) {
+			continue
+		}
+		module := moduleCallPath(r.Module)
+		resource, ok := resources[module]
+		if !ok {
+			resource = &Resource{Name: r.Type, Module: module}
+			resources[module] = resource
+		}
+		resource.add(r)
+	}
+	return resources
+}
+
+// add counts the instances of sr and records its address, module instance and provider.
+func (r *Resource) add(sr *StateResource) {
+	r.Count += len(sr.Instances)
+	r.Addrs = append(r.Addrs, sr.Addr())
+	known := false
+	for _, m := range r.ModuleInstances {
+		if m == sr.Module {
+			known = true
+		}
+	}
+	if !known && sr.Module != "" {
+		r.ModuleInstances = append(r.ModuleInstances, sr.Module)
+		sort.Strings(r.ModuleInstances)
+	}
+	p := sr.ProviderAddr()
+	known = false
+	for _, existing := range r.Providers {
+		if *existing == *p {
+			known = true
+		}
+	}
+	if !known {
+		r.Providers = append(r.Providers, p)
 	}
 }
 
@@ -126,37 +261,78 @@ type RefreshReport struct {
 	TerraformVersion  *TerraformVersion           // TerraformVersion that is running the benchmark
 	ControllerVersion *goaviatrix.AviatrixVersion // ControllerVersion of the Aviatrix controller
 	Resources         []*ResourceReport           // Resources is the slice of individual resource measurements
+	ModuleResources   []*ResourceReport           // ModuleResources are the measurements per module of workspaces with child modules
+	Groups            []*ResourceReport           // Groups are the measurements of the custom groups in Config
+	Sampling          *SamplingReport             // Sampling describes the sample when only a sample of the resources was measured
+	API               *APIReport                  // API is the API calls recorded by the API proxy
+	Trace             *TraceReport                // Trace is the breakdown of refresh times from the trace log
+	Usage             *UsageReport                // Usage is the CPU time and memory of refreshing the whole workspace
+	Host              *HostReport                 // Host is the machine the benchmark ran on and how busy it was
+	Fingerprint       *Fingerprint                // Fingerprint identifies the shape of the workspace, nil when it could not be computed
 	Config            *Config                     // Config that this report was generated with
 	BuildVersion      string                      // BuildVersion of tf-bench
+	events            *runEvents                  // events of the event-log method, to export the benchmark as a trace
+}
+
+// moduleName returns a module call path for display.
+func moduleName(module string) string {
+	if module == "" {
+		return "root module"
+	}
+	return module
 }
 
 func (r *RefreshReport) String() string {
 	t := table.NewWriter()
 	t2 := table.NewWriter()
-	if r.Config.EventLog {
+	if r.Config.Method.perInstance() {
 		t.Style().Format.Header = text.FormatDefault
 		t2.Style().Format.Header = text.FormatDefault
-		t.AppendHeader(table.Row{"Resource Type", "Count", "Average Time Per Resource", "Average*Count", "Minimum", "Maximum", "StdDev"})
-		t2.AppendHeader(table.Row{"Resource Type", "Fastest", "Slowest"})
+		groupBy := r.Config.GroupBy
+		header := append(groupBy.header(), "Count", "Average Time Per Resource", "Average*Count", "Minimum", "Maximum", "StdDev")
+		if r.Sampling != nil {
+			header = append(header, "Sampled", "Std Error of Average")
+		}
+		t.AppendHeader(header)
+		t2.AppendHeader(append(groupBy.header(), "Fastest", "Slowest"))
 		for _, rr := range r.Resources {
 			calc := int64(rr.TotalTime) * int64(rr.Count)
-			t.AppendRow(table.Row{rr.Name, rr.Count, rr.TotalTime.Round(time.Millisecond), time.Duration(calc).Round(time.Millisecond),
-				rr.Min.Round(time.Millisecond), rr.Max.Round(time.Millisecond), rr.StdDev.Round(time.Millisecond)})
-			t2.AppendRow(table.Row{rr.Name, rr.MinID, rr.MaxID})
+			row := append(groupBy.row(rr), rr.Count, rr.TotalTime.Round(time.Millisecond), time.Duration(calc).Round(time.Millisecond),
+				rr.Min.Round(time.Millisecond), rr.Max.Round(time.Millisecond), rr.StdDev.Round(time.Millisecond))
+			if r.Sampling != nil {
+				row = append(row, rr.Sampled, rr.StdErr.Round(time.Millisecond))
+			}
+			t.AppendRow(row)
+			t2.AppendRow(append(groupBy.row(rr), rr.MinID, rr.MaxID))
 		}
 	} else {
-		t.AppendHeader(table.Row{"Resource Type", "Count", fmt.Sprintf("Average Refresh Time of %d Measurements", r.Config.Iterations)})
+		header := table.Row{"Resource Type", "Count", fmt.Sprintf("Average Refresh Time of %d Measurements", r.Config.Iterations)}
+		if r.Usage != nil {
+			header = append(header, "Average CPU Time", "Peak Memory")
+		}
+		t.AppendHeader(header)
 		for _, rr := range r.Resources {
-			t.AppendRow(table.Row{rr.Name, rr.Count, rr.TotalTime.Round(time.Millisecond)})
+			row := table.Row{rr.Name, rr.Count, rr.TotalTime.Round(time.Millisecond)}
+			if r.Usage != nil {
+				row = append(row, rr.CPUTime.Round(time.Millisecond), util.FormatBytes(rr.MaxRSS))
+			}
+			t.AppendRow(row)
+		}
+		if len(r.ModuleResources) > 0 {
+			t2.AppendHeader(table.Row{"Resource Type", "Module", "Count", fmt.Sprintf("Average Refresh Time of %d Measurements", r.Config.Iterations)})
+			for _, rr := range r.ModuleResources {
+				t2.AppendRow(table.Row{rr.Name, moduleName(rr.Module), rr.Count, rr.TotalTime.Round(time.Millisecond)})
+			}
 		}
 	}
 
 	reportTemplate := `tf-bench (%s) Refresh Report %s%s
-iterations per measurement: %d%s%s
-Refresh Time for Whole Workspace: %s
+iterations per measurement: %d
+measurement method: %s%s%s%s%s
+Refresh Time for %s: %s
 %s
 %s
-`
+%s`
 	providerVersions := ""
 	if r.TerraformVersion != nil {
 		providerVersions = "\nprovider versions:\n"
@@ -171,14 +347,57 @@ Refresh Time for Whole Workspace: %s
 	}
 	var terraformVer string
 	if r.TerraformVersion != nil {
-		terraformVer = "\nterraform version: v" + r.TerraformVersion.TerraformVersion
+		terraformVer = "\n" + r.TerraformVersion.String()
+	}
+	if r.Host != nil {
+		terraformVer += "\n" + r.Host.String()
+	}
+	if r.Fingerprint != nil {
+		terraformVer += "\n" + r.Fingerprint.String()
+	}
+	var groupedBy string
+	if r.Config.Method.perInstance() && r.Config.GroupBy.orDefault() != GroupByType {
+		groupedBy = fmt.Sprintf("\ngrouped by: %s", r.Config.GroupBy)
+	}
+	var sampled string
+	measured := "Whole Workspace"
+	if r.Sampling != nil {
+		sampled = fmt.Sprintf(`
+sampled: %d of %d resources with seed %d
+Counts are of the whole workspace. Averages are estimates from the sample, with their standard error.
+Estimated Sum of Refresh Times of All Resources: %s ± %s`, r.Sampling.Sampled, r.Sampling.Population, r.Sampling.Seed,
+			r.Sampling.Total.Round(time.Millisecond), r.Sampling.TotalStdErr.Round(time.Millisecond))
+		measured = "Sampled Resources"
 	}
 	if r.BuildVersion == "" {
 		r.BuildVersion = "development-build"
 	}
+	totalTime := r.TotalTime.Round(time.Millisecond).String()
+	var groups string
+	if r.Usage != nil {
+		totalTime += r.Usage.summary()
+		groups = r.Usage.String()
+	}
+	if r.API != nil {
+		groups += r.API.String()
+	}
+	if r.Trace != nil {
+		groups += r.Trace.String()
+	}
+	if len(r.Groups) > 0 {
+		t3 := table.NewWriter()
+		t3.Style().Format.Header = text.FormatDefault
+		t3.AppendHeader(table.Row{"Group", "Count", "Average Time Per Resource", "Average*Count", "Minimum", "Maximum", "StdDev", "Fastest", "Slowest"})
+		for _, rr := range r.Groups {
+			calc := int64(rr.TotalTime) * int64(rr.Count)
+			t3.AppendRow(table.Row{rr.Name, rr.Count, rr.TotalTime.Round(time.Millisecond), time.Duration(calc).Round(time.Millisecond),
+				rr.Min.Round(time.Millisecond), rr.Max.Round(time.Millisecond), rr.StdDev.Round(time.Millisecond), rr.MinID, rr.MaxID})
+		}
+		groups = "Custom Groups:\n" + t3.Render() + "\n" + groups
+	}
 	report := fmt.Sprintf(reportTemplate, r.BuildVersion, r.Timestamp.Format(time.RFC3339Nano),
-		controllerVer, r.Config.Iterations, terraformVer, providerVersions,
-		r.TotalTime.Round(time.Millisecond), t.Render(), t2.Render())
+		controllerVer, r.Config.Iterations, r.Config.Method.orDefault(), groupedBy, sampled, terraformVer, providerVersions,
+		measured, totalTime, t.Render(), t2.Render(), groups)
 	return report
 }
 
@@ -210,72 +429,150 @@ func RefreshBenchmark(cfg *Config, tfRunner *TerraformRunner, logger *zap.Logger
 			return nil, fmt.Errorf("could not initialize logger: %w", err)
 		}
 	}
-	if cfg.EventLog {
-		return eventLogRefreshBenchmark(cfg, tfRunner, logger)
+	strategy, err := newMeasurementStrategy(cfg.Method)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.validateSampling(strategy.Method()); err != nil {
+		return nil, err
 	}
-	return tempDirRefreshBenchmark(cfg, tfRunner)
-}
-
-func tempDirRefreshBenchmark(cfg *Config, tfRunner *TerraformRunner) (*RefreshReport, error) {
+	if !strategy.Method().perInstance() {
+		if cfg.GroupBy.orDefault() != GroupByType {
+			return nil, fmt.Errorf("grouping by %s requires the event log measurement method", cfg.GroupBy)
+		}
+		if len(cfg.Groups) > 0 {
+			return nil, fmt.Errorf("custom groups require the event log measurement method")
+		}
+	}
+	if cfg.APIProxy && strategy.Method() != MethodEventLog {
+		return nil, fmt.Errorf("the API proxy requires the event log measurement method to attribute calls to resources")
+	}
+	if cfg.TraceLog && strategy.Method() != MethodEventLog {
+		return nil, fmt.Errorf("the trace log requires the event log measurement method to attribute gRPC calls to resources")
+	}
+	logger.Debug("Getting terraform state")
 	tfstate, state, err := terraformState(tfRunner)
+	if err != nil {
+		return nil, fmt.Errorf("could not get terraform state: %w", err)
+	}
+	report := newReport(cfg, tfRunner)
+	report.Fingerprint, err = workspaceFingerprint(cfg.VarFile, tfstate, report.TerraformVersion)
+	if err != nil {
+		fmt.Printf("WARN: Could not compute workspace fingerprint: %v\n", err)
+	}
+	w := &workspace{
+		cfg:       cfg,
+		tfRunner:  tfRunner,
+		logger:    logger,
+		tfVersion: report.TerraformVersion,
+		tfstate:   tfstate,
+		state:     state,
+		host:      newHostMonitor(cfg),
+	}
+	if cfg.sampling() {
+		w.sample = sampleInstances(tfstate, cfg.DataSources, cfg.Sample, cfg.SampleFraction, cfg.Seed)
+		fmt.Printf("Measuring a sample of %d resources/data_sources with seed %d.\n", len(w.sample.addrs), cfg.Seed)
+	}
+	var apiProxy *apiProxy
+	if cfg.APIProxy || cfg.Faults != nil {
+		apiProxy, err = startAPIProxy(cfg)
+		if err != nil {
+			return nil, err
+		}
+		defer apiProxy.Close()
+		w.tfRunner = tfRunner.WithEnv(apiProxy.Env()...)
+	}
+	var traceFile string
+	if cfg.TraceLog {
+		dir, err := util.MkdirTemp("tf-bench-trace.")
+		if err != nil {
+			return nil, fmt.Errorf("could not create trace log dir: %w", err)
+		}
+		defer util.RemoveTempDir(dir)
+		traceFile = filepath.Join(dir, "terraform.log")
+		w.tfRunner = w.tfRunner.WithEnv("TF_LOG=trace", "TF_LOG_PATH="+traceFile)
+	}
+	logger.Debug("Begin measurement", zap.String("method", string(strategy.Method())))
+	if err := w.host.begin(); err != nil {
+		return nil, err
+	}
+	m, err := strategy.measure(w)
 	if err != nil {
 		return nil, err
 	}
-
-	// Move the resources types into a map to deduplicate and count.
-	resourceTypes := map[string]int{}
-	for _, r := range tfstate.Resources {
-		resourceTypes[r.Type] += len(r.Instances)
+	if cfg.APIProxy {
+		report.API = attributeAPICalls(m.samples, apiProxy.Records())
+	}
+	report.TotalTime = averageDuration(m.workspace)
+	report.Usage = newUsageReport(m.usage)
+	report.Host = w.host.hostReport()
+	if strategy.Method().perInstance() {
+		report.Resources = groupSamples(m.samples, cfg.GroupBy, tfstate.providersByType(), cfg.Iterations)
+		report.Groups = customGroupSamples(m.samples, cfg.Groups, cfg.Iterations)
+		if w.sample != nil {
+			report.Sampling = w.sample.estimate(report.Resources, m.samples)
+		}
+		report.events = &runEvents{end: time.Now(), providers: tfstate.providersByType(), iterations: m.events}
+		if cfg.TraceLog {
+			report.Trace, err = readTraceReport(traceFile, m.samples, report.Resources)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		report.Resources, report.ModuleResources = typeSampleReports(m.samples)
+		fmt.Println("Finished benchmark.")
 	}
+	return report, nil
+}
+
+// tempDirStrategy measures every resource type in a temporary directory with
+// a generated configuration and a copy of state with just those resources.
+type tempDirStrategy struct{}
+
+func (tempDirStrategy) Method() Method {
+	return MethodTempDir
+}
 
+func (tempDirStrategy) measure(w *workspace) (*measurement, error) {
 	var totalCount int
-	for _, v := range resourceTypes {
-		totalCount += v
+	for _, v := range w.tfstate.resourcesByType("") {
+		totalCount += v.Count
 	}
 	fmt.Printf("Found %d resources/data_sources in the state file.\n", totalCount)
 
-	report := newReport(cfg, tfRunner)
 	// Run refresh of the entire workspace to get the TotalTime
 	fmt.Print("All resources measurement:  ")
-	t, err := measureRefresh(".", defaultParallelism, cfg.Iterations, cfg.VarFile, tfRunner)
+	ds, usage, err := measureRefresh(".", w.cfg.Iterations, w.tfRunner, w.host, refreshArgs(w.cfg.VarFile)...)
 	if err != nil {
 		return nil, fmt.Errorf("could not measure refresh for workspace: %w", err)
 	}
 	fmt.Println()
-	report.TotalTime = t
+	m := &measurement{workspace: ds, usage: usage}
 
-	// RefreshBenchmark each resource type individually
-	for r, count := range resourceTypes {
-		fmt.Printf("%s measurement:  ", r)
-		rr, err := resourceBenchmark(cfg, &Resource{Name: r, Count: count}, state, report.TerraformVersion, tfRunner)
-		if err != nil {
-			fmt.Printf("During the individual resource benchmark for resourceType=%s the following error occured: %v", r, err)
-			continue
-		}
-		rr.Count = count
-		report.Resources = append(report.Resources, rr)
-		fmt.Println("average: " + rr.TotalTime.Round(time.Millisecond).String())
+	// Data sources are refreshed along with the resources of each type.
+	err = m.measureTypes(w.tfstate, "", func(resource *Resource) ([]time.Duration, []*util.Usage, error) {
+		return resourceBenchmark(w.cfg, resource, w.state, w.tfVersion, w.tfRunner, w.host)
+	})
+	if err != nil {
+		return nil, err
 	}
+	return m, nil
+}
 
-	// Reverse sort the reports by TotalTime
-	sort.Slice(report.Resources, func(i, j int) bool {
-		return report.Resources[i].TotalTime > report.Resources[j].TotalTime
-	})
+// eventLogStrategy measures every resource instance from the timestamps in
+// the JSON event log of a refresh-only plan of the whole workspace.
+type eventLogStrategy struct{}
 
-	fmt.Println("Finished benchmark.")
-	return report, nil
+func (eventLogStrategy) Method() Method {
+	return MethodEventLog
 }
 
-func eventLogRefreshBenchmark(cfg *Config, tfRunner *TerraformRunner, logger *zap.Logger) (*RefreshReport, error) {
-	logger.Debug("Begin eventLogRefreshBenchmark")
-	logger.Debug("Getting terraform state")
-	tfstate, _, err := terraformState(tfRunner)
-	if err != nil {
-		return nil, fmt.Errorf("could not get terraform state: %w", err)
-	}
+func (eventLogStrategy) measure(w *workspace) (*measurement, error) {
+	cfg, logger := w.cfg, w.logger
 	resourceTypes := map[string]int{}
-	for _, r := range tfstate.Resources {
-		if r.Mode == "data" {
+	for _, r := range w.tfstate.Resources {
+		if r.Mode == "data" && !cfg.DataSources {
 			continue
 		}
 		resourceTypes[r.Type] += len(r.Instances)
@@ -284,15 +581,13 @@ func eventLogRefreshBenchmark(cfg *Config, tfRunner *TerraformRunner, logger *za
 	for _, v := range resourceTypes {
 		totalCount += v
 	}
-	report := newReport(cfg, tfRunner)
-	if report.TerraformVersion != nil {
-		v0154, err1 := version.NewVersion("v0.15.4")
-		v, err2 := version.NewVersion(report.TerraformVersion.TerraformVersion)
-		if err1 == nil && err2 == nil && v.LessThan(v0154) {
-			return nil, fmt.Errorf(`terraform version is too low to use event log measurement method. 
-Your terraform version is %s, event log measurement method requires at least v0.15.4.
-Set --event-log=false flag to use the temporary directory measurement method.`, report.TerraformVersion.TerraformVersion)
-		}
+	if w.sample != nil {
+		totalCount = len(w.sample.addrs)
+	}
+	if !w.tfVersion.SupportsEventLog() {
+		return nil, fmt.Errorf(`terraform version is too low to use event log measurement method. 
+Your %s, event log measurement method requires at least terraform v0.15.4 or any opentofu version.
+Set --method=temp-dir flag to use the temporary directory measurement method.`, w.tfVersion)
 	}
 	// Get the JSON event log output of a refresh
 	args := []string{
@@ -303,26 +598,18 @@ Set --event-log=false flag to use the temporary directory measurement method.`,
 	if cfg.VarFile != "" {
 		args = append(args, "-var-file="+cfg.VarFile)
 	}
-	var wholeWorkspaceTotal time.Duration
-	reports := map[string]*ResourceReport{}
-	resourceOverallData := map[string][]float64{}
+	if w.sample != nil {
+		args = append(args, w.sample.targets()...)
+	}
+	m := &measurement{}
 	for i := 0; i < cfg.Iterations; i++ {
+		before := w.host.start()
 		begin := time.Now()
 		logger.Debug("Begin running terraform plan -refresh-only -json")
-		stdout, waitFunc, err := tfRunner.RunAsync(args...)
+		stdout, waitFunc, err := w.tfRunner.RunAsync(args...)
 		if err != nil {
 			return nil, fmt.Errorf("starting terraform plan -refresh-only -json: %w", err)
 		}
-		type tfEvent struct {
-			Type      string
-			Timestamp time.Time `json:"@timestamp"`
-			Hook      struct {
-				Resource struct {
-					Addr         string
-					ResourceType string `json:"resource_type"`
-				}
-			}
-		}
 		bar := progressbar.NewOptions64(
 			int64(totalCount),
 			progressbar.OptionSetDescription(fmt.Sprintf("Iteration %d", i+1)),
@@ -340,31 +627,15 @@ Set --event-log=false flag to use the temporary directory measurement method.`,
 		if err != nil {
 			logger.Debug("could not render blank progress bar", zap.Error(err))
 		}
-		starts := map[string]tfEvent{}
-		ends := map[string]tfEvent{}
-		scanner := bufio.NewScanner(stdout)
-		for scanner.Scan() {
-			var event tfEvent
-			err := json.Unmarshal(scanner.Bytes(), &event)
+		iterationSamples, failed := readRefreshEvents(stdout, i, cfg.DataSources, func() {
+			err := bar.Add(1)
 			if err != nil {
-				logger.Debug("could not decode JSON object from Terraform event log",
-					zap.String("line", scanner.Text()),
-					zap.Error(err))
-				continue
-			}
-			if event.Type == "refresh_start" {
-				starts[event.Hook.Resource.Addr] = event
-			} else if event.Type == "refresh_complete" {
-				ends[event.Hook.Resource.Addr] = event
-				err := bar.Add(1)
-				if err != nil {
-					logger.Debug("could not increment progress bar", zap.Error(err))
-				}
+				logger.Debug("could not increment progress bar", zap.Error(err))
 			}
-		}
-		err = waitFunc()
-		if err != nil {
-			logger.Warn("could not wait for terraform plan -refresh-only -json to finish", zap.Error(err))
+		}, logger)
+		usage, waitErr := waitFunc()
+		if waitErr != nil {
+			logger.Warn("could not wait for terraform plan -refresh-only -json to finish", zap.Error(waitErr))
 		}
 		finish := time.Now()
 		err = bar.Finish()
@@ -372,109 +643,120 @@ Set --event-log=false flag to use the temporary directory measurement method.`,
 			logger.Debug("could not finish progress bar", zap.Error(err))
 		}
 		logger.Debug("Finished running terraform plan -refresh-only -json")
+		if err := w.host.finish(i, before); err != nil {
+			return nil, err
+		}
 
-		wholeWorkspaceTotal += finish.Sub(begin)
-		type ResourceMeasurement struct {
-			d  time.Duration
-			id string
-		}
-		measurements := map[string][]*ResourceMeasurement{}
-		for k, start := range starts {
-			if end, ok := ends[k]; ok {
-				d := end.Timestamp.Sub(start.Timestamp)
-				measurements[start.Hook.Resource.ResourceType] = append(measurements[start.Hook.Resource.ResourceType], &ResourceMeasurement{
-					d:  d,
-					id: start.Hook.Resource.Addr,
-				})
-			}
+		m.workspace = append(m.workspace, finish.Sub(begin))
+		m.events = append(m.events, &iterationEvents{start: begin, end: finish, samples: iterationSamples, failed: failed, err: waitErr})
+		if usage != nil {
+			m.usage = append(m.usage, usage)
 		}
-		for resourceType, resourceMeasurements := range measurements {
-			rr := &ResourceReport{
-				Name:  resourceType,
-				Count: len(resourceMeasurements),
-				Min:   (1 << 63) - 1,
-			}
-			if _, ok := reports[resourceType]; ok {
-				rr = reports[resourceType]
-			} else {
-				reports[resourceType] = rr
-			}
-			var total int64
-			for _, measurement := range resourceMeasurements {
-				resourceOverallData[resourceType] = append(resourceOverallData[resourceType], float64(measurement.d))
-				total += int64(measurement.d)
-				if int64(measurement.d) < int64(rr.Min) {
-					rr.Min = measurement.d
-					rr.MinID = measurement.id
-				}
-				if int64(measurement.d) > int64(rr.Max) {
-					rr.Max = measurement.d
-					rr.MaxID = measurement.id
-				}
+		for _, s := range iterationSamples {
+			// Targeted resources depend on others that are refreshed too.
+			if w.sample == nil || w.sample.addrs[s.Addr] {
+				m.samples = append(m.samples, s)
 			}
-			avg := time.Duration(total / int64(len(resourceMeasurements)))
-			rr.TotalTime += avg
 		}
 	}
-	for _, r := range reports {
-		r.TotalTime = time.Duration(int64(r.TotalTime) / int64(cfg.Iterations))
-		r.StdDev = time.Duration(stat.PopStdDev(resourceOverallData[r.Name], nil))
-		report.Resources = append(report.Resources, r)
-	}
-	report.TotalTime = time.Duration(int64(wholeWorkspaceTotal) / int64(cfg.Iterations))
-
-	// Reverse sort the reports by TotalTime * Count
-	sort.Slice(report.Resources, func(i, j int) bool {
-		return (int64(report.Resources[i].TotalTime) * int64(report.Resources[i].Count)) > (int64(report.Resources[j].TotalTime) * int64(report.Resources[j].Count))
-	})
-
-	return report, nil
+	return m, nil
 }
 
-func resourceBenchmark(cfg *Config, resource *Resource, state []byte, tfv *TerraformVersion, tfRunner *TerraformRunner) (*ResourceReport, error) {
-	dir := os.TempDir()
-	defer func(path string) {
-		_ = os.RemoveAll(path)
-	}(dir)
-	// Copy over any tfvars or tfvars.json files
-	_, _ = util.RunCommand("/bin/sh", "-c", fmt.Sprintf("cp -R *.tfvars *.tfvars.json %s", dir))
-	// Generate the modified TF file
-	modifiedTf, err := createModifiedTerraformConfiguration(resource, cfg.VarFile, tfv)
+// resourceBenchmark measures the refresh time and usage of resource in every
+// iteration of the temp-dir method.
+func resourceBenchmark(cfg *Config, resource *Resource, state []byte, tfv *TerraformVersion, tfRunner *TerraformRunner, monitor *hostMonitor) ([]time.Duration, []*util.Usage, error) {
+	dir, err := util.MkdirTemp("tf-bench.")
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create temp dir: %w", err)
+	}
+	defer util.RemoveTempDir(dir)
+	varFile := cfg.VarFile
+	if cfg.SecretsSafe {
+		// Variable values are passed through the environment instead.
+		varFile = ""
+	} else {
+		// Copy over any tfvars or tfvars.json files
+		_, _ = util.RunCommand("/bin/sh", "-c", fmt.Sprintf("cp -R *.tfvars *.tfvars.json %s", dir))
+	}
+	// Generate the modified TF files
+	modifiedTf, env, err := createModifiedTerraformConfiguration(resource, cfg.VarFile, tfv, cfg.SecretsSafe)
 	if err != nil {
-		return nil, fmt.Errorf("creating modified tf file: %w", err)
+		return nil, nil, fmt.Errorf("creating modified tf file: %w", err)
 	}
+	tfRunner = tfRunner.WithEnv(env...)
 
 	// Change dir into the temp dir
 	pwd, err := os.Getwd()
 	if err != nil {
-		return nil, fmt.Errorf("could not get current working dir: %w", err)
+		return nil, nil, fmt.Errorf("could not get current working dir: %w", err)
 	}
 	err = os.Chdir(dir)
 	if err != nil {
-		return nil, fmt.Errorf("could not change dir: %w", err)
+		return nil, nil, fmt.Errorf("could not change dir: %w", err)
 	}
 	defer func(dir string) {
 		_ = os.Chdir(dir)
 	}(pwd)
-	// Write the modified tf file
-	err = os.WriteFile("main.tf", modifiedTf, 0644)
+	// Write the modified tf files
+	for name, content := range modifiedTf {
+		err = os.MkdirAll(filepath.Dir(name), 0700)
+		if err != nil {
+			return nil, nil, fmt.Errorf("creating module dir: %w", err)
+		}
+		err = os.WriteFile(name, content, 0600)
+		if err != nil {
+			return nil, nil, fmt.Errorf("writing modified tf file: %w", err)
+		}
+	}
+	modifiedState, err := filterState(state, resource)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = os.WriteFile(stateFileName, modifiedState, 0600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("writing modified state: %w", err)
+	}
+	// Terraform init
+	_, err = tfRunner.Run("init")
+	if err != nil {
+		return nil, nil, fmt.Errorf("terraform init: %w", err)
+	}
+	// Measure terraform refresh
+	ds, usage, err := measureRefresh(dir, cfg.Iterations, tfRunner, monitor, refreshArgs(varFile)...)
 	if err != nil {
-		return nil, fmt.Errorf("writing modified tf file: %w", err)
+		return nil, nil, fmt.Errorf("measuring refresh time: %w", err)
 	}
+	return ds, usage, nil
+}
+
+// filterState removes every resource from state that is not one of resource.
+func filterState(state []byte, resource *Resource) ([]byte, error) {
 	// Use gojq to pull out just the resources we want to measure
-	query, err := gojq.Parse(fmt.Sprintf("del(.resources[] | select(.type != \"%s\"))", resource.Name))
+	query, err := gojq.Parse(`del(.resources[] | select(.type != $type or ((.module // "") | IN($modules[]) | not)))`)
 	if err != nil {
 		return nil, fmt.Errorf("could not parse gojq query: %w", err)
 	}
+	code, err := gojq.Compile(query, gojq.WithVariables([]string{"$type", "$modules"}))
+	if err != nil {
+		return nil, fmt.Errorf("could not compile gojq query: %w", err)
+	}
 	var s interface{}
 	err = json.Unmarshal(state, &s)
 	if err != nil {
 		return nil, fmt.Errorf("could not unmarshal state: %w", err)
 	}
-	iter := query.Run(s)
+	modules := []interface{}{}
+	for _, m := range resource.ModuleInstances {
+		modules = append(modules, m)
+	}
+	if resource.Module == "" {
+		// Resources in the root module have no module path.
+		modules = append(modules, "")
+	}
+	iter := code.Run(s, resource.Name, modules)
 	v, ok := iter.Next()
 	if !ok {
-		return nil, nil
+		return nil, fmt.Errorf("gojq query returned no state")
 	}
 	if err, ok := v.(error); ok {
 		return nil, fmt.Errorf("iterating through gojq query results: %w", err)
@@ -483,146 +765,72 @@ func resourceBenchmark(cfg *Config, resource *Resource, state []byte, tfv *Terra
 	if err != nil {
 		return nil, fmt.Errorf("marshalling modified statefile: %w", err)
 	}
-	err = os.WriteFile(stateFileName, modifiedState, 0644)
-	if err != nil {
-		return nil, fmt.Errorf("writing modified state: %w", err)
-	}
-	// Terraform init
-	_, err = tfRunner.Run("init")
-	if err != nil {
-		return nil, fmt.Errorf("terraform init: %w", err)
+	return modifiedState, nil
+}
+
+// refreshArgs returns the arguments of a terraform refresh with varFile.
+func refreshArgs(varFile string) []string {
+	args := []string{
+		"refresh",
+		fmt.Sprintf("-parallelism=%d", defaultParallelism),
 	}
-	// Measure terraform refresh
-	t, err := measureRefresh(dir, defaultParallelism, cfg.Iterations, cfg.VarFile, tfRunner)
-	if err != nil {
-		return nil, fmt.Errorf("measuring refresh time: %w", err)
+	if varFile != "" {
+		args = append(args, fmt.Sprintf("-var-file=%s", varFile))
 	}
-
-	return &ResourceReport{
-		Name:      resource.Name,
-		TotalTime: t,
-	}, nil
+	return args
 }
 
-func measureRefresh(dir string, parallelism, iterations int, varFile string, tfRunner *TerraformRunner) (time.Duration, error) {
+// measureRefresh runs terraform with args in dir and returns the run time and
+// usage of every iteration. monitor, which may be nil, watches the load of the
+// host during every iteration.
+func measureRefresh(dir string, iterations int, tfRunner *TerraformRunner, monitor *hostMonitor, args ...string) ([]time.Duration, []*util.Usage, error) {
 	// I've noticed some inflated results and it seems that
 	// Terraform is doing some extra work when running an initial
 	// Terraform refresh. So, we will throw out the result of the
 	// first Terraform refresh.
-	_, _ = measureRefreshOnce(dir, parallelism, varFile, tfRunner)
-	var total time.Duration
+	_, _, _ = measureRefreshOnce(dir, tfRunner, args...)
+	var ds []time.Duration
+	var usage []*util.Usage
 	for i := 0; i < iterations; i++ {
 		fmt.Printf("iteration %d:  ", i)
 		var done bool
 		go util.PrintSpinner(&done)
-		one, err := measureRefreshOnce(dir, parallelism, varFile, tfRunner)
+		before := monitor.start()
+		one, u, err := measureRefreshOnce(dir, tfRunner, args...)
 		done = true
 		time.Sleep(120 * time.Millisecond)
 		if err != nil {
-			return 0, err
+			return nil, nil, err
+		}
+		if err := monitor.finish(i, before); err != nil {
+			return nil, nil, err
 		}
 		fmt.Print(one.Round(time.Millisecond).String() + " ")
-		total += one
+		ds = append(ds, one)
+		usage = append(usage, u)
 	}
-	return time.Duration(int64(total) / int64(iterations)), nil
+	return ds, usage, nil
 }
 
-func measureRefreshOnce(dir string, parallelism int, varFile string, tfRunner *TerraformRunner) (time.Duration, error) {
+func measureRefreshOnce(dir string, tfRunner *TerraformRunner, args ...string) (time.Duration, *util.Usage, error) {
 	pwd, err := os.Getwd()
 	if err != nil {
-		return 0, fmt.Errorf("could not get current working dir: %w", err)
+		return 0, nil, fmt.Errorf("could not get current working dir: %w", err)
 	}
 	err = os.Chdir(dir)
 	if err != nil {
-		return 0, fmt.Errorf("could not change dir: %w", err)
+		return 0, nil, fmt.Errorf("could not change dir: %w", err)
 	}
 	defer func(dir string) {
 		_ = os.Chdir(dir)
 	}(pwd)
-	args := []string{
-		"refresh",
-		fmt.Sprintf("-parallelism=%d", parallelism),
-	}
-	if varFile != "" {
-		args = append(args, fmt.Sprintf("-var-file=%s", varFile))
-	}
 	start := time.Now()
-	_, err = tfRunner.Run(args...)
+	_, usage, err := tfRunner.RunWithUsage(args...)
 	end := time.Now()
 	if err != nil {
-		return 0, fmt.Errorf("could not run terraform refresh: %w", err)
-	}
-	return end.Sub(start), nil
-}
-
-type TerraformVersion struct {
-	TerraformVersion   string            `json:"terraform_version"`
-	ProviderSelections map[string]string `json:"provider_selections"`
-}
-
-var (
-	simpleVersionRe = `v?(?P<version>[0-9]+(?:\.[0-9]+)*(?:-[A-Za-z0-9\.]+)?)`
-
-	versionOutputRe         = regexp.MustCompile(`^Terraform ` + simpleVersionRe)
-	providerVersionOutputRe = regexp.MustCompile(`(\n\+ provider[\. ](?P<name>\S+) ` + simpleVersionRe + `)`)
-)
-
-func terraformVersion(tfRunner *TerraformRunner) (*TerraformVersion, error) {
-	out, err := tfRunner.Run("version", "-json")
-	if err != nil {
-		return nil, fmt.Errorf("running terraform version -json command: %w", err)
-	}
-	var tv TerraformVersion
-	err = json.Unmarshal(out, &tv)
-	if err != nil {
-		// Couldn't unmarshal, could be on old Terraform that does not
-		// support -json output.
-		v, pv, err := parseOldVersionOutput(string(out))
-		if err != nil {
-			return nil, fmt.Errorf("parsing terraform version output: %w", err)
-		}
-		pvs := map[string]string{}
-		for k, v := range pv {
-			pvs[k] = v.String()
-		}
-		tv = TerraformVersion{
-			TerraformVersion:   v.String(),
-			ProviderSelections: pvs,
-		}
-	}
-	return &tv, nil
-}
-
-// From: github.com/hashicorp/terraform-exec/tfexec/version.go
-func parseOldVersionOutput(stdout string) (*version.Version, map[string]*version.Version, error) {
-	stdout = strings.TrimSpace(stdout)
-
-	submatches := versionOutputRe.FindStringSubmatch(stdout)
-	if len(submatches) != 2 {
-		return nil, nil, fmt.Errorf("unexpected number of version matches %d for %s", len(submatches), stdout)
-	}
-	v, err := version.NewVersion(submatches[1])
-	if err != nil {
-		return nil, nil, fmt.Errorf("unable to parse version %q: %w", submatches[1], err)
-	}
-
-	allSubmatches := providerVersionOutputRe.FindAllStringSubmatch(stdout, -1)
-	provV := map[string]*version.Version{}
-
-	for _, submatches := range allSubmatches {
-		if len(submatches) != 4 {
-			return nil, nil, fmt.Errorf("unexpected number of providerion version matches %d for %s", len(submatches), stdout)
-		}
-
-		v, err := version.NewVersion(submatches[3])
-		if err != nil {
-			return nil, nil, fmt.Errorf("unable to parse provider version %q: %w", submatches[3], err)
-		}
-
-		provV[submatches[2]] = v
+		return 0, nil, fmt.Errorf("could not run terraform %s: %w", args[0], err)
 	}
-
-	return v, provV, err
+	return end.Sub(start), usage, nil
 }
 
 func controllerVersion() (*goaviatrix.AviatrixVersion, error) {
@@ -654,25 +862,72 @@ func terraformState(tfRunner *TerraformRunner) (*TerraformState, []byte, error)
 	return &tfstate, state, nil
 }
 
-func createModifiedTerraformConfiguration(resource *Resource, varFile string, tfVersion *TerraformVersion) ([]byte, error) {
+// createModifiedTerraformConfiguration builds a configuration with just the
+// providers of resource, and the module calls leading to resources in child
+// modules. It returns the generated files by path relative to the root
+// module. Provider arguments are resolved to literal values so the
+// configuration is self-contained. In secretsSafe mode values are never
+// written into the configuration, they are returned as TF_VAR_ environment
+// variables to run terraform with instead.
+func createModifiedTerraformConfiguration(resource *Resource, varFile string, tfVersion *TerraformVersion, secretsSafe bool) (map[string][]byte, []string, error) {
 	// We want to build a tf file that contains just these block types:
 	// variable
 	// provider
 	// terraform
-	tfFiles, err := filepath.Glob("*.tf")
+	files, err := readConfigFiles(".")
 	if err != nil {
-		fmt.Printf("WARN filepath.Glob: %v\n", err)
+		return nil, nil, err
+	}
+	// Provider blocks are labeled with local names, required_providers
+	// maps them to the source addresses recorded in state.
+	sources := requiredProviderSources(files)
+	// Provider arguments are only evaluated when needed.
+	var ev *evaluator
+	var secrets *secretVariables
+	moduleProviders := false
+	for _, p := range resource.Providers {
+		if p.Module != "" {
+			moduleProviders = true
+		}
 	}
-	modifiedTfFile := hclwrite.NewEmptyFile()
-	for _, name := range tfFiles {
-		fileContent, err := os.ReadFile(name)
+	if secretsSafe || moduleProviders {
+		ev, err = newEvaluator(".", varFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not evaluate variables: %w", err)
+		}
+	}
+	if secretsSafe {
+		secrets = newSecretVariables(tfVersion)
+	}
+	generated := map[string][]byte{}
+	// Module calls are generated first, the provider configurations
+	// they are passed have to be kept.
+	passed := map[string]bool{}
+	if calls := moduleTree(resource.ModuleInstances); len(calls) > 0 {
+		dirs, err := moduleDirs()
 		if err != nil {
-			return nil, fmt.Errorf("could not read tf file %s: %w", name, err)
+			return nil, nil, err
+		}
+		g := &moduleGenerator{
+			resource: resource,
+			dirs:     dirs,
+			secrets:  secrets,
+			evaluate: moduleProviders,
+			files:    generated,
 		}
-		f, diags := hclwrite.ParseConfig(fileContent, name, hcl.InitialPos)
-		if diags.HasErrors() {
-			return nil, fmt.Errorf("parsing tf file %s: %s", name, diags.Error())
+		modulesFile := hclwrite.NewEmptyFile()
+		passed, _, err = g.appendCalls(modulesFile.Body(), ".", ev, calls)
+		if err != nil {
+			return nil, nil, err
 		}
+		generated["modules.tf"] = modulesFile.Bytes()
+	}
+	passedNames := map[string]bool{}
+	for name := range passed {
+		passedNames[strings.Split(name, ".")[0]] = true
+	}
+	modifiedTfFile := hclwrite.NewEmptyFile()
+	for _, f := range files {
 		blocks := f.Body().Blocks()
 		for _, block := range blocks {
 			if block.Type() == "variable" || block.Type() == "provider" || block.Type() == "terraform" {
@@ -686,30 +941,34 @@ func createModifiedTerraformConfiguration(resource *Resource, varFile string, tf
 						}
 						// Remove unnecessary required_providers
 						if tfBlock.Type() == "required_providers" {
-							for k, _ := range tfBlock.Body().Attributes() {
-								if k != strings.Split(resource.Name, "_")[0] {
+							for k := range tfBlock.Body().Attributes() {
+								if !resource.usesProvider(k, sources[k]) && !passedNames[k] {
 									tfBlock.Body().RemoveAttribute(k)
 								}
 							}
 						}
 					}
 				}
-				tfv, err := version.NewVersion(tfVersion.TerraformVersion)
-				if err != nil {
-					tfv = version.Must(version.NewVersion("v0.12"))
-				}
-				if block.Type() == "provider" && tfv.GreaterThanOrEqual(tf15) {
-					if labels := block.Labels(); len(labels) > 0 {
-						label := labels[0]
-						if label != strings.Split(resource.Name, "_")[0] {
-							continue
-						}
-						attrs := block.Body().Attributes()
-						for k, v := range attrs {
-							if len(v.Expr().Variables()) == 0 {
-								continue
+				if block.Type() == "provider" {
+					labels := block.Labels()
+					if len(labels) == 0 {
+						continue
+					}
+					// Remove unnecessary provider configurations
+					alias := providerBlockAlias(block)
+					if !resource.usesProviderConfig("", labels[0], sources[labels[0]], alias) && !passed[providerConfigName(labels[0], alias)] {
+						continue
+					}
+					if secretsSafe || tfVersion.coreVersion().GreaterThanOrEqual(tf15) {
+						if ev == nil {
+							ev, err = newEvaluator(".", varFile)
+							if err != nil {
+								return nil, nil, fmt.Errorf("could not evaluate provider configuration: %w", err)
 							}
-							block.Body().SetAttributeValue(k, evaluate(v, varFile))
+						}
+						err = ev.resolveBody(block.Body(), secrets)
+						if err != nil {
+							return nil, nil, fmt.Errorf("provider %s: %w", labels[0], err)
 						}
 					}
 				}
@@ -717,47 +976,15 @@ func createModifiedTerraformConfiguration(resource *Resource, varFile string, tf
 			}
 		}
 	}
-	return modifiedTfFile.Bytes(), nil
-}
-
-func evaluate(attr *hclwrite.Attribute, varFile string) cty.Value {
-	return eval(attr, varFile, false)
-}
-
-func eval(attr *hclwrite.Attribute, varFile string, sensitive bool) cty.Value {
-	args := []string{
-		"console",
-	}
-	if varFile != "" {
-		args = append(args, fmt.Sprintf("-var-file=%s", varFile))
-	}
-	console := exec.Command("terraform", args...)
-	pipe, _ := console.StdinPipe()
-
-	var b bytes.Buffer
-	console.Stdout = &b
-	err := console.Start()
-	if err != nil {
-		fmt.Println(err)
-	}
-	attrString := string(attr.Expr().BuildTokens(nil).Bytes())
-	if sensitive {
-		attrString = "nonsensitive(" + attrString + ")"
-	}
-	_, err = io.WriteString(pipe, attrString)
-	if err != nil {
-		fmt.Println(err)
+	if !secretsSafe {
+		generated["main.tf"] = modifiedTfFile.Bytes()
+		return generated, nil, nil
 	}
-	_ = pipe.Close()
-	err = console.Wait()
+	secrets.declare(modifiedTfFile.Body())
+	generated["main.tf"] = modifiedTfFile.Bytes()
+	env, err := secrets.environ(ev)
 	if err != nil {
-		fmt.Println(err)
-	}
-	s := b.String()
-	s = strings.TrimSpace(s)
-	s = strings.Trim(s, `"`)
-	if s == "(sensitive)" && !sensitive {
-		return eval(attr, varFile, true)
+		return nil, nil, err
 	}
-	return cty.StringVal(s)
+	return generated, env, nil
 }
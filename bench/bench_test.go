@@ -1,14 +1,11 @@
 package bench
 
 import (
-	"archive/zip"
-	"bytes"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
-	"runtime"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -27,7 +24,7 @@ func TestBenchmark(t *testing.T) {
 			cfg: &Config{
 				SkipControllerVersion: true,
 				Iterations:            1,
-				EventLog:              true,
+				Method:                MethodEventLog,
 			},
 			workspace: []string{
 				`
@@ -43,7 +40,23 @@ resource "random_id" "id" {
 			cfg: &Config{
 				SkipControllerVersion: true,
 				Iterations:            1,
-				EventLog:              true,
+				Method:                MethodEventLog,
+			},
+			workspace: []string{
+				`
+resource "random_id" "id" {
+  count       = 10
+  byte_length = 16
+}`,
+			},
+		},
+		{
+			name:             "terraform v1.0.0, target method",
+			terraformVersion: "1.0.0",
+			cfg: &Config{
+				SkipControllerVersion: true,
+				Iterations:            1,
+				Method:                MethodTarget,
 			},
 			workspace: []string{
 				`
@@ -59,7 +72,7 @@ resource "random_id" "id" {
 			cfg: &Config{
 				SkipControllerVersion: true,
 				Iterations:            1,
-				EventLog:              false,
+				Method:                MethodTempDir,
 			},
 			workspace: []string{
 				`
@@ -70,6 +83,9 @@ resource "random_id" "id" {
 			},
 		},
 	}
+	pwd, err := os.Getwd()
+	require.NoError(t, err)
+	defer os.Chdir(pwd)
 	for _, tc := range tt {
 		t.Run(tc.name, func(t *testing.T) {
 			dir, err := os.MkdirTemp("", "bench.TestBenchmark.")
@@ -94,44 +110,19 @@ resource "random_id" "id" {
 }
 
 func terraformRunnerAtVersion(t *testing.T, v string) (*TerraformRunner, error) {
-	home, err := os.UserHomeDir()
-	require.NoError(t, err)
-	tfBenchDir := filepath.Join(home, ".tf-bench")
-	os.MkdirAll(tfBenchDir, 0777)
-	require.NoError(t, err)
-	execPath := fmt.Sprintf("%s/terraform%s", tfBenchDir, v)
-	tfRunner := &TerraformRunner{execPath: execPath}
-	_, err = tfRunner.Run("version")
+	tfRunner, err := TerraformAtVersion(v)
 	if err == nil {
 		return tfRunner, nil
 	}
-	path := fmt.Sprintf("https://releases.hashicorp.com/terraform/%[1]s/terraform_%[1]s_%[2]s_%[3]s.zip", v, runtime.GOOS, runtime.GOARCH)
-	resp, err := http.Get(path)
-	require.NoError(t, err)
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	require.NoError(t, err)
-	zipReader, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
-	require.NoError(t, err)
-	if len(zipReader.File) != 1 {
-		require.Fail(t, "expected tf download to have 1 file")
-	}
-	unzippedFileBytes, err := readZipFile(zipReader.File[0])
-	require.NoError(t, err)
-	err = os.WriteFile(execPath, unzippedFileBytes, 0777)
-	require.NoError(t, err)
-	_, err = tfRunner.Run("version")
-	if err != nil {
-		return nil, fmt.Errorf("something went wrong installing tf version: %v", err)
-	}
-	return tfRunner, nil
-}
-
-func readZipFile(zf *zip.File) ([]byte, error) {
-	f, err := zf.Open()
-	if err != nil {
-		return nil, err
+	dir := t.TempDir()
+	for _, name := range []string{releaseZipName(v), releaseSumsName(v)} {
+		resp, err := http.Get(fmt.Sprintf("https://releases.hashicorp.com/terraform/%s/%s", v, name))
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		err = os.WriteFile(filepath.Join(dir, name), body, 0644)
+		require.NoError(t, err)
 	}
-	defer f.Close()
-	return ioutil.ReadAll(f)
+	return InstallTerraform(v, dir, "")
 }
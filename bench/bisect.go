@@ -0,0 +1,273 @@
+package bench
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CyrusJavan/tf-bench/internal/util"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"go.uber.org/zap"
+)
+
+// BisectConfig describes the provider history to search for a refresh time regression.
+type BisectConfig struct {
+	ProviderRepo string  // ProviderRepo is the git repository of the provider
+	Good         string  // Good is a revision without the regression
+	Bad          string  // Bad is a revision with the regression
+	ResourceType string  // ResourceType is the only resource type benchmarked
+	Provider     string  // Provider to override, defaults to the provider of ResourceType in state
+	Threshold    float64 // Threshold is the slowdown relative to Good, 0.2 for 20%, that marks a revision bad
+}
+
+// BisectResult is the first revision whose refresh time crossed the threshold.
+type BisectResult struct {
+	Timestamp    time.Time              // Timestamp is the start of the bisect
+	Config       *BisectConfig          // Config that this result was generated with
+	Baseline     time.Duration          // Baseline is the refresh time at the good revision
+	FirstBad     string                 // FirstBad is the first revision whose refresh time crossed the threshold
+	Commit       string                 // Commit is the description of FirstBad from git show
+	Measurements []*RevisionMeasurement // Measurements of every tested revision in the order they were tested
+	BuildVersion string                 // BuildVersion of tf-bench
+}
+
+// RevisionMeasurement is the refresh time of the resource type with the provider built at Revision.
+type RevisionMeasurement struct {
+	Revision  string
+	TotalTime time.Duration
+	Bad       bool
+}
+
+func (r *BisectResult) String() string {
+	t := table.NewWriter()
+	t.Style().Format.Header = text.FormatDefault
+	t.AppendHeader(table.Row{"Revision", r.Config.ResourceType, "Change", "Verdict"})
+	for _, m := range r.Measurements {
+		verdict := "good"
+		if m.Bad {
+			verdict = "bad"
+		}
+		change := float64(m.TotalTime-r.Baseline) / float64(r.Baseline) * 100
+		t.AppendRow(table.Row{shortRevision(m.Revision), m.TotalTime.Round(time.Millisecond), fmt.Sprintf("%+.1f%%", change), verdict})
+	}
+	if r.BuildVersion == "" {
+		r.BuildVersion = "development-build"
+	}
+	return fmt.Sprintf(`tf-bench (%s) Bisect Report %s
+resource type: %s
+threshold: %+.1f%% of %s at %s
+%s is the first bad commit
+%s
+%s
+`, r.BuildVersion, r.Timestamp.Format(time.RFC3339Nano), r.Config.ResourceType,
+		r.Config.Threshold*100, r.Baseline.Round(time.Millisecond), shortRevision(r.Config.Good),
+		r.FirstBad, strings.TrimSpace(r.Commit), t.Render())
+}
+
+func shortRevision(rev string) string {
+	if len(rev) > 12 {
+		return rev[:12]
+	}
+	return rev
+}
+
+// ParseThreshold parses a relative threshold such as "20%" or "0.2".
+func ParseThreshold(s string) (float64, error) {
+	percent := strings.HasSuffix(s, "%")
+	f, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse threshold %q: %w", s, err)
+	}
+	if percent {
+		f /= 100
+	}
+	if f <= 0 {
+		return 0, fmt.Errorf("threshold %q must be greater than zero", s)
+	}
+	return f, nil
+}
+
+// Bisect binary searches the provider history between bcfg.Good and bcfg.Bad
+// for the first commit whose refresh time of bcfg.ResourceType crosses the
+// threshold. At each step the provider is built with `go build` and used
+// through a provider override.
+func Bisect(cfg *Config, bcfg *BisectConfig, tfRunner *TerraformRunner, logger *zap.Logger) (*BisectResult, error) {
+	if logger == nil {
+		var err error
+		logger, err = zap.NewProduction()
+		if err != nil {
+			return nil, fmt.Errorf("could not initialize logger: %w", err)
+		}
+	}
+	git := func(arg ...string) (string, error) {
+		out, err := util.RunCommand("git", append([]string{"-C", bcfg.ProviderRepo}, arg...)...)
+		return strings.TrimSpace(string(out)), err
+	}
+	status, err := git("status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return nil, fmt.Errorf("could not read provider repository status: %w", err)
+	}
+	if status != "" {
+		return nil, fmt.Errorf("provider repository %s has uncommitted changes, commit or stash them before bisecting", bcfg.ProviderRepo)
+	}
+	// Restore whatever was checked out when we are done.
+	original, err := git("symbolic-ref", "-q", "--short", "HEAD")
+	if err != nil {
+		original, err = git("rev-parse", "HEAD")
+		if err != nil {
+			return nil, fmt.Errorf("could not find current revision of provider repository: %w", err)
+		}
+	}
+	defer func() {
+		_, _ = git("checkout", "-q", original)
+	}()
+	good, err := git("rev-parse", "--verify", bcfg.Good+"^{commit}")
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve good revision %s: %w", bcfg.Good, err)
+	}
+	bad, err := git("rev-parse", "--verify", bcfg.Bad+"^{commit}")
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve bad revision %s: %w", bcfg.Bad, err)
+	}
+	revList, err := git("rev-list", "--ancestry-path", "--reverse", good+".."+bad)
+	if err != nil {
+		return nil, fmt.Errorf("could not list revisions between %s and %s: %w", bcfg.Good, bcfg.Bad, err)
+	}
+	revs := strings.Fields(revList)
+	if len(revs) == 0 {
+		return nil, fmt.Errorf("bad revision %s is not a descendant of good revision %s", bcfg.Bad, bcfg.Good)
+	}
+
+	tfstate, state, err := terraformState(tfRunner)
+	if err != nil {
+		return nil, err
+	}
+	resource, ok := tfstate.resourcesByType("managed")[bcfg.ResourceType]
+	if !ok {
+		return nil, fmt.Errorf("there are no %s resources in the state file", bcfg.ResourceType)
+	}
+	tv, err := terraformVersion(tfRunner)
+	if err != nil {
+		return nil, fmt.Errorf("could not find terraform version: %w", err)
+	}
+	provider := bcfg.Provider
+	if provider == "" {
+		p := resource.Providers[0]
+		provider = p.Type
+		if p.Source != "" {
+			provider = p.Source
+		}
+	}
+	buildDir, err := util.MkdirTemp("tf-bench-bisect.")
+	if err != nil {
+		return nil, fmt.Errorf("could not create build dir: %w", err)
+	}
+	defer util.RemoveTempDir(buildDir)
+	binary := filepath.Join(buildDir, "terraform-provider-"+providerType(provider))
+	if runtime.GOOS == "windows" {
+		binary += ".exe"
+	}
+
+	result := &BisectResult{
+		Timestamp: time.Now(),
+		Config:    bcfg,
+	}
+	measure := func(rev string) (time.Duration, error) {
+		logger.Debug("Measuring provider revision", zap.String("revision", rev))
+		_, err := git("checkout", "-q", rev)
+		if err != nil {
+			return 0, fmt.Errorf("could not check out %s: %w", rev, err)
+		}
+		_, err = util.RunCommandInDir(bcfg.ProviderRepo, nil, "go", "build", "-o", binary)
+		if err != nil {
+			return 0, fmt.Errorf("could not build provider at %s: %w", rev, err)
+		}
+		overrideRunner, cleanup, err := tfRunner.withProviderOverrides([]*ProviderOverride{{Name: provider, Path: binary}}, tv)
+		if err != nil {
+			return 0, err
+		}
+		defer cleanup()
+		fmt.Printf("%s %s measurement:  ", shortRevision(rev), bcfg.ResourceType)
+		ds, _, err := resourceBenchmark(cfg, resource, state, tv, overrideRunner, nil)
+		fmt.Println()
+		if err != nil {
+			return 0, fmt.Errorf("could not measure %s at %s: %w", bcfg.ResourceType, rev, err)
+		}
+		return averageDuration(ds), nil
+	}
+	isBad := func(rev string) (bool, error) {
+		d, err := measure(rev)
+		if err != nil {
+			return false, err
+		}
+		bad := float64(d) > float64(result.Baseline)*(1+bcfg.Threshold)
+		result.Measurements = append(result.Measurements, &RevisionMeasurement{
+			Revision:  rev,
+			TotalTime: d,
+			Bad:       bad,
+		})
+		return bad, nil
+	}
+
+	result.Baseline, err = measure(good)
+	if err != nil {
+		return nil, err
+	}
+	result.Measurements = append(result.Measurements, &RevisionMeasurement{Revision: good, TotalTime: result.Baseline})
+	crossed, err := isBad(bad)
+	if err != nil {
+		return nil, err
+	}
+	if !crossed {
+		return nil, fmt.Errorf("bad revision %s does not cross the threshold, %s refresh time went from %s to %s",
+			bcfg.Bad, bcfg.ResourceType, result.Baseline.Round(time.Millisecond), result.Measurements[1].TotalTime.Round(time.Millisecond))
+	}
+	// The last revision is bad, so only the ones before it need testing.
+	first, err := bisect(len(revs)-1, func(i, remaining int) (bool, error) {
+		fmt.Printf("Bisecting: %d revisions left to test after this (roughly %d steps)\n", remaining, bisectSteps(remaining))
+		return isBad(revs[i])
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.FirstBad = revs[first]
+	result.Commit, err = git("show", "--stat", "--format=medium", result.FirstBad)
+	if err != nil {
+		logger.Warn("could not describe first bad commit", zap.Error(err))
+	}
+	return result, nil
+}
+
+// bisect returns the index of the first bad element of a sequence of n
+// elements followed by a known bad one, so the result is n when every element
+// is good. isBad is called with the index to test and the number of elements
+// left to test after it.
+func bisect(n int, isBad func(i, remaining int) (bool, error)) (int, error) {
+	lo, hi := 0, n
+	for lo < hi {
+		mid := (lo + hi) / 2
+		bad, err := isBad(mid, (hi-lo)/2)
+		if err != nil {
+			return 0, err
+		}
+		if bad {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return lo, nil
+}
+
+// bisectSteps is the number of steps needed to bisect n revisions.
+func bisectSteps(n int) int {
+	if n < 1 {
+		return 0
+	}
+	return int(math.Ceil(math.Log2(float64(n + 1))))
+}
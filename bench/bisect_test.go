@@ -0,0 +1,35 @@
+package bench
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBisect(t *testing.T) {
+	for n := 0; n <= 9; n++ {
+		for firstBad := 0; firstBad <= n; firstBad++ {
+			var tested []int
+			got, err := bisect(n, func(i, remaining int) (bool, error) {
+				require.True(t, i >= 0 && i < n, "tested index %d out of range", i)
+				tested = append(tested, i)
+				return i >= firstBad, nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, firstBad, got, "n=%d", n)
+			require.LessOrEqual(t, len(tested), bisectSteps(n))
+		}
+	}
+}
+
+func TestParseThreshold(t *testing.T) {
+	for s, want := range map[string]float64{"20%": 0.2, "0.2": 0.2, "150%": 1.5} {
+		got, err := ParseThreshold(s)
+		require.NoError(t, err)
+		require.InDelta(t, want, got, 1e-9, s)
+	}
+	for _, s := range []string{"", "abc%", "0%", "-5%"} {
+		_, err := ParseThreshold(s)
+		require.Error(t, err, s)
+	}
+}
@@ -0,0 +1,159 @@
+package bench
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"go.uber.org/zap"
+)
+
+// Comparison is a side by side view of refresh reports of the same workspace
+// taken under different conditions, for example different terraform versions.
+type Comparison struct {
+	Timestamp    time.Time        // Timestamp is the start of the first benchmark
+	Labels       []string         // Labels name the condition each report was taken under
+	Reports      []*RefreshReport // Reports in the same order as Labels
+	Notes        []string         // Notes describing the conditions, included in the header
+	BuildVersion string           // BuildVersion of tf-bench
+}
+
+func (c *Comparison) String() string {
+	t := table.NewWriter()
+	t.Style().Format.Header = text.FormatDefault
+	var groupBy GroupBy
+	if len(c.Reports) > 0 && c.Reports[0].Config.Method.perInstance() {
+		groupBy = c.Reports[0].Config.GroupBy
+	}
+	header := groupBy.header()
+	for _, label := range c.Labels {
+		header = append(header, label)
+	}
+	t.AppendHeader(header)
+
+	row := table.Row{"Whole Workspace"}
+	for i := 1; i < len(header)-len(c.Labels); i++ {
+		row = append(row, "")
+	}
+	for i, r := range c.Reports {
+		row = append(row, compareCell(r.TotalTime, c.Reports[0].TotalTime, i == 0))
+	}
+	t.AppendRow(row)
+	t.AppendSeparator()
+
+	// Rows follow the order of the first report, then any groups
+	// only found in later reports.
+	var groups []*ResourceReport
+	seen := map[string]bool{}
+	for _, r := range c.Reports {
+		for _, rr := range r.Resources {
+			if key := groupBy.key(rr); !seen[key] {
+				seen[key] = true
+				groups = append(groups, rr)
+			}
+		}
+	}
+	for _, group := range groups {
+		key := groupBy.key(group)
+		row := groupBy.row(group)
+		base := c.Reports[0].resource(groupBy, key)
+		for i, r := range c.Reports {
+			rr := r.resource(groupBy, key)
+			switch {
+			case rr == nil:
+				row = append(row, "-")
+			case base == nil:
+				row = append(row, rr.TotalTime.Round(time.Millisecond))
+			default:
+				row = append(row, compareCell(rr.TotalTime, base.TotalTime, i == 0))
+			}
+		}
+		t.AppendRow(row)
+	}
+
+	var versions strings.Builder
+	for i, r := range c.Reports {
+		if r.TerraformVersion != nil {
+			fmt.Fprintf(&versions, "%s: %s\n", c.Labels[i], r.TerraformVersion)
+		}
+	}
+	for _, note := range c.Notes {
+		versions.WriteString(note + "\n")
+	}
+	if len(c.Reports) > 0 && c.Reports[0].Host != nil {
+		versions.WriteString(c.Reports[0].Host.Info.String() + "\n")
+	}
+	for i, r := range c.Reports {
+		if i > 0 && r.Fingerprint != nil && c.Reports[0].Fingerprint != nil {
+			if diff := c.Reports[0].Fingerprint.ShapeDiff(r.Fingerprint); len(diff) > 0 {
+				fmt.Fprintf(&versions, "WARNING: %s is of a different workspace than %s, the %s differ\n", c.Labels[i], c.Labels[0], strings.Join(diff, ", "))
+			}
+		}
+		if r.Host != nil && r.Host.Noisy > 0 {
+			fmt.Fprintf(&versions, "WARNING: %s: %d of %d runs were on a busy host\n", c.Labels[i], r.Host.Noisy, r.Host.Iterations)
+		}
+	}
+	measured := "average refresh time per resource"
+	if len(c.Reports) > 0 && !c.Reports[0].Config.Method.perInstance() {
+		measured = "average refresh time of all resources of each type"
+	}
+	if c.BuildVersion == "" {
+		c.BuildVersion = "development-build"
+	}
+	return fmt.Sprintf(`tf-bench (%s) Refresh Comparison %s
+%s
+compared: %s
+%s
+`, c.BuildVersion, c.Timestamp.Format(time.RFC3339Nano), strings.TrimSpace(versions.String()), measured, t.Render())
+}
+
+// compareCell formats d, with its change relative to base unless it is the base itself.
+func compareCell(d, base time.Duration, isBase bool) string {
+	if isBase || base == 0 {
+		return d.Round(time.Millisecond).String()
+	}
+	change := float64(d-base) / float64(base) * 100
+	return fmt.Sprintf("%s (%+.1f%%)", d.Round(time.Millisecond), change)
+}
+
+// resource returns the ResourceReport of the group with the given key, or nil if there is none.
+func (r *RefreshReport) resource(groupBy GroupBy, key string) *ResourceReport {
+	for _, rr := range r.Resources {
+		if groupBy.key(rr) == key {
+			return rr
+		}
+	}
+	return nil
+}
+
+// MatrixBenchmark runs RefreshBenchmark on the current workspace once for
+// each of the given terraform versions, which must already be installed.
+func MatrixBenchmark(cfg *Config, versions []string, logger *zap.Logger) (*Comparison, error) {
+	var runners []*TerraformRunner
+	for _, v := range versions {
+		tfRunner, err := TerraformAtVersion(v)
+		if err != nil {
+			return nil, err
+		}
+		runners = append(runners, tfRunner)
+	}
+	comparison := &Comparison{Timestamp: time.Now()}
+	for i, tfRunner := range runners {
+		fmt.Printf("Benchmarking with terraform v%s\n", strings.TrimPrefix(versions[i], "v"))
+		// Each version may need to install providers or upgrade the
+		// working directory before it can refresh.
+		_, err := tfRunner.Run("init", "-input=false")
+		if err != nil {
+			return nil, fmt.Errorf("terraform v%s init: %w", versions[i], err)
+		}
+		report, err := RefreshBenchmark(cfg, tfRunner, logger)
+		if err != nil {
+			return nil, fmt.Errorf("benchmark with terraform v%s: %w", versions[i], err)
+		}
+		comparison.Labels = append(comparison.Labels, "terraform v"+strings.TrimPrefix(versions[i], "v"))
+		comparison.Reports = append(comparison.Reports, report)
+	}
+	return comparison, nil
+}
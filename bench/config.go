@@ -0,0 +1,76 @@
+package bench
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// DefaultConfigFile is the name of the config file tf-bench reads from the workspace.
+const DefaultConfigFile = "tf-bench.hcl"
+
+// FileConfig is the content of a tf-bench config file, for example
+//
+//	groups {
+//	  core-network = ["module.transit*.aviatrix_*", "aviatrix_vpc.*"]
+//	  gateways     = ["/aviatrix_(spoke|transit)_gateway\\..*/"]
+//	}
+type FileConfig struct {
+	Groups []*CustomGroup // Groups in the order they are declared
+}
+
+// LoadConfigFile reads the config file at path.
+func LoadConfigFile(path string) (*FileConfig, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config file: %w", err)
+	}
+	f, diags := hclsyntax.ParseConfig(src, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("parsing config file %s: %s", path, diags.Error())
+	}
+	cfg := &FileConfig{}
+	body := f.Body.(*hclsyntax.Body)
+	for name := range body.Attributes {
+		return nil, fmt.Errorf("unsupported argument %s in config file %s", name, path)
+	}
+	for _, block := range body.Blocks {
+		if block.Type != "groups" {
+			return nil, fmt.Errorf("unsupported block %s in config file %s", block.Type, path)
+		}
+		var attrs []*hclsyntax.Attribute
+		for _, attr := range block.Body.Attributes {
+			attrs = append(attrs, attr)
+		}
+		sort.Slice(attrs, func(i, j int) bool {
+			return attrs[i].SrcRange.Start.Byte < attrs[j].SrcRange.Start.Byte
+		})
+		for _, attr := range attrs {
+			val, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() {
+				return nil, fmt.Errorf("invalid group %s: %s", attr.Name, diags.Error())
+			}
+			if !val.Type().IsTupleType() && !val.Type().IsListType() {
+				return nil, fmt.Errorf("group %s must be a list of address patterns", attr.Name)
+			}
+			var patterns []string
+			for it := val.ElementIterator(); it.Next(); {
+				_, v := it.Element()
+				if v.IsNull() || v.Type() != cty.String {
+					return nil, fmt.Errorf("group %s must be a list of address patterns", attr.Name)
+				}
+				patterns = append(patterns, v.AsString())
+			}
+			g, err := NewCustomGroup(attr.Name, patterns)
+			if err != nil {
+				return nil, err
+			}
+			cfg.Groups = append(cfg.Groups, g)
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,44 @@
+package bench
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, DefaultConfigFile)
+	err := os.WriteFile(path, []byte(`
+groups {
+  gateways     = ["/aviatrix_(spoke|transit)_gateway\\..*/"]
+  core-network = ["module.transit*.aviatrix_*", "aviatrix_vpc.*"]
+}
+`), 0644)
+	require.NoError(t, err)
+	cfg, err := LoadConfigFile(path)
+	require.NoError(t, err)
+	require.Len(t, cfg.Groups, 2)
+	require.Equal(t, "gateways", cfg.Groups[0].Name)
+	require.Equal(t, []string{`/aviatrix_(spoke|transit)_gateway\..*/`}, cfg.Groups[0].Patterns)
+	require.True(t, cfg.Groups[0].matches("aviatrix_spoke_gateway.gw"))
+	require.Equal(t, "core-network", cfg.Groups[1].Name)
+	require.True(t, cfg.Groups[1].matches("module.transit_hub.aviatrix_vpc.transit"))
+	require.False(t, cfg.Groups[1].matches("module.spoke.aviatrix_vpc.a"))
+
+	for _, content := range []string{
+		`groups = {}`,
+		`groups {
+  bad = "aviatrix_vpc.*"
+}`,
+		`groups {
+  bad = ["/(/"]
+}`,
+	} {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		_, err := LoadConfigFile(path)
+		require.Error(t, err, content)
+	}
+}
@@ -0,0 +1,482 @@
+package bench
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	hcljson "github.com/hashicorp/hcl/v2/json"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// evaluator evaluates expressions of a module in process with the values
+// terraform would assign to its input variables, so provider configurations
+// can be made self-contained without running terraform console.
+type evaluator struct {
+	dir           string
+	module        string // module is the path of the child module evaluated, empty for the root module
+	keepVariables bool   // keepVariables is true when input variables are declared in generated configurations
+	variables     map[string]*inputVariable
+	locals        map[string]cty.Value
+	localErrs     map[string]error
+	ctx           *hcl.EvalContext
+}
+
+// inputVariable is a variable block and the value assigned to it.
+type inputVariable struct {
+	Name      string
+	Type      cty.Type
+	Value     cty.Value
+	Assigned  bool // Assigned is false when the variable has no default and no value was given
+	Defaulted bool // Defaulted is true when the value is the default of the variable block
+	Typed     bool // Typed is true when the variable block declares a type
+}
+
+// newEvaluator reads the variable and locals blocks of the module in dir and
+// assigns variable values the same way terraform does, from lowest to
+// highest precedence: defaults, TF_VAR_ environment variables,
+// terraform.tfvars, terraform.tfvars.json, *.auto.tfvars(.json) in lexical
+// order and finally varFile.
+func newEvaluator(dir, varFile string) (*evaluator, error) {
+	e := &evaluator{
+		dir:           dir,
+		keepVariables: true,
+	}
+	localExprs, err := e.readModule()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range e.variables {
+		if s, ok := os.LookupEnv("TF_VAR_" + v.Name); ok {
+			val, err := parseEnvVariable(v, s)
+			if err != nil {
+				return nil, err
+			}
+			v.Value = val
+			v.Assigned = true
+			v.Defaulted = false
+		}
+	}
+	varFiles := []string{
+		filepath.Join(dir, "terraform.tfvars"),
+		filepath.Join(dir, "terraform.tfvars.json"),
+	}
+	autoFiles, err := filepath.Glob(filepath.Join(dir, "*.auto.tfvars"))
+	if err != nil {
+		return nil, fmt.Errorf("could not list tfvars files: %w", err)
+	}
+	autoJSONFiles, err := filepath.Glob(filepath.Join(dir, "*.auto.tfvars.json"))
+	if err != nil {
+		return nil, fmt.Errorf("could not list tfvars files: %w", err)
+	}
+	autoFiles = append(autoFiles, autoJSONFiles...)
+	sort.Strings(autoFiles)
+	varFiles = append(varFiles, autoFiles...)
+	for _, name := range varFiles {
+		if _, err := os.Stat(name); err != nil {
+			continue
+		}
+		if err := e.readVarFile(name); err != nil {
+			return nil, err
+		}
+	}
+	if varFile != "" {
+		if err := e.readVarFile(varFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := e.init(localExprs); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// newModuleEvaluator is like newEvaluator for the child module called
+// as module in dir, with the input variable values given by the module call.
+// Variables that are not in inputs keep their defaults.
+func newModuleEvaluator(dir, module string, inputs map[string]cty.Value) (*evaluator, error) {
+	e := &evaluator{
+		dir:    dir,
+		module: module,
+	}
+	localExprs, err := e.readModule()
+	if err != nil {
+		return nil, err
+	}
+	for name, val := range inputs {
+		if v, ok := e.variables[name]; ok {
+			v.Value = val
+			v.Assigned = true
+			v.Defaulted = false
+		}
+	}
+	if err := e.init(localExprs); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// readModule reads the variable blocks of the module in e.dir and returns
+// the expressions of its local values.
+func (e *evaluator) readModule() (map[string]hcl.Expression, error) {
+	e.variables = map[string]*inputVariable{}
+	e.locals = map[string]cty.Value{}
+	e.localErrs = map[string]error{}
+	tfFiles, err := filepath.Glob(filepath.Join(e.dir, "*.tf"))
+	if err != nil {
+		return nil, fmt.Errorf("could not list tf files: %w", err)
+	}
+	localExprs := map[string]hcl.Expression{}
+	for _, name := range tfFiles {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("could not read tf file %s: %w", name, err)
+		}
+		f, diags := hclsyntax.ParseConfig(src, name, hcl.InitialPos)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("parsing tf file %s: %s", name, diags.Error())
+		}
+		for _, block := range f.Body.(*hclsyntax.Body).Blocks {
+			switch block.Type {
+			case "variable":
+				if len(block.Labels) != 1 {
+					continue
+				}
+				v, err := readVariableBlock(block)
+				if err != nil {
+					return nil, err
+				}
+				e.variables[v.Name] = v
+			case "locals":
+				for name, attr := range block.Body.Attributes {
+					localExprs[name] = attr.Expr
+				}
+			}
+		}
+	}
+	return localExprs, nil
+}
+
+// init converts the assigned variable values to their types and evaluates
+// the local values of the module.
+func (e *evaluator) init(localExprs map[string]hcl.Expression) error {
+	// Terraform runs in the root module, paths of child modules are relative to it.
+	dir, modulePath := e.dir, "."
+	if e.module != "" {
+		dir, modulePath = ".", e.dir
+	}
+	vars := map[string]cty.Value{}
+	for name, v := range e.variables {
+		if !v.Assigned {
+			// Only an error when an expression uses it.
+			continue
+		}
+		converted, err := convert.Convert(v.Value, v.Type)
+		if err != nil {
+			return fmt.Errorf("invalid value for variable %s: %w", name, err)
+		}
+		v.Value = converted
+		vars[name] = converted
+	}
+	cwd, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("could not resolve module directory: %w", err)
+	}
+	e.ctx = &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"var": cty.ObjectVal(vars),
+			"path": cty.ObjectVal(map[string]cty.Value{
+				"module": cty.StringVal(modulePath),
+				"root":   cty.StringVal("."),
+				"cwd":    cty.StringVal(cwd),
+			}),
+			"terraform": cty.ObjectVal(map[string]cty.Value{
+				"workspace": cty.StringVal(currentWorkspace(dir)),
+			}),
+		},
+		Functions: terraformFunctions(dir),
+	}
+	e.evaluateLocals(localExprs)
+	return nil
+}
+
+func readVariableBlock(block *hclsyntax.Block) (*inputVariable, error) {
+	v := &inputVariable{
+		Name: block.Labels[0],
+		Type: cty.DynamicPseudoType,
+	}
+	if attr, ok := block.Body.Attributes["type"]; ok {
+		ty, diags := typeexpr.TypeConstraint(attr.Expr)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("invalid type of variable %s: %s", v.Name, diags.Error())
+		}
+		v.Type = ty
+		v.Typed = true
+	}
+	if attr, ok := block.Body.Attributes["default"]; ok {
+		val, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("invalid default of variable %s: %s", v.Name, diags.Error())
+		}
+		v.Value = val
+		v.Assigned = true
+		v.Defaulted = true
+	}
+	return v, nil
+}
+
+// parseEnvVariable interprets the value of a TF_VAR_ environment variable.
+// Like terraform, values of variables with a complex type or an explicit
+// type of any are parsed as HCL expressions and everything else is a
+// literal string.
+func parseEnvVariable(v *inputVariable, s string) (cty.Value, error) {
+	if !v.parsesHCL() {
+		return cty.StringVal(s), nil
+	}
+	expr, diags := hclsyntax.ParseExpression([]byte(s), "TF_VAR_"+v.Name, hcl.InitialPos)
+	if diags.HasErrors() {
+		return cty.NilVal, fmt.Errorf("invalid value for environment variable TF_VAR_%s: %s", v.Name, diags.Error())
+	}
+	val, diags := expr.Value(nil)
+	if diags.HasErrors() {
+		return cty.NilVal, fmt.Errorf("invalid value for environment variable TF_VAR_%s: %s", v.Name, diags.Error())
+	}
+	return val, nil
+}
+
+// parsesHCL reports whether terraform parses TF_VAR_ values of v as HCL.
+func (v *inputVariable) parsesHCL() bool {
+	return v.Typed && !v.Type.IsPrimitiveType()
+}
+
+func (e *evaluator) readVarFile(name string) error {
+	src, err := os.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("could not read var file %s: %w", name, err)
+	}
+	var f *hcl.File
+	var diags hcl.Diagnostics
+	if strings.HasSuffix(name, ".json") {
+		f, diags = hcljson.Parse(src, name)
+	} else {
+		f, diags = hclsyntax.ParseConfig(src, name, hcl.InitialPos)
+	}
+	if diags.HasErrors() {
+		return fmt.Errorf("parsing var file %s: %s", name, diags.Error())
+	}
+	attrs, diags := f.Body.JustAttributes()
+	if diags.HasErrors() {
+		return fmt.Errorf("parsing var file %s: %s", name, diags.Error())
+	}
+	for attrName, attr := range attrs {
+		v, ok := e.variables[attrName]
+		if !ok {
+			// Terraform only warns about values for undeclared variables.
+			continue
+		}
+		val, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return fmt.Errorf("invalid value for variable %s in %s: %s", attrName, name, diags.Error())
+		}
+		v.Value = val
+		v.Assigned = true
+		v.Defaulted = false
+	}
+	return nil
+}
+
+// currentWorkspace returns the workspace terraform would select in dir.
+func currentWorkspace(dir string) string {
+	if ws := os.Getenv("TF_WORKSPACE"); ws != "" {
+		return ws
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, ".terraform", "environment")); err == nil {
+		if ws := strings.TrimSpace(string(b)); ws != "" {
+			return ws
+		}
+	}
+	return "default"
+}
+
+// evaluateLocals evaluates every local value that can be evaluated in
+// process. Locals are evaluated in dependency order by repeatedly evaluating
+// the ones whose references are all known.
+func (e *evaluator) evaluateLocals(exprs map[string]hcl.Expression) {
+	pending := map[string]hcl.Expression{}
+	for name, expr := range exprs {
+		pending[name] = expr
+	}
+	for progress := true; progress && len(pending) > 0; {
+		progress = false
+		for name, expr := range pending {
+			waiting := false
+			for _, traversal := range expr.Variables() {
+				if traversal.RootName() != "local" {
+					continue
+				}
+				if ref, ok := localName(traversal); ok {
+					if _, pending := pending[ref]; pending {
+						waiting = true
+					}
+				}
+			}
+			if waiting {
+				continue
+			}
+			delete(pending, name)
+			progress = true
+			val, err := e.evaluate(expr)
+			if err != nil {
+				e.localErrs[name] = err
+				continue
+			}
+			e.locals[name] = val
+			e.ctx.Variables["local"] = cty.ObjectVal(e.locals)
+		}
+	}
+	for name := range pending {
+		e.localErrs[name] = fmt.Errorf("local.%s has a dependency cycle", name)
+	}
+}
+
+func localName(traversal hcl.Traversal) (string, bool) {
+	if len(traversal) < 2 {
+		return "", false
+	}
+	attr, ok := traversal[1].(hcl.TraverseAttr)
+	if !ok {
+		return "", false
+	}
+	return attr.Name, true
+}
+
+// evaluate returns the value of expr, or an error explaining why it cannot
+// be known without refreshing or applying the workspace.
+func (e *evaluator) evaluate(expr hcl.Expression) (cty.Value, error) {
+	for _, traversal := range expr.Variables() {
+		if err := e.checkReference(traversal); err != nil {
+			return cty.NilVal, err
+		}
+	}
+	val, diags := expr.Value(e.ctx)
+	if diags.HasErrors() {
+		return cty.NilVal, fmt.Errorf("%s", diags.Error())
+	}
+	if !val.IsWhollyKnown() {
+		return cty.NilVal, fmt.Errorf("value is not known until apply")
+	}
+	return val, nil
+}
+
+// checkReference returns an error if the value traversal refers to cannot be evaluated in process.
+func (e *evaluator) checkReference(traversal hcl.Traversal) error {
+	root := traversal.RootName()
+	addr := referenceString(traversal)
+	switch root {
+	case "var":
+		name, ok := localName(traversal)
+		if !ok {
+			return fmt.Errorf("invalid reference %s", addr)
+		}
+		v, ok := e.variables[name]
+		if !ok {
+			return fmt.Errorf("reference to undeclared input variable %s", name)
+		}
+		if !v.Assigned && e.module != "" {
+			return fmt.Errorf("no value for variable %s of %s that can be evaluated from the module call", name, e.module)
+		}
+		if !v.Assigned {
+			return fmt.Errorf("no value for required variable %s, set it in a tfvars file, -var-file or TF_VAR_%s", name, name)
+		}
+	case "local":
+		name, ok := localName(traversal)
+		if !ok {
+			return fmt.Errorf("invalid reference %s", addr)
+		}
+		if err, ok := e.localErrs[name]; ok {
+			return fmt.Errorf("local.%s cannot be evaluated: %w", name, err)
+		}
+		if _, ok := e.locals[name]; !ok {
+			return fmt.Errorf("reference to undeclared local value %s", name)
+		}
+	case "path", "terraform":
+	case "data":
+		return fmt.Errorf("expression references data source %s, which is only known after refresh", addr)
+	case "module":
+		return fmt.Errorf("expression references module output %s, which is only known after refresh", addr)
+	case "count", "each", "self":
+		return fmt.Errorf("expression references %s, which is only valid inside a resource", addr)
+	default:
+		return fmt.Errorf("expression references resource %s, which is only known after refresh", addr)
+	}
+	return nil
+}
+
+// referenceString renders the address part of a traversal, for example "aws_instance.web".
+func referenceString(traversal hcl.Traversal) string {
+	parts := []string{traversal.RootName()}
+	n := 2
+	if parts[0] == "data" {
+		n = 3
+	}
+	for _, step := range traversal[1:] {
+		attr, ok := step.(hcl.TraverseAttr)
+		if !ok || len(parts) == n {
+			break
+		}
+		parts = append(parts, attr.Name)
+	}
+	return strings.Join(parts, ".")
+}
+
+// evaluateAttribute evaluates the expression of an attribute parsed with hclwrite.
+func (e *evaluator) evaluateAttribute(attr *hclwrite.Attribute) (cty.Value, error) {
+	expr, diags := hclsyntax.ParseExpression(attr.Expr().BuildTokens(nil).Bytes(), "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return cty.NilVal, fmt.Errorf("%s", diags.Error())
+	}
+	return e.evaluate(expr)
+}
+
+// resolveBody replaces every attribute of body, and of its nested blocks,
+// that references something with the value it evaluates to. When secrets is
+// not nil, references to input variables are kept and other values are
+// replaced with references to variables collected in secrets instead.
+func (e *evaluator) resolveBody(body *hclwrite.Body, secrets *secretVariables) error {
+	for name, attr := range body.Attributes() {
+		traversals := attr.Expr().Variables()
+		if len(traversals) == 0 {
+			continue
+		}
+		val, err := e.evaluateAttribute(attr)
+		if err != nil {
+			return fmt.Errorf("could not evaluate %s: %w", name, err)
+		}
+		if secrets != nil && e.keepVariables && onlyInputVariables(traversals) {
+			continue
+		}
+		if secrets != nil && !val.IsNull() {
+			body.SetAttributeTraversal(name, hcl.Traversal{
+				hcl.TraverseRoot{Name: "var"},
+				hcl.TraverseAttr{Name: secrets.add(val)},
+			})
+			continue
+		}
+		body.SetAttributeValue(name, val)
+	}
+	for _, block := range body.Blocks() {
+		if err := e.resolveBody(block.Body(), secrets); err != nil {
+			return fmt.Errorf("%s block: %w", block.Type(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package bench
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestEvaluator(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"variables.tf": `
+variable "region" {
+  default = "us-east-1"
+}
+variable "port" {
+  type    = number
+  default = 80
+}
+variable "insecure" {
+  type = bool
+}
+variable "zones" {
+  type = list(string)
+}
+variable "tags" {
+  type    = map(string)
+  default = {}
+}
+variable "password" {}
+variable "unset" {}
+`,
+		"main.tf": `
+locals {
+  endpoint = "https://${var.region}.example.com:${var.port}"
+  upper    = upper(local.endpoint)
+  vpc_id   = aws_vpc.main.id
+}
+`,
+		"terraform.tfvars":         `region = "us-west-1"`,
+		"a.auto.tfvars.json":       `{"region": "eu-west-1", "zones": ["a", "b"]}`,
+		"b.auto.tfvars":            `insecure = true`,
+		"secrets.tfvars":           `password = "from-var-file"`,
+		"ignored.auto.tfvars.json": `{"undeclared": 1}`,
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		require.NoError(t, err)
+	}
+	for k, v := range map[string]string{
+		"TF_VAR_region":   "from-env",
+		"TF_VAR_tags":     `{team = "network"}`,
+		"TF_VAR_password": "from-env",
+	} {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	ev, err := newEvaluator(dir, filepath.Join(dir, "secrets.tfvars"))
+	require.NoError(t, err)
+
+	tt := []struct {
+		expr string
+		want cty.Value
+		err  string
+	}{
+		{expr: `var.region`, want: cty.StringVal("eu-west-1")},
+		{expr: `var.port`, want: cty.NumberIntVal(80)},
+		{expr: `var.insecure`, want: cty.True},
+		{expr: `var.zones`, want: cty.ListVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")})},
+		{expr: `var.tags["team"]`, want: cty.StringVal("network")},
+		{expr: `var.password`, want: cty.StringVal("from-var-file")},
+		{expr: `local.upper`, want: cty.StringVal("HTTPS://EU-WEST-1.EXAMPLE.COM:80")},
+		{expr: `join(",", var.zones)`, want: cty.StringVal("a,b")},
+		{expr: `terraform.workspace`, want: cty.StringVal("default")},
+		{expr: `var.unset`, err: "no value for required variable unset"},
+		{expr: `var.missing`, err: "undeclared input variable missing"},
+		{expr: `aws_vpc.main.id`, err: "references resource aws_vpc.main"},
+		{expr: `data.aws_ssm_parameter.foo.value`, err: "references data source data.aws_ssm_parameter.foo"},
+		{expr: `local.vpc_id`, err: "references resource aws_vpc.main"},
+	}
+	for _, tc := range tt {
+		f, diags := hclwrite.ParseConfig([]byte("v = "+tc.expr+"\n"), "test.tf", hcl.InitialPos)
+		require.False(t, diags.HasErrors(), tc.expr)
+		got, err := ev.evaluateAttribute(f.Body().GetAttribute("v"))
+		if tc.err != "" {
+			require.Error(t, err, tc.expr)
+			require.Contains(t, err.Error(), tc.err)
+			continue
+		}
+		require.NoError(t, err, tc.expr)
+		require.True(t, tc.want.RawEquals(got), "%s: expected %#v got %#v", tc.expr, tc.want, got)
+	}
+
+	// Nested blocks are resolved and literal values are preserved as they are.
+	f, diags := hclwrite.ParseConfig([]byte(`
+provider "aws" {
+  region   = var.region
+  insecure = var.insecure
+  assume_role {
+    role_arn = "arn:aws:iam::123456789012:role/${var.zones[0]}"
+  }
+}
+`), "provider.tf", hcl.InitialPos)
+	require.False(t, diags.HasErrors())
+	block := f.Body().Blocks()[0]
+	require.NoError(t, ev.resolveBody(block.Body(), nil))
+	out := string(f.Bytes())
+	require.Contains(t, out, `region   = "eu-west-1"`)
+	require.Contains(t, out, `insecure = true`)
+	require.Contains(t, out, `role_arn = "arn:aws:iam::123456789012:role/a"`)
+}
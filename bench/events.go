@@ -0,0 +1,142 @@
+package bench
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// tfEvent is a line of the machine readable UI output of terraform.
+type tfEvent struct {
+	Type      string
+	Timestamp time.Time `json:"@timestamp"`
+	Hook      struct {
+		Action   string
+		Resource struct {
+			Addr         string
+			Module       string
+			ResourceType string `json:"resource_type"`
+		}
+	}
+	Diagnostic struct {
+		Severity string
+		Summary  string
+		Address  string // Address of the resource the diagnostic is about, if any
+	}
+}
+
+// isDataSourceRead reports whether the event is part of reading a data
+// source. Terraform reports reads with the apply hooks during plan.
+func (e *tfEvent) isDataSourceRead() bool {
+	return (e.Type == "apply_start" || e.Type == "apply_complete") && e.Hook.Action == "read"
+}
+
+// dataSourceAddr makes sure the address of a data source is prefixed with data.
+func dataSourceAddr(addr string) string {
+	if strings.HasPrefix(addr, "data.") || strings.Contains(addr, ".data.") {
+		return addr
+	}
+	module := ""
+	if i := strings.LastIndex(addr, "module."); i != -1 {
+		if j := strings.Index(addr[i+len("module."):], "."); j != -1 {
+			module = addr[:i+len("module.")+j+1]
+		}
+	}
+	return module + "data." + strings.TrimPrefix(addr, module)
+}
+
+// readRefreshEvents reads the event log of a refresh and returns the refresh
+// time of every resource, and with dataSources the read time of every data
+// source. completed is called whenever a resource has been refreshed. It also
+// returns the refreshes that failed, timed until their error, which are left
+// out of the refresh times.
+func readRefreshEvents(r io.Reader, iteration int, dataSources bool, completed func(), logger *zap.Logger) (samples, failed []refreshSample) {
+	starts := map[string]tfEvent{}
+	ends := map[string]tfEvent{}
+	errored := map[string]tfEvent{}
+	diagnostics := map[string]tfEvent{}
+	var order []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var event tfEvent
+		err := json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil {
+			logger.Debug("could not decode JSON object from Terraform event log",
+				zap.String("line", scanner.Text()),
+				zap.Error(err))
+			continue
+		}
+		addr := event.Hook.Resource.Addr
+		switch {
+		case event.Type == "diagnostic" && event.Diagnostic.Severity == "error" && event.Diagnostic.Address != "":
+			if _, ok := diagnostics[event.Diagnostic.Address]; !ok {
+				diagnostics[event.Diagnostic.Address] = event
+			}
+			continue
+		case dataSources && event.Type == "apply_errored" && event.Hook.Action == "read":
+			errored[dataSourceAddr(addr)] = event
+			continue
+		case event.Type == "refresh_start":
+		case event.Type == "refresh_complete":
+		case dataSources && event.isDataSourceRead():
+			addr = dataSourceAddr(addr)
+			event.Hook.Resource.Addr = addr
+		default:
+			continue
+		}
+		if strings.HasSuffix(event.Type, "_start") {
+			if _, ok := starts[addr]; !ok {
+				order = append(order, addr)
+			}
+			starts[addr] = event
+			continue
+		}
+		ends[addr] = event
+		if completed != nil {
+			completed()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		logger.Warn("could not read Terraform event log", zap.Error(err))
+	}
+	for _, addr := range order {
+		start := starts[addr]
+		mode := "managed"
+		if start.isDataSourceRead() {
+			mode = "data"
+		}
+		s := refreshSample{
+			Addr:      addr,
+			Type:      start.Hook.Resource.ResourceType,
+			Module:    start.Hook.Resource.Module,
+			Mode:      mode,
+			Iteration: iteration,
+			Start:     start.Timestamp,
+		}
+		diagnostic, hasDiagnostic := diagnostics[addr]
+		if hasDiagnostic {
+			s.Error = diagnostic.Diagnostic.Summary
+		}
+		if end, ok := ends[addr]; ok {
+			s.Duration = end.Timestamp.Sub(start.Timestamp)
+			samples = append(samples, s)
+			continue
+		}
+		end, ok := errored[addr]
+		if !ok && hasDiagnostic {
+			end, ok = diagnostic, true
+		}
+		if ok {
+			if s.Error == "" {
+				s.Error = "read failed"
+			}
+			s.Duration = end.Timestamp.Sub(start.Timestamp)
+			failed = append(failed, s)
+		}
+	}
+	return samples, failed
+}
@@ -0,0 +1,74 @@
+package bench
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+const testEventLog = `{"@level":"info","@message":"Terraform 1.0.0","type":"version","terraform":"1.0.0","ui":"0.1.0"}
+{"@level":"info","@message":"aviatrix_vpc.a: Refreshing state...","@timestamp":"2021-06-01T10:00:00.000000-07:00","hook":{"resource":{"addr":"aviatrix_vpc.a","module":"","resource_type":"aviatrix_vpc"}},"type":"refresh_start"}
+{"@level":"info","@message":"data.aviatrix_account.acc: Reading...","@timestamp":"2021-06-01T10:00:00.500000-07:00","hook":{"resource":{"addr":"data.aviatrix_account.acc","module":"","resource_type":"aviatrix_account"},"action":"read"},"type":"apply_start"}
+{"@level":"info","@message":"module.spoke[0].data.aviatrix_account.acc: Reading...","@timestamp":"2021-06-01T10:00:01.000000-07:00","hook":{"resource":{"addr":"module.spoke[0].aviatrix_account.acc","module":"module.spoke[0]","resource_type":"aviatrix_account"},"action":"read"},"type":"apply_start"}
+{"@level":"info","@message":"aviatrix_vpc.a: Refresh complete","@timestamp":"2021-06-01T10:00:02.000000-07:00","hook":{"resource":{"addr":"aviatrix_vpc.a","module":"","resource_type":"aviatrix_vpc"}},"type":"refresh_complete"}
+not json
+{"@level":"info","@message":"data.aviatrix_account.acc: Read complete","@timestamp":"2021-06-01T10:00:04.500000-07:00","hook":{"resource":{"addr":"data.aviatrix_account.acc","module":"","resource_type":"aviatrix_account"},"action":"read"},"type":"apply_complete"}
+{"@level":"info","@message":"module.spoke[0].data.aviatrix_account.acc: Read complete","@timestamp":"2021-06-01T10:00:04.000000-07:00","hook":{"resource":{"addr":"module.spoke[0].aviatrix_account.acc","module":"module.spoke[0]","resource_type":"aviatrix_account"},"action":"read"},"type":"apply_complete"}
+{"@level":"info","@message":"aws_vpc.b: Creating...","@timestamp":"2021-06-01T10:00:05.000000-07:00","hook":{"resource":{"addr":"aws_vpc.b","module":"","resource_type":"aws_vpc"},"action":"create"},"type":"apply_start"}
+`
+
+func TestReadRefreshEvents(t *testing.T) {
+	var completed int
+	samples, failed := readRefreshEvents(strings.NewReader(testEventLog), 1, true, func() { completed++ }, zap.NewNop())
+	require.Equal(t, 3, completed)
+	require.Empty(t, failed)
+	start, err := time.Parse(time.RFC3339, "2021-06-01T10:00:00-07:00")
+	require.NoError(t, err)
+	for i := range samples {
+		require.True(t, samples[i].Start.After(start) || samples[i].Start.Equal(start))
+		samples[i].Start = time.Time{}
+	}
+	require.Equal(t, []refreshSample{
+		{Addr: "aviatrix_vpc.a", Type: "aviatrix_vpc", Mode: "managed", Iteration: 1, Duration: 2 * time.Second},
+		{Addr: "data.aviatrix_account.acc", Type: "aviatrix_account", Mode: "data", Iteration: 1, Duration: 4 * time.Second},
+		{Addr: "module.spoke[0].data.aviatrix_account.acc", Type: "aviatrix_account", Module: "module.spoke[0]", Mode: "data", Iteration: 1, Duration: 3 * time.Second},
+	}, samples)
+
+	reports := groupSamples(samples, GroupByType, nil, 1)
+	require.Len(t, reports, 2)
+	require.Equal(t, "data.aviatrix_account", reports[0].Name)
+	require.Equal(t, 2, reports[0].Count)
+	require.Equal(t, "aviatrix_vpc", reports[1].Name)
+
+	completed = 0
+	samples, _ = readRefreshEvents(strings.NewReader(testEventLog), 0, false, func() { completed++ }, zap.NewNop())
+	require.Equal(t, 1, completed)
+	require.Len(t, samples, 1)
+	require.Equal(t, "aviatrix_vpc.a", samples[0].Addr)
+}
+
+const testErrorEventLog = `{"@level":"info","@message":"aviatrix_vpc.a: Refreshing state...","@timestamp":"2021-06-01T10:00:00.000000-07:00","hook":{"resource":{"addr":"aviatrix_vpc.a","module":"","resource_type":"aviatrix_vpc"}},"type":"refresh_start"}
+{"@level":"info","@message":"aviatrix_vpc.b: Refreshing state...","@timestamp":"2021-06-01T10:00:00.000000-07:00","hook":{"resource":{"addr":"aviatrix_vpc.b","module":"","resource_type":"aviatrix_vpc"}},"type":"refresh_start"}
+{"@level":"info","@message":"data.aviatrix_account.acc: Reading...","@timestamp":"2021-06-01T10:00:00.000000-07:00","hook":{"resource":{"addr":"data.aviatrix_account.acc","module":"","resource_type":"aviatrix_account"},"action":"read"},"type":"apply_start"}
+{"@level":"info","@message":"aviatrix_vpc.a: Refresh complete","@timestamp":"2021-06-01T10:00:01.000000-07:00","hook":{"resource":{"addr":"aviatrix_vpc.a","module":"","resource_type":"aviatrix_vpc"}},"type":"refresh_complete"}
+{"@level":"error","@message":"data.aviatrix_account.acc: Read errored after 2s","@timestamp":"2021-06-01T10:00:02.000000-07:00","hook":{"resource":{"addr":"data.aviatrix_account.acc","module":"","resource_type":"aviatrix_account"},"action":"read"},"type":"apply_errored"}
+{"@level":"error","@message":"Error: rate limited","@timestamp":"2021-06-01T10:00:03.000000-07:00","diagnostic":{"severity":"error","summary":"rate limited","address":"aviatrix_vpc.b"},"type":"diagnostic"}
+{"@level":"error","@message":"Error: account not found","@timestamp":"2021-06-01T10:00:04.000000-07:00","diagnostic":{"severity":"error","summary":"account not found","address":"data.aviatrix_account.acc"},"type":"diagnostic"}
+`
+
+func TestReadRefreshEventsErrors(t *testing.T) {
+	samples, failed := readRefreshEvents(strings.NewReader(testErrorEventLog), 0, true, nil, zap.NewNop())
+	require.Len(t, samples, 1)
+	require.Equal(t, "aviatrix_vpc.a", samples[0].Addr)
+	require.Empty(t, samples[0].Error)
+	require.Len(t, failed, 2)
+	require.Equal(t, "aviatrix_vpc.b", failed[0].Addr)
+	require.Equal(t, "rate limited", failed[0].Error)
+	require.Equal(t, 3*time.Second, failed[0].Duration)
+	require.Equal(t, "data.aviatrix_account.acc", failed[1].Addr)
+	require.Equal(t, "account not found", failed[1].Error)
+	require.Equal(t, 2*time.Second, failed[1].Duration)
+}
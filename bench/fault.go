@@ -0,0 +1,42 @@
+package bench
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/CyrusJavan/tf-bench/internal/proxy"
+	"go.uber.org/zap"
+)
+
+// FaultInjectionBenchmark runs RefreshBenchmark once through the API proxy
+// as it is, and once with the faults injected into the API calls, to show
+// how the refresh time of every resource type responds to a slow or
+// unreliable API.
+func FaultInjectionBenchmark(cfg *Config, tfRunner *TerraformRunner, faults []*proxy.Fault, logger *zap.Logger) (*Comparison, error) {
+	if len(faults) == 0 {
+		return nil, fmt.Errorf("there are no faults to inject")
+	}
+	comparison := &Comparison{Timestamp: time.Now()}
+	// Both runs go through the proxy, so its own overhead is not
+	// mistaken for the effect of the faults.
+	baselineCfg := *cfg
+	baselineCfg.Faults = []*proxy.Fault{}
+	fmt.Println("Benchmarking without injected faults")
+	baseline, err := RefreshBenchmark(&baselineCfg, tfRunner, logger)
+	if err != nil {
+		return nil, fmt.Errorf("benchmark without injected faults: %w", err)
+	}
+	injectedCfg := *cfg
+	injectedCfg.Faults = faults
+	fmt.Println("Benchmarking with injected faults")
+	injected, err := RefreshBenchmark(&injectedCfg, tfRunner, logger)
+	if err != nil {
+		return nil, fmt.Errorf("benchmark with injected faults: %w", err)
+	}
+	for _, f := range faults {
+		comparison.Notes = append(comparison.Notes, "injected fault: "+f.String())
+	}
+	comparison.Labels = []string{"baseline", "injected faults"}
+	comparison.Reports = []*RefreshReport{baseline, injected}
+	return comparison, nil
+}
@@ -0,0 +1,166 @@
+package bench
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// fingerprintLength is the number of hex digits of the hashes in a fingerprint.
+const fingerprintLength = 16
+
+// lockFileName is the dependency lock file of a workspace.
+const lockFileName = ".terraform.lock.hcl"
+
+// Fingerprint identifies the shape of the workspace a report was taken of.
+// Every field is a hash, so no configuration or variable values are stored.
+type Fingerprint struct {
+	Configuration string // Configuration is the hash of the *.tf and *.tf.json files, including local modules
+	LockFile      string // LockFile is the hash of .terraform.lock.hcl, empty when there is none. Like Versions it changes with provider upgrades
+	Variables     string // Variables is the hash of the var-file and the variable files terraform loads itself
+	Resources     string // Resources is the hash of the resource instance addresses in state
+	Instances     int    // Instances is the number of resource instances in state
+	Versions      string // Versions is the hash of the terraform and provider versions
+}
+
+// workspaceFingerprint computes the fingerprint of the workspace in the
+// current directory with the given state and versions.
+func workspaceFingerprint(varFile string, tfstate *TerraformState, tv *TerraformVersion) (*Fingerprint, error) {
+	var configFiles []string
+	err := filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// Skip .terraform with the installed modules and providers, and .git.
+		if info.IsDir() && path != "." && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && (strings.HasSuffix(path, ".tf") || strings.HasSuffix(path, ".tf.json")) {
+			configFiles = append(configFiles, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not list configuration files: %w", err)
+	}
+	f := &Fingerprint{}
+	f.Configuration, err = hashFiles(configFiles)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(lockFileName); err == nil {
+		f.LockFile, err = hashFiles([]string{lockFileName})
+		if err != nil {
+			return nil, err
+		}
+	}
+	variableFiles, err := filepath.Glob("*.auto.tfvars")
+	if err != nil {
+		return nil, err
+	}
+	jsonVariableFiles, err := filepath.Glob("*.auto.tfvars.json")
+	if err != nil {
+		return nil, err
+	}
+	variableFiles = append(variableFiles, jsonVariableFiles...)
+	for _, name := range []string{"terraform.tfvars", "terraform.tfvars.json"} {
+		if _, err := os.Stat(name); err == nil {
+			variableFiles = append(variableFiles, name)
+		}
+	}
+	if varFile != "" {
+		variableFiles = append(variableFiles, varFile)
+	}
+	f.Variables, err = hashFiles(variableFiles)
+	if err != nil {
+		return nil, err
+	}
+	var addrs []string
+	for _, r := range tfstate.Resources {
+		for _, instance := range r.Instances {
+			addrs = append(addrs, r.InstanceAddr(instance.IndexKey))
+		}
+	}
+	sort.Strings(addrs)
+	f.Instances = len(addrs)
+	f.Resources = hashStrings(addrs)
+	var versions []string
+	if tv != nil {
+		versions = append(versions, string(tv.Engine)+" "+tv.TerraformVersion)
+		for provider, v := range tv.ProviderSelections {
+			versions = append(versions, provider+" "+v)
+		}
+	}
+	sort.Strings(versions)
+	f.Versions = hashStrings(versions)
+	return f, nil
+}
+
+// hashFiles hashes the names and contents of files in sorted order.
+func hashFiles(files []string) (string, error) {
+	files = append([]string{}, files...)
+	sort.Strings(files)
+	h := sha256.New()
+	for _, name := range files {
+		fmt.Fprintf(h, "%s\x00", filepath.ToSlash(name))
+		file, err := os.Open(name)
+		if err != nil {
+			return "", fmt.Errorf("could not read %s for the workspace fingerprint: %w", name, err)
+		}
+		_, err = io.Copy(h, file)
+		_ = file.Close()
+		if err != nil {
+			return "", fmt.Errorf("could not read %s for the workspace fingerprint: %w", name, err)
+		}
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))[:fingerprintLength], nil
+}
+
+// hashStrings hashes a list of strings.
+func hashStrings(ss []string) string {
+	h := sha256.New()
+	for _, s := range ss {
+		fmt.Fprintf(h, "%s\x00", s)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))[:fingerprintLength]
+}
+
+// Hash is the hash of the whole fingerprint.
+func (f *Fingerprint) Hash() string {
+	return hashStrings([]string{f.Configuration, f.LockFile, f.Variables, f.Resources, f.Versions})
+}
+
+// ShapeDiff returns the parts of the workspace shape that differ between two
+// fingerprints: the configuration, variables and resources. The versions and
+// the lock file are left out, since comparing versions is often the point.
+func (f *Fingerprint) ShapeDiff(other *Fingerprint) []string {
+	var diff []string
+	if f.Configuration != other.Configuration {
+		diff = append(diff, "configuration")
+	}
+	if f.Variables != other.Variables {
+		diff = append(diff, "variables")
+	}
+	if f.Resources != other.Resources {
+		diff = append(diff, fmt.Sprintf("resources (%d vs %d instances)", f.Instances, other.Instances))
+	}
+	return diff
+}
+
+func (f *Fingerprint) String() string {
+	return fmt.Sprintf("workspace fingerprint: %s (configuration %s, lock file %s, variables %s, %d resource instances %s, versions %s)",
+		f.Hash(), f.Configuration, orNone(f.LockFile), f.Variables, f.Instances, f.Resources, f.Versions)
+}
+
+// orNone returns s, or none when it is empty.
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
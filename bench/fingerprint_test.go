@@ -0,0 +1,74 @@
+package bench
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkspaceFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	pwd, err := os.Getwd()
+	require.NoError(t, err)
+	defer os.Chdir(pwd)
+	require.NoError(t, os.Chdir(dir))
+
+	write := func(name, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(name), 0700))
+		require.NoError(t, os.WriteFile(name, []byte(content), 0600))
+	}
+	write("main.tf", `resource "aviatrix_vpc" "a" {}`)
+	write("modules/network/main.tf", `resource "aviatrix_vpc" "b" {}`)
+	write(".terraform/modules/remote/main.tf", `resource "aviatrix_vpc" "c" {}`)
+	write("prod.tfvars", `name = "prod"`)
+	state := &TerraformState{Resources: []*StateResource{
+		{Type: "aviatrix_vpc", Name: "a", Mode: "managed", Instances: []StateInstance{{IndexKey: 0.0}, {IndexKey: 1.0}}},
+	}}
+	tv := &TerraformVersion{Engine: EngineTerraform, TerraformVersion: "1.5.7",
+		ProviderSelections: map[string]string{"registry.terraform.io/aviatrixsystems/aviatrix": "3.1.0"}}
+
+	f, err := workspaceFingerprint("prod.tfvars", state, tv)
+	require.NoError(t, err)
+	require.Equal(t, 2, f.Instances)
+	require.Equal(t, "", f.LockFile)
+	require.Len(t, f.Hash(), fingerprintLength)
+	same, err := workspaceFingerprint("prod.tfvars", state, tv)
+	require.NoError(t, err)
+	require.Equal(t, f, same)
+
+	// Installed modules and other terraform versions do not change the shape.
+	write(".terraform/modules/remote/main.tf", `resource "aviatrix_vpc" "d" {}`)
+	other, err := workspaceFingerprint("prod.tfvars", state, &TerraformVersion{TerraformVersion: "1.6.0"})
+	require.NoError(t, err)
+	require.Empty(t, f.ShapeDiff(other))
+	require.NotEqual(t, f.Hash(), other.Hash())
+
+	// Neither does a provider upgrade, which rewrites the lock file.
+	write(lockFileName, `provider "registry.terraform.io/aviatrixsystems/aviatrix" { version = "3.2.0" }`)
+	other, err = workspaceFingerprint("prod.tfvars", state, tv)
+	require.NoError(t, err)
+	require.Empty(t, f.ShapeDiff(other))
+	require.Equal(t, f.Shape(), other.Shape())
+	require.NotEqual(t, f.Hash(), other.Hash())
+
+	write("modules/network/main.tf", `resource "aviatrix_vpc" "e" {}`)
+	write(lockFileName, `provider "registry.terraform.io/aviatrixsystems/aviatrix" {}`)
+	write("prod.tfvars", `name = "staging"`)
+	state.Resources = append(state.Resources, &StateResource{Type: "aviatrix_vpc", Name: "b", Mode: "managed", Instances: make([]StateInstance, 1)})
+	other, err = workspaceFingerprint("prod.tfvars", state, tv)
+	require.NoError(t, err)
+	require.Equal(t, []string{"configuration", "variables", "resources (2 vs 3 instances)"}, f.ShapeDiff(other))
+
+	comparison := &Comparison{
+		Timestamp: time.Now(),
+		Labels:    []string{"before", "after"},
+		Reports: []*RefreshReport{
+			{Config: &Config{}, Fingerprint: f},
+			{Config: &Config{}, Fingerprint: other},
+		},
+	}
+	require.Contains(t, comparison.String(), "WARNING: after is of a different workspace than before, the configuration, variables, resources (2 vs 3 instances) differ")
+}
@@ -0,0 +1,128 @@
+package bench
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"go.uber.org/zap"
+)
+
+// GenerateConfig describes a synthetic workspace with many instances of one resource type.
+type GenerateConfig struct {
+	ResourceType string // ResourceType to generate, optional with a Template
+	Count        int    // Count is the number of resources to generate
+	Template     string // Template is a file with a resource block, ${index} is replaced with the index of every resource
+	Out          string // Out is the directory to write the workspace to
+}
+
+// indexPlaceholder is replaced with the index of every generated resource.
+const indexPlaceholder = "${index}"
+
+// builtinTemplates are resource blocks of types that need no real
+// infrastructure, used when there is no template.
+var builtinTemplates = map[string]string{
+	"random_id":      "byte_length = 8\n",
+	"random_pet":     "prefix = \"tf-bench-${index}\"\n",
+	"random_string":  "length = 16\n",
+	"random_integer": "min = 0\nmax = ${index}\n",
+	"null_resource":  "",
+	"time_static":    "",
+}
+
+// templateBlock returns the source of the resource block to generate.
+func (gcfg *GenerateConfig) templateBlock() (string, error) {
+	if gcfg.Template != "" {
+		src, err := os.ReadFile(gcfg.Template)
+		if err != nil {
+			return "", fmt.Errorf("could not read template: %w", err)
+		}
+		return string(src), nil
+	}
+	body, ok := builtinTemplates[gcfg.ResourceType]
+	if !ok {
+		return "", fmt.Errorf("there is no built-in template for %s, pass a template file with a resource block", gcfg.ResourceType)
+	}
+	return fmt.Sprintf("resource %q \"generated\" {\n%s}\n", gcfg.ResourceType, body), nil
+}
+
+// GenerateWorkspace writes the configuration of gcfg.Count resources to
+// gcfg.Out. Every resource is a copy of the template block named after its
+// index, so the same config always generates the same workspace.
+func GenerateWorkspace(gcfg *GenerateConfig) error {
+	if gcfg.Count <= 0 {
+		return fmt.Errorf("count must be greater than zero")
+	}
+	template, err := gcfg.templateBlock()
+	if err != nil {
+		return err
+	}
+	if existing, _ := filepath.Glob(filepath.Join(gcfg.Out, "*.tf")); len(existing) > 0 {
+		return fmt.Errorf("%s already contains terraform configuration", gcfg.Out)
+	}
+	f := hclwrite.NewEmptyFile()
+	for i := 0; i < gcfg.Count; i++ {
+		src := strings.ReplaceAll(template, indexPlaceholder, strconv.Itoa(i))
+		tf, diags := hclwrite.ParseConfig([]byte(src), gcfg.Template, hcl.InitialPos)
+		if diags.HasErrors() {
+			return fmt.Errorf("parsing template: %s", diags.Error())
+		}
+		blocks := tf.Body().Blocks()
+		if len(blocks) != 1 || blocks[0].Type() != "resource" || len(blocks[0].Labels()) != 2 {
+			return fmt.Errorf("template must contain exactly one resource block")
+		}
+		block := blocks[0]
+		labels := block.Labels()
+		if gcfg.ResourceType != "" && labels[0] != gcfg.ResourceType {
+			return fmt.Errorf("template is a %s resource, not %s", labels[0], gcfg.ResourceType)
+		}
+		block.SetLabels([]string{labels[0], fmt.Sprintf("%s_%d", labels[1], i)})
+		if i > 0 {
+			f.Body().AppendNewline()
+		}
+		f.Body().AppendBlock(block)
+	}
+	err = os.MkdirAll(gcfg.Out, 0755)
+	if err != nil {
+		return fmt.Errorf("could not create workspace dir: %w", err)
+	}
+	err = os.WriteFile(filepath.Join(gcfg.Out, "main.tf"), hclwrite.Format(f.Bytes()), 0644)
+	if err != nil {
+		return fmt.Errorf("could not write generated configuration: %w", err)
+	}
+	return nil
+}
+
+// GenerateBenchmark generates the workspace of gcfg, creates its resources
+// with terraform apply and runs RefreshBenchmark on it.
+func GenerateBenchmark(cfg *Config, gcfg *GenerateConfig, tfRunner *TerraformRunner, logger *zap.Logger) (*RefreshReport, error) {
+	err := GenerateWorkspace(gcfg)
+	if err != nil {
+		return nil, err
+	}
+	pwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("could not get current working dir: %w", err)
+	}
+	err = os.Chdir(gcfg.Out)
+	if err != nil {
+		return nil, fmt.Errorf("could not change dir: %w", err)
+	}
+	defer func(dir string) {
+		_ = os.Chdir(dir)
+	}(pwd)
+	fmt.Printf("Generated %d resources in %s, running terraform init and apply\n", gcfg.Count, gcfg.Out)
+	_, err = tfRunner.Run("init", "-input=false")
+	if err != nil {
+		return nil, fmt.Errorf("terraform init: %w", err)
+	}
+	_, err = tfRunner.Run("apply", "-auto-approve", "-input=false", fmt.Sprintf("-parallelism=%d", defaultParallelism))
+	if err != nil {
+		return nil, fmt.Errorf("terraform apply: %w", err)
+	}
+	return RefreshBenchmark(cfg, tfRunner, logger)
+}
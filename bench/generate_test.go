@@ -0,0 +1,63 @@
+package bench
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateWorkspace(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "ws")
+	err := GenerateWorkspace(&GenerateConfig{ResourceType: "random_id", Count: 3, Out: out})
+	require.NoError(t, err)
+	src, err := os.ReadFile(filepath.Join(out, "main.tf"))
+	require.NoError(t, err)
+	f, diags := hclsyntax.ParseConfig(src, "main.tf", hcl.InitialPos)
+	require.False(t, diags.HasErrors(), diags.Error())
+	blocks := f.Body.(*hclsyntax.Body).Blocks
+	require.Len(t, blocks, 3)
+	for i, name := range []string{"generated_0", "generated_1", "generated_2"} {
+		require.Equal(t, []string{"random_id", name}, blocks[i].Labels)
+	}
+
+	// The same config generates the same workspace, but never over an existing one.
+	err = GenerateWorkspace(&GenerateConfig{ResourceType: "random_id", Count: 3, Out: out})
+	require.Error(t, err)
+	again := filepath.Join(t.TempDir(), "ws")
+	require.NoError(t, GenerateWorkspace(&GenerateConfig{ResourceType: "random_id", Count: 3, Out: again}))
+	againSrc, err := os.ReadFile(filepath.Join(again, "main.tf"))
+	require.NoError(t, err)
+	require.Equal(t, string(src), string(againSrc))
+
+	err = GenerateWorkspace(&GenerateConfig{ResourceType: "aviatrix_vpc", Count: 3, Out: t.TempDir()})
+	require.Error(t, err)
+}
+
+func TestGenerateWorkspaceTemplate(t *testing.T) {
+	dir := t.TempDir()
+	template := filepath.Join(dir, "template.tf")
+	err := os.WriteFile(template, []byte(`resource "random_pet" "pet" {
+  prefix = "pet-${index}"
+  keepers = {
+    name = "${var.name}"
+  }
+}
+`), 0644)
+	require.NoError(t, err)
+	out := filepath.Join(dir, "ws")
+	err = GenerateWorkspace(&GenerateConfig{Count: 2, Template: template, Out: out})
+	require.NoError(t, err)
+	src, err := os.ReadFile(filepath.Join(out, "main.tf"))
+	require.NoError(t, err)
+	require.Contains(t, string(src), `resource "random_pet" "pet_1" {`)
+	require.Contains(t, string(src), `prefix = "pet-1"`)
+	require.Equal(t, 2, strings.Count(string(src), `"${var.name}"`))
+
+	err = GenerateWorkspace(&GenerateConfig{ResourceType: "random_id", Count: 2, Template: template, Out: t.TempDir()})
+	require.Error(t, err)
+}
@@ -0,0 +1,300 @@
+package bench
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/CyrusJavan/tf-bench/internal/util"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"gonum.org/v1/gonum/stat"
+)
+
+// GroupBy selects how event log measurements are aggregated in a report.
+type GroupBy string
+
+const (
+	GroupByType       GroupBy = "type"
+	GroupByModule     GroupBy = "module"
+	GroupByProvider   GroupBy = "provider"
+	GroupByModuleType GroupBy = "module+type"
+)
+
+// ParseGroupBy parses the value of the --group-by flag.
+func ParseGroupBy(s string) (GroupBy, error) {
+	switch g := GroupBy(s); g {
+	case GroupByType, GroupByModule, GroupByProvider, GroupByModuleType:
+		return g, nil
+	case "":
+		return GroupByType, nil
+	}
+	return "", fmt.Errorf("invalid group by %q, must be one of type, module, provider or module+type", s)
+}
+
+// orDefault returns g, or GroupByType when it is not set.
+func (g GroupBy) orDefault() GroupBy {
+	if g == "" {
+		return GroupByType
+	}
+	return g
+}
+
+// header returns the report columns that name a group.
+func (g GroupBy) header() table.Row {
+	switch g.orDefault() {
+	case GroupByModule:
+		return table.Row{"Module"}
+	case GroupByProvider:
+		return table.Row{"Provider"}
+	case GroupByModuleType:
+		return table.Row{"Module", "Resource Type"}
+	}
+	return table.Row{"Resource Type"}
+}
+
+// row returns the report columns that name the group rr measures.
+func (g GroupBy) row(rr *ResourceReport) table.Row {
+	switch g.orDefault() {
+	case GroupByModule:
+		return table.Row{moduleName(rr.Module)}
+	case GroupByProvider:
+		return table.Row{rr.Provider}
+	case GroupByModuleType:
+		return table.Row{moduleName(rr.Module), rr.Name}
+	}
+	return table.Row{rr.Name}
+}
+
+// key identifies the group rr measures, for matching groups across reports.
+func (g GroupBy) key(rr *ResourceReport) string {
+	var parts []string
+	for _, col := range g.row(rr) {
+		parts = append(parts, fmt.Sprint(col))
+	}
+	return strings.Join(parts, " ")
+}
+
+// refreshSample is the refresh time of one resource instance, or of all the
+// resources of a type, in one iteration.
+type refreshSample struct {
+	Addr      string
+	Type      string
+	Module    string // Module is the module instance path of the resource, or the module call path of a resource type, empty for the root module
+	Mode      string // Mode is managed for resource refreshes and data for data source reads
+	Count     int    // Count is the number of resources measured together by methods that measure a whole resource type
+	Scoped    bool   // Scoped samples measure the resources of a type in Module on their own, while the type is in other modules too
+	Iteration int
+	Start     time.Time // Start of the refresh, for methods that measure every instance
+	Duration  time.Duration
+	Usage     *util.Usage // Usage of the terraform run, for methods that measure a whole resource type
+	Error     string      // Error is the summary of the error diagnostic of the resource, for the event-log method
+}
+
+// name returns the resource type of the sample, prefixed with data. for data
+// sources so they are reported separately from managed resources of the same type.
+func (s refreshSample) name() string {
+	if s.Mode == "data" {
+		return "data." + s.Type
+	}
+	return s.Type
+}
+
+// providersByType maps resource types in state to the provider they belong to.
+func (s *TerraformState) providersByType() map[string]string {
+	providers := map[string]string{}
+	for _, r := range s.Resources {
+		p := r.ProviderAddr()
+		if p.Source != "" {
+			providers[r.Type] = p.Source
+		} else if _, ok := providers[r.Type]; !ok {
+			providers[r.Type] = p.Type
+		}
+	}
+	return providers
+}
+
+// groupSamples aggregates samples into one ResourceReport per group.
+func groupSamples(samples []refreshSample, groupBy GroupBy, providers map[string]string, iterations int) []*ResourceReport {
+	a := newSampleAggregator()
+	for _, s := range samples {
+		rr := &ResourceReport{}
+		switch groupBy.orDefault() {
+		case GroupByType:
+			rr.Name = s.name()
+		case GroupByModule:
+			rr.Module = moduleCallPath(s.Module)
+		case GroupByProvider:
+			rr.Provider = providers[s.Type]
+			if rr.Provider == "" {
+				rr.Provider = strings.Split(s.Type, "_")[0]
+			}
+		case GroupByModuleType:
+			rr.Name = s.name()
+			rr.Module = moduleCallPath(s.Module)
+		}
+		a.add(groupBy.key(rr), rr, s)
+	}
+	return a.reports(iterations)
+}
+
+// sampleAggregator computes the statistics of groups of samples.
+type sampleAggregator struct {
+	groups    map[string]*ResourceReport
+	durations map[string][]float64
+	totals    map[string]map[int]*iterationTotal
+}
+
+// iterationTotal is the sum of the samples of a group in one iteration.
+type iterationTotal struct {
+	total time.Duration
+	count int
+}
+
+func newSampleAggregator() *sampleAggregator {
+	return &sampleAggregator{
+		groups:    map[string]*ResourceReport{},
+		durations: map[string][]float64{},
+		totals:    map[string]map[int]*iterationTotal{},
+	}
+}
+
+// add adds s to the group with the given key, which is described by rr if
+// it is the first sample of the group.
+func (a *sampleAggregator) add(key string, rr *ResourceReport, s refreshSample) {
+	if existing, ok := a.groups[key]; ok {
+		rr = existing
+	} else {
+		rr.Min = (1 << 63) - 1
+		a.groups[key] = rr
+		a.totals[key] = map[int]*iterationTotal{}
+	}
+	a.durations[key] = append(a.durations[key], float64(s.Duration))
+	if s.Duration < rr.Min {
+		rr.Min = s.Duration
+		rr.MinID = s.Addr
+	}
+	if s.Duration > rr.Max {
+		rr.Max = s.Duration
+		rr.MaxID = s.Addr
+	}
+	it, ok := a.totals[key][s.Iteration]
+	if !ok {
+		it = &iterationTotal{}
+		a.totals[key][s.Iteration] = it
+	}
+	it.total += s.Duration
+	it.count++
+}
+
+// reports returns the statistics of every group, sorted by the refresh time
+// of the whole group. TotalTime is the average over iterations of the
+// average refresh time of the resources in the group, and Count is the
+// number of resources in the group in the first iteration it was measured in.
+func (a *sampleAggregator) reports(iterations int) []*ResourceReport {
+	var result []*ResourceReport
+	for key, rr := range a.groups {
+		first := -1
+		for i, it := range a.totals[key] {
+			rr.TotalTime += time.Duration(int64(it.total) / int64(it.count))
+			if first == -1 || i < first {
+				first = i
+				rr.Count = it.count
+			}
+		}
+		rr.TotalTime = time.Duration(int64(rr.TotalTime) / int64(iterations))
+		rr.StdDev = time.Duration(stat.PopStdDev(a.durations[key], nil))
+		rr.observe(a.durations[key])
+		result = append(result, rr)
+	}
+	// Reverse sort the reports by TotalTime * Count
+	sort.Slice(result, func(i, j int) bool {
+		return (int64(result[i].TotalTime) * int64(result[i].Count)) > (int64(result[j].TotalTime) * int64(result[j].Count))
+	})
+	return result
+}
+
+// reportQuantiles are the quantiles of the refresh times in reports.
+var reportQuantiles = []float64{0.5, 0.9, 0.99}
+
+// quantiles returns the reportQuantiles of durations.
+func quantiles(durations []float64) []time.Duration {
+	if len(durations) == 0 {
+		return nil
+	}
+	sorted := append([]float64{}, durations...)
+	sort.Float64s(sorted)
+	qs := make([]time.Duration, len(reportQuantiles))
+	for i, p := range reportQuantiles {
+		qs[i] = time.Duration(stat.Quantile(p, stat.Empirical, sorted, nil))
+	}
+	return qs
+}
+
+// observe sets the quantiles of the refresh times of a report, with their
+// number and sum.
+func (rr *ResourceReport) observe(durations []float64) {
+	rr.Quantiles = quantiles(durations)
+	rr.Observations = len(durations)
+	rr.ObservedTime = 0
+	for _, d := range durations {
+		rr.ObservedTime += time.Duration(d)
+	}
+}
+
+// CustomGroup is a named group of resources selected by address patterns.
+type CustomGroup struct {
+	Name     string
+	Patterns []string // Patterns are globs, or regular expressions when wrapped in slashes
+	matchers []*regexp.Regexp
+}
+
+// NewCustomGroup compiles the patterns of a custom group. In globs * matches
+// any sequence of characters and ? any single character. Both globs and
+// regular expressions have to match the whole address.
+func NewCustomGroup(name string, patterns []string) (*CustomGroup, error) {
+	g := &CustomGroup{Name: name, Patterns: patterns}
+	for _, p := range patterns {
+		var expr string
+		if len(p) > 1 && strings.HasPrefix(p, "/") && strings.HasSuffix(p, "/") {
+			expr = "^(?:" + p[1:len(p)-1] + ")$"
+		} else {
+			expr = "^" + strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(p)) + "$"
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s of group %s: %w", p, name, err)
+		}
+		g.matchers = append(g.matchers, re)
+	}
+	return g, nil
+}
+
+// matches reports whether the resource address matches any of the patterns of g.
+func (g *CustomGroup) matches(addr string) bool {
+	for _, re := range g.matchers {
+		if re.MatchString(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *CustomGroup) String() string {
+	return fmt.Sprintf("%s=%v", g.Name, g.Patterns)
+}
+
+// customGroupSamples aggregates samples into one ResourceReport per custom
+// group, named after the group. A resource can be in more than one group.
+func customGroupSamples(samples []refreshSample, groups []*CustomGroup, iterations int) []*ResourceReport {
+	a := newSampleAggregator()
+	for _, s := range samples {
+		for _, g := range groups {
+			if g.matches(s.Addr) {
+				a.add(g.Name, &ResourceReport{Name: g.Name}, s)
+			}
+		}
+	}
+	return a.reports(iterations)
+}
@@ -0,0 +1,106 @@
+package bench
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupSamples(t *testing.T) {
+	samples := []refreshSample{
+		{Addr: "aviatrix_vpc.a", Type: "aviatrix_vpc", Iteration: 0, Duration: 1 * time.Second},
+		{Addr: "module.network[0].aviatrix_vpc.b", Type: "aviatrix_vpc", Module: "module.network[0]", Iteration: 0, Duration: 3 * time.Second},
+		{Addr: "module.network[1].aviatrix_vpc.b", Type: "aviatrix_vpc", Module: "module.network[1]", Iteration: 0, Duration: 5 * time.Second},
+		{Addr: "module.network[0].aws_vpc.c", Type: "aws_vpc", Module: "module.network[0]", Iteration: 0, Duration: 2 * time.Second},
+		{Addr: "aviatrix_vpc.a", Type: "aviatrix_vpc", Iteration: 1, Duration: 3 * time.Second},
+		{Addr: "module.network[0].aviatrix_vpc.b", Type: "aviatrix_vpc", Module: "module.network[0]", Iteration: 1, Duration: 3 * time.Second},
+		{Addr: "module.network[1].aviatrix_vpc.b", Type: "aviatrix_vpc", Module: "module.network[1]", Iteration: 1, Duration: 3 * time.Second},
+		{Addr: "module.network[0].aws_vpc.c", Type: "aws_vpc", Module: "module.network[0]", Iteration: 1, Duration: 4 * time.Second},
+	}
+	providers := map[string]string{
+		"aviatrix_vpc": "registry.terraform.io/aviatrixsystems/aviatrix",
+	}
+
+	type group struct {
+		key       string
+		count     int
+		totalTime time.Duration
+	}
+	tt := map[GroupBy][]group{
+		GroupByType: {
+			{key: "aviatrix_vpc", count: 3, totalTime: 3 * time.Second},
+			{key: "aws_vpc", count: 1, totalTime: 3 * time.Second},
+		},
+		GroupByModule: {
+			{key: "module.network", count: 3, totalTime: 3333333333 * time.Nanosecond},
+			{key: "root module", count: 1, totalTime: 2 * time.Second},
+		},
+		GroupByProvider: {
+			{key: "registry.terraform.io/aviatrixsystems/aviatrix", count: 3, totalTime: 3 * time.Second},
+			{key: "aws", count: 1, totalTime: 3 * time.Second},
+		},
+		GroupByModuleType: {
+			{key: "module.network aviatrix_vpc", count: 2, totalTime: 3500 * time.Millisecond},
+			{key: "module.network aws_vpc", count: 1, totalTime: 3 * time.Second},
+			{key: "root module aviatrix_vpc", count: 1, totalTime: 2 * time.Second},
+		},
+	}
+	for groupBy, want := range tt {
+		reports := groupSamples(samples, groupBy, providers, 2)
+		require.Len(t, reports, len(want), groupBy)
+		for i, w := range want {
+			rr := reports[i]
+			require.Equal(t, w.key, groupBy.key(rr), groupBy)
+			require.Equal(t, w.count, rr.Count, w.key)
+			require.Equal(t, w.totalTime, rr.TotalTime, w.key)
+		}
+	}
+
+	reports := groupSamples(samples, GroupByType, providers, 2)
+	require.Equal(t, 1*time.Second, reports[0].Min)
+	require.Equal(t, "aviatrix_vpc.a", reports[0].MinID)
+	require.Equal(t, 5*time.Second, reports[0].Max)
+	require.Equal(t, "module.network[1].aviatrix_vpc.b", reports[0].MaxID)
+	require.Equal(t, []time.Duration{3 * time.Second, 5 * time.Second, 5 * time.Second}, reports[0].Quantiles)
+}
+
+func TestParseGroupBy(t *testing.T) {
+	for _, s := range []string{"type", "module", "provider", "module+type"} {
+		g, err := ParseGroupBy(s)
+		require.NoError(t, err)
+		require.Equal(t, GroupBy(s), g)
+	}
+	g, err := ParseGroupBy("")
+	require.NoError(t, err)
+	require.Equal(t, GroupByType, g)
+	_, err = ParseGroupBy("resource")
+	require.Error(t, err)
+}
+
+func TestCustomGroupSamples(t *testing.T) {
+	coreNetwork, err := NewCustomGroup("core-network", []string{"module.transit*.aviatrix_*", "aviatrix_vpc.*"})
+	require.NoError(t, err)
+	gateways, err := NewCustomGroup("gateways", []string{`/.*aviatrix_(spoke|transit)_gateway\..*/`})
+	require.NoError(t, err)
+	empty, err := NewCustomGroup("empty", []string{"aws_?pc.*"})
+	require.NoError(t, err)
+	_, err = NewCustomGroup("invalid", []string{"/(/"})
+	require.Error(t, err)
+
+	samples := []refreshSample{
+		{Addr: "aviatrix_vpc.a", Iteration: 0, Duration: 1 * time.Second},
+		{Addr: "module.transit[0].aviatrix_transit_gateway.gw", Iteration: 0, Duration: 4 * time.Second},
+		{Addr: "module.spoke.aviatrix_spoke_gateway.gw", Iteration: 0, Duration: 2 * time.Second},
+		{Addr: "module.spoke.aviatrix_vpc.a", Iteration: 0, Duration: 8 * time.Second},
+	}
+	reports := customGroupSamples(samples, []*CustomGroup{coreNetwork, gateways, empty}, 1)
+	require.Len(t, reports, 2)
+	require.Equal(t, "gateways", reports[0].Name)
+	require.Equal(t, 2, reports[0].Count)
+	require.Equal(t, 3*time.Second, reports[0].TotalTime)
+	require.Equal(t, "core-network", reports[1].Name)
+	require.Equal(t, 2, reports[1].Count)
+	require.Equal(t, 2500*time.Millisecond, reports[1].TotalTime)
+	require.Equal(t, "module.transit[0].aviatrix_transit_gateway.gw", reports[1].MaxID)
+}
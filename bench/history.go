@@ -0,0 +1,197 @@
+package bench
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/CyrusJavan/tf-bench/internal/history"
+	"github.com/CyrusJavan/tf-bench/internal/util"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// Labels of the runs recorded in the history.
+const (
+	LabelWorkspace   = "workspace"   // LabelWorkspace is the directory of the workspace
+	LabelFingerprint = "fingerprint" // LabelFingerprint is the hash of the workspace fingerprint
+	LabelShape       = "shape"       // LabelShape is the hash of the parts of the fingerprint that make up the workspace shape
+	LabelGitCommit   = "git-commit"
+	LabelGitBranch   = "git-branch"
+	LabelMethod      = "method"
+	LabelTerraform   = "terraform"
+	LabelCondition   = "condition" // LabelCondition is the label of a report in a comparison
+)
+
+// Shape is the hash of the parts of the fingerprint compared by ShapeDiff.
+func (f *Fingerprint) Shape() string {
+	return hashStrings([]string{f.Configuration, f.Variables, f.Resources})
+}
+
+// NewHistoryRun returns the history run of a report of the workspace in dir,
+// the current directory when dir is empty, with labels added to the labels of
+// the workspace.
+func NewHistoryRun(report *RefreshReport, dir string, labels map[string]string) *history.Run {
+	run := &history.Run{
+		Timestamp: report.Timestamp,
+		Labels:    map[string]string{LabelMethod: string(report.Config.Method.orDefault())},
+		TotalTime: report.TotalTime,
+		Report:    report.String(),
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		run.Labels[LabelWorkspace] = abs
+	}
+	if report.Fingerprint != nil {
+		run.Labels[LabelFingerprint] = report.Fingerprint.Hash()
+		run.Labels[LabelShape] = report.Fingerprint.Shape()
+	}
+	if report.TerraformVersion != nil {
+		run.Labels[LabelTerraform] = report.TerraformVersion.TerraformVersion
+	}
+	if out, err := util.RunCommandInDir(dir, nil, "git", "rev-parse", "HEAD"); err == nil {
+		run.Labels[LabelGitCommit] = strings.TrimSpace(string(out))
+	}
+	if out, err := util.RunCommandInDir(dir, nil, "git", "rev-parse", "--abbrev-ref", "HEAD"); err == nil {
+		run.Labels[LabelGitBranch] = strings.TrimSpace(string(out))
+	}
+	for k, v := range labels {
+		run.Labels[k] = v
+	}
+	for _, rr := range report.typeReports() {
+		run.Types = append(run.Types, &history.TypeTime{Name: rr.Name, Count: rr.Count, Time: rr.TotalTime})
+	}
+	return run
+}
+
+// HistoryList is a table of runs in the history.
+func HistoryList(runs []*history.Run) string {
+	t := table.NewWriter()
+	t.Style().Format.Header = text.FormatDefault
+	t.AppendHeader(table.Row{"ID", "Timestamp", "Workspace", "Fingerprint", "Branch", "Commit", "Method", "Condition", "Whole Workspace"})
+	for _, run := range runs {
+		t.AppendRow(table.Row{run.ID, run.Timestamp.Format(time.RFC3339), run.Labels[LabelWorkspace], run.Labels[LabelFingerprint],
+			run.Labels[LabelGitBranch], shortRevision(run.Labels[LabelGitCommit]), run.Labels[LabelMethod], run.Labels[LabelCondition],
+			run.TotalTime.Round(time.Millisecond)})
+	}
+	return t.Render()
+}
+
+// TrendReport is the refresh time of a resource type over the runs in the
+// history, with the points where it shifted.
+type TrendReport struct {
+	Type         string
+	Condition    string         // Condition of the runs in a comparison, empty for runs that are not part of one
+	Method       Method         // Method of the runs, as times of different methods are not comparable
+	Terraform    string         // Terraform version of the runs, as times of different versions are not comparable
+	Points       []*TrendPoint  // Points in the order of the runs
+	ChangePoints []*TrendChange // ChangePoints in the order of the runs
+}
+
+// TrendPoint is the refresh time of the resource type in a run.
+type TrendPoint struct {
+	Run          *history.Run
+	Count        int
+	Time         time.Duration
+	ShapeChanged bool // ShapeChanged is set when the workspace shape differs from the previous point
+}
+
+// TrendChange is a shift of the refresh time of the resource type.
+type TrendChange struct {
+	Point  int // Point is the index of the first point after the shift
+	Before time.Duration
+	After  time.Duration
+	Score  float64
+}
+
+// HistoryTrend returns the refresh times of the resource type in the runs
+// taken under the condition, empty for runs that are not part of a
+// comparison, that were measured with the method and terraform version of the
+// latest of them that measured the type, and detects the change points with
+// the threshold.
+func HistoryTrend(runs []*history.Run, resourceType, condition string, threshold float64) (*TrendReport, error) {
+	report := &TrendReport{Type: resourceType, Condition: condition}
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runs[i].Type(resourceType) != nil && runs[i].Labels[LabelCondition] == condition {
+			report.Method = Method(runs[i].Labels[LabelMethod])
+			report.Terraform = runs[i].Labels[LabelTerraform]
+			break
+		}
+	}
+	var values []float64
+	for _, run := range runs {
+		tt := run.Type(resourceType)
+		if tt == nil || run.Labels[LabelCondition] != condition || Method(run.Labels[LabelMethod]) != report.Method ||
+			run.Labels[LabelTerraform] != report.Terraform {
+			continue
+		}
+		point := &TrendPoint{Run: run, Count: tt.Count, Time: tt.Time}
+		if n := len(report.Points); n > 0 {
+			point.ShapeChanged = report.Points[n-1].Run.Labels[LabelShape] != run.Labels[LabelShape]
+		}
+		report.Points = append(report.Points, point)
+		values = append(values, float64(tt.Time))
+	}
+	if len(report.Points) == 0 {
+		if condition != "" {
+			return nil, fmt.Errorf("no run in the history under condition %q measured %s", condition, resourceType)
+		}
+		return nil, fmt.Errorf("no run in the history measured %s", resourceType)
+	}
+	for _, cp := range history.ChangePoints(values, threshold) {
+		report.ChangePoints = append(report.ChangePoints, &TrendChange{
+			Point:  cp.Index,
+			Before: time.Duration(cp.Before),
+			After:  time.Duration(cp.After),
+			Score:  cp.Score,
+		})
+	}
+	return report, nil
+}
+
+func (r *TrendReport) String() string {
+	changes := map[int]*TrendChange{}
+	for _, c := range r.ChangePoints {
+		changes[c.Point] = c
+	}
+	t := table.NewWriter()
+	t.Style().Format.Header = text.FormatDefault
+	t.AppendHeader(table.Row{"ID", "Timestamp", "Branch", "Commit", "Count", "Refresh Time", "Notes"})
+	shapeChanges := 0
+	for i, p := range r.Points {
+		var notes []string
+		if c, ok := changes[i]; ok {
+			notes = append(notes, fmt.Sprintf("shift %s -> %s", c.Before.Round(time.Millisecond), c.After.Round(time.Millisecond)))
+		}
+		if p.ShapeChanged {
+			notes = append(notes, "workspace changed")
+			shapeChanges++
+		}
+		t.AppendRow(table.Row{p.Run.ID, p.Run.Timestamp.Format(time.RFC3339), p.Run.Labels[LabelGitBranch], shortRevision(p.Run.Labels[LabelGitCommit]),
+			p.Count, p.Time.Round(time.Millisecond), strings.Join(notes, ", ")})
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Refresh time of %s over %d runs measured with the %s method", r.Type, len(r.Points), r.Method)
+	if r.Terraform != "" {
+		fmt.Fprintf(&b, " and terraform %s", r.Terraform)
+	}
+	if r.Condition != "" {
+		fmt.Fprintf(&b, " under condition %q", r.Condition)
+	}
+	fmt.Fprintf(&b, "\n%s\n", t.Render())
+	if len(r.ChangePoints) == 0 {
+		b.WriteString("No change points: the refresh time did not shift.\n")
+	}
+	for _, c := range r.ChangePoints {
+		var change string
+		if c.Before > 0 {
+			change = fmt.Sprintf("%+.1f%%, ", float64(c.After-c.Before)/float64(c.Before)*100)
+		}
+		fmt.Fprintf(&b, "Change point at run %s: %s -> %s (%st=%.1f)\n", r.Points[c.Point].Run.ID,
+			c.Before.Round(time.Millisecond), c.After.Round(time.Millisecond), change, c.Score)
+	}
+	if shapeChanges > 0 {
+		fmt.Fprintf(&b, "WARNING: the workspace shape changed %d times in this series, shifts may come from added or removed resources.\n", shapeChanges)
+	}
+	return b.String()
+}
@@ -0,0 +1,102 @@
+package bench
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CyrusJavan/tf-bench/internal/history"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryTrend(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	var runs []*history.Run
+	add := func(method Method, shape string, vpc time.Duration) {
+		i := len(runs)
+		runs = append(runs, &history.Run{
+			ID:        start.Add(time.Duration(i) * time.Hour).Format("20060102T150405Z"),
+			Timestamp: start.Add(time.Duration(i) * time.Hour),
+			Labels:    map[string]string{LabelMethod: string(method), LabelShape: shape, LabelGitCommit: "0123456789abcdef"},
+			Types: []*history.TypeTime{
+				{Name: "aviatrix_account", Count: 1, Time: time.Second},
+				{Name: "aviatrix_vpc", Count: 4, Time: vpc},
+			},
+		})
+	}
+	for _, ms := range []int{1000, 1010, 990, 1005, 995} {
+		add(MethodEventLog, "a", time.Duration(ms)*time.Millisecond)
+	}
+	// Runs of another method are left out, their times are not comparable.
+	add(MethodTarget, "a", 100*time.Millisecond)
+	add(MethodEventLog, "b", 1500*time.Millisecond)
+	for _, ms := range []int{1510, 1490, 1505, 1495} {
+		add(MethodEventLog, "b", time.Duration(ms)*time.Millisecond)
+	}
+
+	trend, err := HistoryTrend(runs, "aviatrix_vpc", "", history.DefaultThreshold)
+	require.NoError(t, err)
+	require.Equal(t, MethodEventLog, trend.Method)
+	require.Len(t, trend.Points, 10)
+	require.Len(t, trend.ChangePoints, 1)
+	c := trend.ChangePoints[0]
+	require.Equal(t, 5, c.Point)
+	require.Equal(t, time.Second, c.Before)
+	require.Equal(t, 1500*time.Millisecond, c.After)
+	require.True(t, trend.Points[5].ShapeChanged)
+	require.False(t, trend.Points[6].ShapeChanged)
+	out := trend.String()
+	require.Contains(t, out, "Change point at run "+trend.Points[5].Run.ID+": 1s -> 1.5s (+50.0%")
+	require.Contains(t, out, "workspace shape changed 1 times")
+
+	trend, err = HistoryTrend(runs, "aviatrix_account", "", history.DefaultThreshold)
+	require.NoError(t, err)
+	require.Empty(t, trend.ChangePoints)
+	require.Contains(t, trend.String(), "No change points")
+
+	_, err = HistoryTrend(runs, "aviatrix_transit_gateway", "", history.DefaultThreshold)
+	require.Error(t, err)
+}
+
+func TestHistoryTrendConditions(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	var runs []*history.Run
+	add := func(terraform, condition string, vpc time.Duration) {
+		i := len(runs)
+		labels := map[string]string{LabelMethod: string(MethodEventLog), LabelTerraform: terraform}
+		if condition != "" {
+			labels[LabelCondition] = condition
+		}
+		runs = append(runs, &history.Run{
+			ID:        start.Add(time.Duration(i) * time.Hour).Format("20060102T150405Z"),
+			Timestamp: start.Add(time.Duration(i) * time.Hour),
+			Labels:    labels,
+			Types:     []*history.TypeTime{{Name: "aviatrix_vpc", Count: 4, Time: vpc}},
+		})
+	}
+	// Fault injection records a baseline and an injected run each time, and
+	// a matrix run measured another terraform version.
+	for i, ms := range []int{1000, 1010, 990, 1005, 995, 1000, 1010, 990, 1005, 995} {
+		add("1.5.0", "", time.Duration(ms)*time.Millisecond)
+		if i >= 5 {
+			add("1.5.0", "baseline", time.Duration(ms)*time.Millisecond)
+			add("1.5.0", "injected faults", time.Duration(ms+800)*time.Millisecond)
+		}
+	}
+	add("1.0.0", "", 3*time.Second)
+	add("1.5.0", "", time.Second)
+
+	trend, err := HistoryTrend(runs, "aviatrix_vpc", "", history.DefaultThreshold)
+	require.NoError(t, err)
+	require.Equal(t, "1.5.0", trend.Terraform)
+	require.Len(t, trend.Points, 11)
+	require.Empty(t, trend.ChangePoints)
+
+	trend, err = HistoryTrend(runs, "aviatrix_vpc", "injected faults", history.DefaultThreshold)
+	require.NoError(t, err)
+	require.Len(t, trend.Points, 5)
+	require.Empty(t, trend.ChangePoints)
+	require.Contains(t, trend.String(), `under condition "injected faults"`)
+
+	_, err = HistoryTrend(runs, "aviatrix_vpc", "local build", history.DefaultThreshold)
+	require.Error(t, err)
+}
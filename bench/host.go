@@ -0,0 +1,156 @@
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/CyrusJavan/tf-bench/internal/host"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// errBusyHost is returned when a measurement is aborted because the host was busy.
+var errBusyHost = errors.New("the host is too busy to benchmark")
+
+// HostReport is the machine a benchmark ran on and how busy it was.
+type HostReport struct {
+	Info           *host.Info
+	Iterations     int     // Iterations is the number of measured terraform runs
+	Noisy          int     // Noisy is the number of runs during which the host was busy
+	Load           float64 // Load is the one minute load average before the first terraform run, which the host is judged on
+	MaxSteal       float64 // MaxSteal is the highest percentage of CPU time stolen by the hypervisor during a run
+	LoadThreshold  float64 // LoadThreshold is the load average per CPU above which a run is noisy, 0 for no threshold
+	StealThreshold float64 // StealThreshold is the CPU steal percentage above which a run is noisy, 0 for no threshold
+	Runs           []*HostRun
+}
+
+// HostRun is the load of the host around a measured terraform run.
+type HostRun struct {
+	Iteration  int
+	LoadBefore float64 // LoadBefore is the one minute load average before the run, mostly the load of the runs before it
+	LoadAfter  float64 // LoadAfter is the one minute load average after the run, including the load of terraform and its providers
+	Steal      float64 // Steal is the percentage of CPU time stolen by the hypervisor during the run
+	Noisy      bool
+}
+
+// hostMonitor judges the load of the host before the first terraform run of
+// a benchmark, and reads it before and after every measured run. A nil
+// monitor measures nothing.
+type hostMonitor struct {
+	report *HostReport
+	abort  bool
+	read   func() host.Load // read reads the load of the host
+	warn   io.Writer        // warn is where warnings about a busy host are written
+	judged bool             // judged is set once the load before the first run was judged
+	busy   string           // busy is why the host was busy before the first run, empty when it was not
+}
+
+// newHostMonitor returns a monitor of the current host with the thresholds of cfg.
+func newHostMonitor(cfg *Config) *hostMonitor {
+	return &hostMonitor{
+		report: &HostReport{
+			Info:           host.Collect(),
+			LoadThreshold:  cfg.MaxLoad,
+			StealThreshold: cfg.MaxSteal,
+		},
+		abort: cfg.AbortOnNoise,
+		read:  host.ReadLoad,
+		warn:  os.Stdout,
+	}
+}
+
+// begin judges the load of the host before the first terraform run of the
+// benchmark, warm-up runs included, and returns an error wrapping errBusyHost
+// when the host is busy and the monitor aborts on a busy host. Runs follow
+// each other, so the load average before a later run is mostly the load of
+// the runs before it and is not judged.
+func (m *hostMonitor) begin() error {
+	if m == nil || m.judged {
+		return nil
+	}
+	m.judged = true
+	r := m.report
+	r.Load = m.read().Load1
+	if r.LoadThreshold <= 0 || r.Load/float64(r.Info.CPUs) <= r.LoadThreshold {
+		return nil
+	}
+	m.busy = fmt.Sprintf("load average %.2f before the benchmark on %d CPUs is above %.2f per CPU", r.Load, r.Info.CPUs, r.LoadThreshold)
+	if m.abort {
+		return fmt.Errorf("%w: the %s", errBusyHost, m.busy)
+	}
+	fmt.Fprintf(m.warn, "WARN: the host is busy, the %s\n", m.busy)
+	return nil
+}
+
+// start reads the load before a run.
+func (m *hostMonitor) start() host.Load {
+	if m == nil {
+		return host.Load{}
+	}
+	return m.read()
+}
+
+// finish reads the load after a run that started with before, and warns
+// when the hypervisor stole CPU time during it, or returns an error wrapping
+// errBusyHost when the monitor aborts on a busy host. Every run of a
+// benchmark that began on a busy host is noisy.
+func (m *hostMonitor) finish(iteration int, before host.Load) error {
+	if m == nil {
+		return nil
+	}
+	after := m.read()
+	r := m.report
+	r.Iterations++
+	steal := host.Steal(before, after)
+	run := &HostRun{Iteration: iteration, LoadBefore: before.Load1, LoadAfter: after.Load1, Steal: steal, Noisy: m.busy != ""}
+	r.Runs = append(r.Runs, run)
+	if steal > r.MaxSteal {
+		r.MaxSteal = steal
+	}
+	if r.StealThreshold > 0 && steal > r.StealThreshold {
+		run.Noisy = true
+		reason := fmt.Sprintf("CPU steal %.1f%% is above %.1f%%", steal, r.StealThreshold)
+		if m.abort {
+			return fmt.Errorf("%w: during iteration %d the %s", errBusyHost, iteration, reason)
+		}
+		fmt.Fprintf(m.warn, "\nWARN: the host is busy, during iteration %d the %s\n", iteration, reason)
+	}
+	if run.Noisy {
+		r.Noisy++
+	}
+	return nil
+}
+
+// hostReport returns the report of the monitor, nil for a nil monitor.
+func (m *hostMonitor) hostReport() *HostReport {
+	if m == nil {
+		return nil
+	}
+	return m.report
+}
+
+func (r *HostReport) String() string {
+	s := r.Info.String()
+	if r.Iterations == 0 {
+		return s
+	}
+	s += fmt.Sprintf("\nhost load: load average before the benchmark %.2f, highest CPU steal %.1f%% over %d runs", r.Load, r.MaxSteal, r.Iterations)
+	t := table.NewWriter()
+	t.Style().Format.Header = text.FormatDefault
+	t.AppendHeader(table.Row{"Run", "Load Before", "Load After", "CPU Steal", "Busy"})
+	for i, run := range r.Runs {
+		var busy string
+		if run.Noisy {
+			busy = "yes"
+		}
+		t.AppendRow(table.Row{i + 1, fmt.Sprintf("%.2f", run.LoadBefore), fmt.Sprintf("%.2f", run.LoadAfter), fmt.Sprintf("%.1f%%", run.Steal), busy})
+	}
+	s += "\n" + t.Render()
+	if r.Noisy > 0 {
+		s += fmt.Sprintf("\nWARNING: %d of %d runs were on a busy host, with a load average above %.2f per CPU or CPU steal above %.1f%%. Compare these results with care.",
+			r.Noisy, r.Iterations, r.LoadThreshold, r.StealThreshold)
+	}
+	return s
+}
@@ -0,0 +1,98 @@
+package bench
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/CyrusJavan/tf-bench/internal/host"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostMonitor(t *testing.T) {
+	var loads []host.Load
+	var warnings bytes.Buffer
+	m := newHostMonitor(&Config{MaxLoad: 1, MaxSteal: 5})
+	m.report.Info = &host.Info{OS: "linux", Arch: "amd64", CPUs: 2, GoVersion: "go1.16"}
+	m.warn = &warnings
+	m.read = func() host.Load {
+		load := loads[0]
+		loads = loads[1:]
+		return load
+	}
+
+	loads = []host.Load{{Load1: 0.5}}
+	require.NoError(t, m.begin())
+	require.NoError(t, m.begin(), "the host is judged once")
+
+	// Runs follow each other, the load before the second and third run is
+	// that of the runs before them, which is not noise.
+	loads = []host.Load{
+		{Load1: 0.5, CPU: host.CPUTimes{Total: 1000, Steal: 10}},
+		{Load1: 3, CPU: host.CPUTimes{Total: 2000, Steal: 20}},
+	}
+	require.NoError(t, m.finish(0, m.start()))
+	loads = []host.Load{
+		{Load1: 3, CPU: host.CPUTimes{Total: 2000, Steal: 20}},
+		{Load1: 4, CPU: host.CPUTimes{Total: 3000, Steal: 30}},
+	}
+	require.NoError(t, m.finish(1, m.start()))
+	loads = []host.Load{
+		{Load1: 4, CPU: host.CPUTimes{Total: 3000, Steal: 30}},
+		{Load1: 4.5, CPU: host.CPUTimes{Total: 4000, Steal: 40}},
+	}
+	require.NoError(t, m.finish(2, m.start()))
+	require.Equal(t, 0, m.report.Noisy)
+	require.Empty(t, warnings.String())
+
+	// 80 of 1000 ticks stolen is 8%.
+	loads = []host.Load{
+		{Load1: 4.5, CPU: host.CPUTimes{Total: 4000, Steal: 40}},
+		{Load1: 4.5, CPU: host.CPUTimes{Total: 5000, Steal: 120}},
+	}
+	require.NoError(t, m.finish(3, m.start()))
+	require.Equal(t, 1, m.report.Noisy)
+	require.Equal(t, "\nWARN: the host is busy, during iteration 3 the CPU steal 8.0% is above 5.0%\n", warnings.String())
+
+	r := m.hostReport()
+	require.Equal(t, 4, r.Iterations)
+	require.Equal(t, 0.5, r.Load)
+	require.Equal(t, &HostRun{Iteration: 1, LoadBefore: 3, LoadAfter: 4, Steal: 1}, r.Runs[1])
+	require.InDelta(t, 8, r.MaxSteal, 1e-9)
+	require.Contains(t, r.String(), "host: linux/amd64, 2 CPUs\ngo runtime: go1.16")
+	require.Contains(t, r.String(), "load average before the benchmark 0.50")
+	require.Contains(t, r.String(), "WARNING: 1 of 4 runs were on a busy host")
+	require.Contains(t, r.String(), "Load Before")
+
+	var nilMonitor *hostMonitor
+	require.NoError(t, nilMonitor.begin())
+	require.NoError(t, nilMonitor.finish(0, nilMonitor.start()))
+	require.Nil(t, nilMonitor.hostReport())
+}
+
+func TestHostMonitorBusy(t *testing.T) {
+	var warnings bytes.Buffer
+	m := newHostMonitor(&Config{MaxLoad: 1})
+	m.report.Info = &host.Info{CPUs: 4}
+	m.warn = &warnings
+	m.read = func() host.Load {
+		return host.Load{Load1: 6}
+	}
+	// A load of 6 on 4 CPUs is above 1 per CPU, every run is noisy.
+	require.NoError(t, m.begin())
+	require.Equal(t, "WARN: the host is busy, the load average 6.00 before the benchmark on 4 CPUs is above 1.00 per CPU\n", warnings.String())
+	require.NoError(t, m.finish(0, m.start()))
+	require.NoError(t, m.finish(1, m.start()))
+	require.Equal(t, 2, m.report.Noisy)
+	require.True(t, m.report.Runs[1].Noisy)
+
+	m = newHostMonitor(&Config{MaxLoad: 1, AbortOnNoise: true})
+	m.report.Info = &host.Info{CPUs: 4}
+	m.warn = &warnings
+	m.read = func() host.Load {
+		return host.Load{Load1: 6}
+	}
+	err := m.begin()
+	require.True(t, errors.Is(err, errBusyHost))
+	require.Contains(t, err.Error(), "load average 6.00 before the benchmark")
+}
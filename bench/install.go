@@ -0,0 +1,161 @@
+package bench
+
+import (
+	"archive/zip"
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// InstallDir returns the directory tf-bench installs terraform releases into.
+func InstallDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not find home directory: %w", err)
+	}
+	return filepath.Join(home, ".tf-bench"), nil
+}
+
+func installedTerraformPath(v string) (string, error) {
+	dir, err := InstallDir()
+	if err != nil {
+		return "", err
+	}
+	name := "terraform" + strings.TrimPrefix(v, "v")
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// TerraformAtVersion returns a TerraformRunner for a terraform release
+// previously installed with InstallTerraform.
+func TerraformAtVersion(v string) (*TerraformRunner, error) {
+	execPath, err := installedTerraformPath(v)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(execPath); err != nil {
+		return nil, fmt.Errorf("terraform v%[1]s is not installed, run `tf-bench install %[1]s --from <release zip>`: %w", strings.TrimPrefix(v, "v"), err)
+	}
+	return NewTerraformRunner(execPath), nil
+}
+
+// releaseZipName is the file name HashiCorp publishes the release of terraform v for this platform under.
+func releaseZipName(v string) string {
+	return fmt.Sprintf("terraform_%s_%s_%s.zip", strings.TrimPrefix(v, "v"), runtime.GOOS, runtime.GOARCH)
+}
+
+// releaseSumsName is the file name HashiCorp publishes the checksums of terraform v under.
+func releaseSumsName(v string) string {
+	return fmt.Sprintf("terraform_%s_SHA256SUMS", strings.TrimPrefix(v, "v"))
+}
+
+// InstallTerraform installs terraform v from a release zip, or from a
+// directory containing the release zip for this platform. The zip is verified
+// against sumsFile, which defaults to the SHA256SUMS file published next to the zip.
+func InstallTerraform(v, from, sumsFile string) (*TerraformRunner, error) {
+	zipPath := from
+	fi, err := os.Stat(from)
+	if err != nil {
+		return nil, fmt.Errorf("could not read release archive: %w", err)
+	}
+	if fi.IsDir() {
+		zipPath = filepath.Join(from, releaseZipName(v))
+	}
+	if sumsFile == "" {
+		sumsFile = filepath.Join(filepath.Dir(zipPath), releaseSumsName(v))
+	}
+	err = verifySHA256(zipPath, sumsFile)
+	if err != nil {
+		return nil, err
+	}
+	zipReader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not open release archive %s: %w", zipPath, err)
+	}
+	defer zipReader.Close()
+	var binary *zip.File
+	for _, f := range zipReader.File {
+		if f.Name == "terraform" || f.Name == "terraform.exe" {
+			binary = f
+		}
+	}
+	if binary == nil {
+		return nil, fmt.Errorf("release archive %s does not contain a terraform binary", zipPath)
+	}
+	b, err := readZipFile(binary)
+	if err != nil {
+		return nil, fmt.Errorf("could not extract terraform binary: %w", err)
+	}
+	execPath, err := installedTerraformPath(v)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(filepath.Dir(execPath), 0755)
+	if err != nil {
+		return nil, fmt.Errorf("could not create install directory: %w", err)
+	}
+	err = os.WriteFile(execPath, b, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("could not write terraform binary: %w", err)
+	}
+	tfRunner := NewTerraformRunner(execPath)
+	_, err = tfRunner.Run("version")
+	if err != nil {
+		return nil, fmt.Errorf("something went wrong installing tf version: %w", err)
+	}
+	return tfRunner, nil
+}
+
+// verifySHA256 checks the checksum of the file at path against its entry in sumsFile.
+func verifySHA256(path, sumsFile string) error {
+	f, err := os.Open(sumsFile)
+	if err != nil {
+		return fmt.Errorf("could not read checksums file: %w", err)
+	}
+	defer f.Close()
+	var want string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == filepath.Base(path) {
+			want = strings.ToLower(fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("could not read checksums file: %w", err)
+	}
+	if want == "" {
+		return fmt.Errorf("checksums file %s has no entry for %s", sumsFile, filepath.Base(path))
+	}
+	archive, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not read release archive: %w", err)
+	}
+	defer archive.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, archive); err != nil {
+		return fmt.Errorf("could not hash release archive: %w", err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		return fmt.Errorf("checksum mismatch for %s: expected %s got %s", filepath.Base(path), want, got)
+	}
+	return nil
+}
+
+func readZipFile(zf *zip.File) ([]byte, error) {
+	f, err := zf.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
@@ -0,0 +1,71 @@
+package bench
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstallTerraform(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake terraform binary is a shell script")
+	}
+	home := t.TempDir()
+	oldHome := os.Getenv("HOME")
+	os.Setenv("HOME", home)
+	defer os.Setenv("HOME", oldHome)
+
+	releaseDir := t.TempDir()
+	zipPath := filepath.Join(releaseDir, releaseZipName("1.5.7"))
+	writeReleaseZip(t, zipPath, map[string]string{
+		"LICENSE.txt": "license",
+		"terraform":   "#!/bin/sh\necho Terraform v1.5.7\n",
+	})
+	b, err := os.ReadFile(zipPath)
+	require.NoError(t, err)
+	sums := fmt.Sprintf("%x  %s\n%x  terraform_1.5.7_windows_amd64.zip\n", sha256.Sum256(b), releaseZipName("1.5.7"), sha256.Sum256(nil))
+	err = os.WriteFile(filepath.Join(releaseDir, releaseSumsName("1.5.7")), []byte(sums), 0644)
+	require.NoError(t, err)
+
+	_, err = TerraformAtVersion("1.5.7")
+	require.Error(t, err)
+
+	tfRunner, err := InstallTerraform("1.5.7", releaseDir, "")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(home, ".tf-bench", "terraform1.5.7"), tfRunner.ExecPath())
+
+	installed, err := TerraformAtVersion("v1.5.7")
+	require.NoError(t, err)
+	require.Equal(t, tfRunner.ExecPath(), installed.ExecPath())
+
+	// A zip that does not match the published checksum must be rejected.
+	writeReleaseZip(t, zipPath, map[string]string{
+		"terraform": "#!/bin/sh\necho tampered\n",
+	})
+	_, err = InstallTerraform("1.5.7", zipPath, "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "checksum mismatch")
+
+	_, err = InstallTerraform("1.5.7", zipPath, filepath.Join(releaseDir, "missing_SHA256SUMS"))
+	require.Error(t, err)
+}
+
+func writeReleaseZip(t *testing.T, path string, files map[string]string) {
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for name, content := range files {
+		fw, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+}
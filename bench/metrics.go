@@ -0,0 +1,87 @@
+package bench
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/CyrusJavan/tf-bench/internal/metrics"
+)
+
+// typeReports returns the reports of the resource types, nil when the
+// resources were grouped by something else.
+func (r *RefreshReport) typeReports() []*ResourceReport {
+	if r.Config.Method.perInstance() && r.Config.GroupBy.orDefault() != GroupByType {
+		return nil
+	}
+	return r.Resources
+}
+
+// Metrics returns the statistics of the report as Prometheus metrics.
+func (r *RefreshReport) Metrics() []*metrics.Family {
+	info := &metrics.Family{Name: "tfbench_benchmark_info", Help: "Benchmark that measured the other metrics.", Type: metrics.TypeGauge}
+	var fingerprint string
+	if r.Fingerprint != nil {
+		fingerprint = r.Fingerprint.Hash()
+	}
+	info.Add(1, "method", string(r.Config.Method.orDefault()), "iterations", strconv.Itoa(r.Config.Iterations),
+		"fingerprint", fingerprint, "version", r.BuildVersion)
+	timestamp := &metrics.Family{Name: "tfbench_benchmark_timestamp_seconds", Help: "Time the benchmark started at.", Type: metrics.TypeGauge}
+	timestamp.Add(float64(r.Timestamp.UnixNano()) / 1e9)
+	workspace := &metrics.Family{Name: "tfbench_workspace_refresh_seconds", Help: "Time to refresh the whole workspace.", Type: metrics.TypeGauge}
+	workspace.Add(r.TotalTime.Seconds())
+	families := []*metrics.Family{info, timestamp, workspace}
+
+	refresh := &metrics.Family{Name: "tfbench_resource_refresh_seconds",
+		Help: "Refresh time of a resource of the type in the latest benchmark, of all resources of the type for the temp-dir and target methods.",
+		Type: metrics.TypeSummary}
+	average := &metrics.Family{Name: "tfbench_resource_refresh_average_seconds",
+		Help: "Average refresh time of a resource of the type, of all resources of the type for the temp-dir and target methods.",
+		Type: metrics.TypeGauge}
+	count := &metrics.Family{Name: "tfbench_resources", Help: "Number of resources of the type in the workspace.", Type: metrics.TypeGauge}
+	for _, rr := range r.typeReports() {
+		if len(rr.Quantiles) > 0 {
+			quantiles := map[float64]float64{}
+			for i, q := range rr.Quantiles {
+				quantiles[reportQuantiles[i]] = q.Seconds()
+			}
+			refresh.AddSummary(quantiles, rr.ObservedTime.Seconds(), rr.Observations, "type", rr.Name)
+		}
+		average.Add(rr.TotalTime.Seconds(), "type", rr.Name)
+		count.Add(float64(rr.Count), "type", rr.Name)
+	}
+	families = append(families, refresh, average, count)
+
+	if r.Usage != nil {
+		cpu := &metrics.Family{Name: "tfbench_workspace_cpu_seconds", Help: "CPU time of terraform and its providers to refresh the whole workspace.", Type: metrics.TypeGauge}
+		cpu.Add((r.Usage.UserTime + r.Usage.SystemTime).Seconds())
+		memory := &metrics.Family{Name: "tfbench_workspace_max_rss_bytes", Help: "Peak memory of terraform or its largest provider.", Type: metrics.TypeGauge}
+		memory.Add(float64(r.Usage.MaxRSS))
+		families = append(families, cpu, memory)
+	}
+	if r.Host != nil {
+		noisy := &metrics.Family{Name: "tfbench_host_noisy_runs", Help: "Number of measured terraform runs during which the host was busy.", Type: metrics.TypeGauge}
+		noisy.Add(float64(r.Host.Noisy))
+		families = append(families, noisy)
+	}
+	if tv := r.TerraformVersion; tv != nil {
+		terraform := &metrics.Family{Name: "tfbench_terraform_info", Help: "Terraform version of the benchmark.", Type: metrics.TypeGauge}
+		terraform.Add(1, "engine", string(tv.Engine), "version", tv.TerraformVersion)
+		providers := &metrics.Family{Name: "tfbench_provider_info", Help: "Provider versions of the benchmark.", Type: metrics.TypeGauge}
+		var names []string
+		for name := range tv.ProviderSelections {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			providers.Add(1, "provider", name, "version", tv.ProviderSelections[name])
+		}
+		families = append(families, terraform, providers)
+	}
+	if v := r.ControllerVersion; v != nil {
+		controller := &metrics.Family{Name: "tfbench_controller_info", Help: "Aviatrix controller version of the benchmark.", Type: metrics.TypeGauge}
+		controller.Add(1, "version", fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Build))
+		families = append(families, controller)
+	}
+	return families
+}
@@ -0,0 +1,55 @@
+package bench
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CyrusJavan/tf-bench/internal/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportMetrics(t *testing.T) {
+	report := &RefreshReport{
+		Timestamp: time.Unix(1700000000, 0),
+		TotalTime: 12500 * time.Millisecond,
+		TerraformVersion: &TerraformVersion{Engine: EngineTerraform, TerraformVersion: "1.5.7",
+			ProviderSelections: map[string]string{"registry.terraform.io/aviatrixsystems/aviatrix": "3.1.0"}},
+		Resources: []*ResourceReport{{
+			Name:         "aviatrix_vpc",
+			Count:        4,
+			TotalTime:    2 * time.Second,
+			Quantiles:    []time.Duration{1500 * time.Millisecond, 3 * time.Second, 4 * time.Second},
+			Observations: 12,
+			ObservedTime: 24 * time.Second,
+		}},
+		Config:       &Config{Iterations: 3},
+		BuildVersion: "v1.0.0",
+	}
+	var b strings.Builder
+	require.NoError(t, metrics.Write(&b, report.Metrics()))
+	out := b.String()
+	for _, line := range []string{
+		`tfbench_benchmark_info{fingerprint="",iterations="3",method="event-log",version="v1.0.0"} 1`,
+		`tfbench_benchmark_timestamp_seconds 1.7e+09`,
+		`tfbench_workspace_refresh_seconds 12.5`,
+		`tfbench_resource_refresh_seconds{quantile="0.5",type="aviatrix_vpc"} 1.5`,
+		`tfbench_resource_refresh_seconds{quantile="0.99",type="aviatrix_vpc"} 4`,
+		`tfbench_resource_refresh_seconds_sum{type="aviatrix_vpc"} 24`,
+		`tfbench_resource_refresh_seconds_count{type="aviatrix_vpc"} 12`,
+		`tfbench_resource_refresh_average_seconds{type="aviatrix_vpc"} 2`,
+		`tfbench_resources{type="aviatrix_vpc"} 4`,
+		`tfbench_terraform_info{engine="terraform",version="1.5.7"} 1`,
+		`tfbench_provider_info{provider="registry.terraform.io/aviatrixsystems/aviatrix",version="3.1.0"} 1`,
+	} {
+		require.Contains(t, out, line+"\n")
+	}
+	require.Contains(t, out, "# TYPE tfbench_resource_refresh_seconds summary\n")
+	require.NotContains(t, out, "tfbench_workspace_cpu_seconds")
+
+	// Reports grouped by module have no per type metrics.
+	report.Config.GroupBy = GroupByModule
+	b.Reset()
+	require.NoError(t, metrics.Write(&b, report.Metrics()))
+	require.NotContains(t, b.String(), "tfbench_resources")
+}
@@ -0,0 +1,470 @@
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// moduleManifest is the part of .terraform/modules/modules.json that maps
+// module calls to the directories terraform init installed them in.
+type moduleManifest struct {
+	Modules []struct {
+		Key    string // Key is the module call path without the module keyword, for example "network.subnets"
+		Source string
+		Dir    string // Dir is the module source directory relative to the root module
+	}
+}
+
+// moduleDirs returns the source directory of every module called by the
+// configuration in the current directory, keyed like the module manifest
+// written by terraform init. Without a manifest only modules with local
+// source paths can be found.
+func moduleDirs() (map[string]string, error) {
+	dirs := map[string]string{}
+	b, err := os.ReadFile(filepath.Join(".terraform", "modules", "modules.json"))
+	if err == nil {
+		var m moduleManifest
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, fmt.Errorf("could not parse module manifest: %w", err)
+		}
+		for _, module := range m.Modules {
+			dirs[module.Key] = filepath.Clean(module.Dir)
+		}
+		return dirs, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not read module manifest: %w", err)
+	}
+	dirs[""] = "."
+	return dirs, findLocalModules(".", "", dirs)
+}
+
+// findLocalModules adds the modules with local source paths called by the
+// module in dir, and the modules they call, to dirs.
+func findLocalModules(dir, key string, dirs map[string]string) error {
+	files, err := readConfigFiles(dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		for _, block := range f.Body().Blocks() {
+			if block.Type() != "module" || len(block.Labels()) != 1 {
+				continue
+			}
+			attr := block.Body().GetAttribute("source")
+			if attr == nil {
+				continue
+			}
+			source, ok := literalValue(attr)
+			if !ok || source.Type() != cty.String {
+				continue
+			}
+			if !strings.HasPrefix(source.AsString(), "./") && !strings.HasPrefix(source.AsString(), "../") {
+				continue
+			}
+			childKey := block.Labels()[0]
+			if key != "" {
+				childKey = key + "." + childKey
+			}
+			childDir := filepath.Join(dir, source.AsString())
+			dirs[childKey] = childDir
+			if err := findLocalModules(childDir, childKey, dirs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readConfigFiles parses the tf files of the module in dir.
+func readConfigFiles(dir string) ([]*hclwrite.File, error) {
+	tfFiles, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, fmt.Errorf("could not list tf files: %w", err)
+	}
+	var files []*hclwrite.File
+	for _, name := range tfFiles {
+		fileContent, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("could not read tf file %s: %w", name, err)
+		}
+		f, diags := hclwrite.ParseConfig(fileContent, name, hcl.InitialPos)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("parsing tf file %s: %s", name, diags.Error())
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// requiredProviderSources maps the local names declared in required_providers to their source addresses.
+func requiredProviderSources(files []*hclwrite.File) map[string]string {
+	sources := map[string]string{}
+	for _, f := range files {
+		for _, block := range f.Body().Blocks() {
+			if block.Type() != "terraform" {
+				continue
+			}
+			for _, tfBlock := range block.Body().Blocks() {
+				if tfBlock.Type() == "required_providers" {
+					for k, attr := range tfBlock.Body().Attributes() {
+						sources[k] = requiredProviderSource(attr)
+					}
+				}
+			}
+		}
+	}
+	return sources
+}
+
+var moduleStepRe = regexp.MustCompile(`module\.([^.\[]+)(?:\[([^\]]*)\])?`)
+
+// moduleStep is one module call in a module instance path like module.network[0].
+type moduleStep struct {
+	Name string
+	Key  string // Key is the instance key as written in the path, for example 0 or "a", empty without count or for_each
+}
+
+func parseModulePath(path string) []moduleStep {
+	var steps []moduleStep
+	for _, m := range moduleStepRe.FindAllStringSubmatch(path, -1) {
+		steps = append(steps, moduleStep{Name: m[1], Key: m[2]})
+	}
+	return steps
+}
+
+// moduleCallPath removes the instance keys from a module instance path,
+// for example module.network[0].module.subnets becomes module.network.module.subnets.
+func moduleCallPath(path string) string {
+	var parts []string
+	for _, step := range parseModulePath(path) {
+		parts = append(parts, "module."+step.Name)
+	}
+	return strings.Join(parts, ".")
+}
+
+// moduleCall is a module call on the path to the resources being measured.
+type moduleCall struct {
+	Name     string
+	Path     string          // Path is the module call path, for example module.network.module.subnets
+	Key      string          // Key is the module manifest key, for example network.subnets
+	Keys     map[string]bool // Keys are the instance keys of the module instances that contain resources
+	Children []*moduleCall
+}
+
+// moduleTree returns the module calls of the root module that lead to the given module instances.
+func moduleTree(instances []string) []*moduleCall {
+	var roots []*moduleCall
+	for _, instance := range instances {
+		calls := &roots
+		var path, key string
+		for _, step := range parseModulePath(instance) {
+			path = strings.TrimPrefix(path+".module."+step.Name, ".")
+			key = strings.TrimPrefix(key+"."+step.Name, ".")
+			var call *moduleCall
+			for _, c := range *calls {
+				if c.Name == step.Name {
+					call = c
+				}
+			}
+			if call == nil {
+				call = &moduleCall{Name: step.Name, Path: path, Key: key, Keys: map[string]bool{}}
+				*calls = append(*calls, call)
+			}
+			call.Keys[step.Key] = true
+			calls = &call.Children
+		}
+	}
+	sortModuleCalls(roots)
+	return roots
+}
+
+func sortModuleCalls(calls []*moduleCall) {
+	sort.Slice(calls, func(i, j int) bool {
+		return calls[i].Name < calls[j].Name
+	})
+	for _, call := range calls {
+		sortModuleCalls(call.Children)
+	}
+}
+
+// setRepetition sets count or for_each on a module call so it has the
+// instances recorded in state.
+func (c *moduleCall) setRepetition(body *hclwrite.Body) error {
+	if len(c.Keys) == 1 && c.Keys[""] {
+		return nil
+	}
+	count := 0
+	forEach := map[string]cty.Value{}
+	for key := range c.Keys {
+		if i, err := strconv.Atoi(key); err == nil {
+			if i+1 > count {
+				count = i + 1
+			}
+			continue
+		}
+		s, err := strconv.Unquote(key)
+		if err != nil {
+			return fmt.Errorf("invalid instance key %s of %s", key, c.Path)
+		}
+		forEach[s] = cty.StringVal(s)
+	}
+	if count > 0 && len(forEach) > 0 {
+		return fmt.Errorf("%s has both numeric and string instance keys", c.Path)
+	}
+	if count > 0 {
+		body.SetAttributeValue("count", cty.NumberIntVal(int64(count)))
+		return nil
+	}
+	body.SetAttributeValue("for_each", cty.MapVal(forEach))
+	return nil
+}
+
+// moduleGenerator writes child modules with just the provider
+// configurations needed to refresh the resources of one type.
+type moduleGenerator struct {
+	resource *Resource
+	dirs     map[string]string
+	secrets  *secretVariables
+	evaluate bool              // evaluate is true when provider configurations in child modules are used
+	files    map[string][]byte // files are the generated files by path relative to the root module
+}
+
+// moduleCallMeta are the arguments of a module call that are not input variables.
+var moduleCallMeta = map[string]bool{
+	"source":     true,
+	"version":    true,
+	"count":      true,
+	"for_each":   true,
+	"providers":  true,
+	"depends_on": true,
+}
+
+// appendCalls generates the given module calls of the module in dir and
+// appends them to body. It returns the provider configurations of the
+// calling module that are passed to the calls, like aws.west, and the names
+// of secret variables the calling module has to pass on.
+func (g *moduleGenerator) appendCalls(body *hclwrite.Body, dir string, ev *evaluator, calls []*moduleCall) (map[string]bool, []string, error) {
+	passed := map[string]bool{}
+	var secretNames []string
+	if len(calls) == 0 {
+		return passed, nil, nil
+	}
+	files, err := readConfigFiles(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, call := range calls {
+		var callBlock *hclwrite.Block
+		for _, f := range files {
+			for _, block := range f.Body().Blocks() {
+				if block.Type() == "module" && len(block.Labels()) == 1 && block.Labels()[0] == call.Name {
+					callBlock = block
+				}
+			}
+		}
+		if callBlock == nil {
+			return nil, nil, fmt.Errorf("%s is in state but not in the configuration", call.Path)
+		}
+		childDir, ok := g.dirs[call.Key]
+		if !ok {
+			return nil, nil, fmt.Errorf("could not find the source of %s, run terraform init", call.Path)
+		}
+		var childEv *evaluator
+		if g.evaluate {
+			inputs := map[string]cty.Value{}
+			for name, attr := range callBlock.Body().Attributes() {
+				if moduleCallMeta[name] || ev == nil {
+					continue
+				}
+				// Inputs that cannot be evaluated are only an error when a provider uses them.
+				if val, err := ev.evaluateAttribute(attr); err == nil {
+					inputs[name] = val
+				}
+			}
+			childEv, err = newModuleEvaluator(childDir, call.Path, inputs)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", call.Path, err)
+			}
+		}
+		childNeeds, childSecrets, err := g.generate(call, childDir, childEv)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		block := body.AppendNewBlock("module", []string{call.Name})
+		source := "./modules/" + call.Key
+		if strings.Contains(call.Key, ".") {
+			// Generated modules are siblings in the modules directory.
+			source = "../" + call.Key
+		}
+		block.Body().SetAttributeValue("source", cty.StringVal(source))
+		if err := call.setRepetition(block.Body()); err != nil {
+			return nil, nil, err
+		}
+		if attr := callBlock.Body().GetAttribute("providers"); attr != nil {
+			providers, err := filterProvidersMap(attr, childNeeds)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", call.Path, err)
+			}
+			if len(providers) > 0 {
+				var tokens hclwrite.Tokens
+				tokens = append(tokens, &hclwrite.Token{Type: hclsyntax.TokenOBrace, Bytes: []byte("{")},
+					&hclwrite.Token{Type: hclsyntax.TokenNewline, Bytes: []byte("\n")})
+				for _, p := range providers {
+					tokens = append(tokens, &hclwrite.Token{Type: hclsyntax.TokenIdent, Bytes: []byte(p[0] + " = " + p[1])},
+						&hclwrite.Token{Type: hclsyntax.TokenNewline, Bytes: []byte("\n")})
+					passed[p[1]] = true
+				}
+				tokens = append(tokens, &hclwrite.Token{Type: hclsyntax.TokenCBrace, Bytes: []byte("}")})
+				block.Body().SetAttributeRaw("providers", tokens)
+			}
+		}
+		for _, name := range childSecrets {
+			block.Body().SetAttributeTraversal(name, hcl.Traversal{
+				hcl.TraverseRoot{Name: "var"},
+				hcl.TraverseAttr{Name: name},
+			})
+		}
+		secretNames = append(secretNames, childSecrets...)
+	}
+	return passed, secretNames, nil
+}
+
+// generate writes the child module of call to the generated files. It
+// returns whether the child module needs the provider with a local name and
+// the names of the secret variables it has to be passed.
+func (g *moduleGenerator) generate(call *moduleCall, dir string, ev *evaluator) (func(string) bool, []string, error) {
+	f := hclwrite.NewEmptyFile()
+	passed, secretNames, err := g.appendCalls(f.Body(), dir, ev, call.Children)
+	if err != nil {
+		return nil, nil, err
+	}
+	files, err := readConfigFiles(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	sources := requiredProviderSources(files)
+	passedNames := map[string]bool{}
+	for name := range passed {
+		passedNames[strings.Split(name, ".")[0]] = true
+	}
+	names := map[string]bool{}
+	requiredProviders := hclwrite.NewEmptyFile().Body().AppendNewBlock("required_providers", nil)
+	for _, file := range files {
+		for _, block := range file.Body().Blocks() {
+			switch block.Type() {
+			case "terraform":
+				for _, tfBlock := range block.Body().Blocks() {
+					if tfBlock.Type() != "required_providers" {
+						continue
+					}
+					for k, attr := range tfBlock.Body().Attributes() {
+						if g.resource.usesProviderAnywhere(k, sources[k]) || passedNames[k] {
+							requiredProviders.Body().SetAttributeRaw(k, attr.Expr().BuildTokens(nil))
+							names[k] = true
+						}
+					}
+				}
+			case "provider":
+				labels := block.Labels()
+				if len(labels) == 0 {
+					continue
+				}
+				alias := providerBlockAlias(block)
+				if isProxyProviderBlock(block) {
+					if g.resource.usesProviderAnywhere(labels[0], sources[labels[0]]) || passedNames[labels[0]] {
+						f.Body().AppendBlock(block)
+						names[labels[0]] = true
+					}
+					continue
+				}
+				if !g.resource.usesProviderConfig(call.Path, labels[0], sources[labels[0]], alias) && !passed[providerConfigName(labels[0], alias)] {
+					continue
+				}
+				if ev == nil {
+					return nil, nil, fmt.Errorf("%s: provider %s is not evaluated", call.Path, labels[0])
+				}
+				var before int
+				if g.secrets != nil {
+					before = len(g.secrets.names)
+				}
+				if err := ev.resolveBody(block.Body(), g.secrets); err != nil {
+					return nil, nil, fmt.Errorf("%s: provider %s: %w", call.Path, labels[0], err)
+				}
+				if g.secrets != nil {
+					secretNames = append(secretNames, g.secrets.names[before:]...)
+				}
+				f.Body().AppendBlock(block)
+				names[labels[0]] = true
+			}
+		}
+	}
+	if len(requiredProviders.Body().Attributes()) > 0 {
+		tf := f.Body().AppendNewBlock("terraform", nil)
+		tf.Body().AppendBlock(requiredProviders)
+	}
+	for _, name := range secretNames {
+		g.secrets.declareVariable(f.Body(), name)
+	}
+	g.files[filepath.Join("modules", call.Key, "main.tf")] = f.Bytes()
+	needs := func(localName string) bool {
+		return names[localName] || g.resource.usesProviderAnywhere(localName, sources[localName])
+	}
+	return needs, secretNames, nil
+}
+
+// isProxyProviderBlock reports whether block only declares that a provider
+// configuration is passed in by the calling module.
+func isProxyProviderBlock(block *hclwrite.Block) bool {
+	attrs := block.Body().Attributes()
+	if len(block.Body().Blocks()) > 0 {
+		return false
+	}
+	_, hasAlias := attrs["alias"]
+	return len(attrs) == 0 || (len(attrs) == 1 && hasAlias)
+}
+
+// providerConfigName is the name a provider configuration is referenced by, like aws or aws.west.
+func providerConfigName(localName, alias string) string {
+	if alias == "" {
+		return localName
+	}
+	return localName + "." + alias
+}
+
+// filterProvidersMap returns the entries of the providers argument of a
+// module call for the providers the called module needs. Entries are pairs
+// of the child and the parent provider configuration.
+func filterProvidersMap(attr *hclwrite.Attribute, needs func(string) bool) ([][2]string, error) {
+	src := attr.Expr().BuildTokens(nil).Bytes()
+	expr, diags := hclsyntax.ParseExpression(src, "providers", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("invalid providers argument: %s", diags.Error())
+	}
+	obj, ok := expr.(*hclsyntax.ObjectConsExpr)
+	if !ok {
+		return nil, fmt.Errorf("providers argument must be an object")
+	}
+	var providers [][2]string
+	for _, item := range obj.Items {
+		key := strings.TrimSpace(string(item.KeyExpr.Range().SliceBytes(src)))
+		value := strings.TrimSpace(string(item.ValueExpr.Range().SliceBytes(src)))
+		if !needs(strings.Split(key, ".")[0]) {
+			continue
+		}
+		providers = append(providers, [2]string{key, value})
+	}
+	return providers, nil
+}
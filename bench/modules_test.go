@@ -0,0 +1,208 @@
+package bench
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const moduleTestState = `{
+  "version": 4,
+  "resources": [
+    {
+      "module": "module.network[0]",
+      "mode": "managed",
+      "type": "aviatrix_vpc",
+      "name": "this",
+      "provider": "provider[\"registry.terraform.io/aviatrixsystems/aviatrix\"]",
+      "instances": [{}]
+    },
+    {
+      "module": "module.network[1].module.subnets[\"a\"]",
+      "mode": "managed",
+      "type": "aviatrix_vpc",
+      "name": "this",
+      "provider": "provider[\"registry.terraform.io/aviatrixsystems/aviatrix\"]",
+      "instances": [{}, {}]
+    },
+    {
+      "module": "module.other",
+      "mode": "managed",
+      "type": "aviatrix_vpc",
+      "name": "this",
+      "provider": "module.other.provider[\"registry.terraform.io/aviatrixsystems/aviatrix\"]",
+      "instances": [{}]
+    },
+    {
+      "mode": "managed",
+      "type": "aviatrix_vpc",
+      "name": "root",
+      "provider": "provider[\"registry.terraform.io/aviatrixsystems/aviatrix\"]",
+      "instances": [{}]
+    },
+    {
+      "module": "module.network[0]",
+      "mode": "managed",
+      "type": "aws_vpc",
+      "name": "this",
+      "provider": "provider[\"registry.terraform.io/hashicorp/aws\"].west",
+      "instances": [{}]
+    }
+  ]
+}`
+
+func TestCreateModifiedTerraformConfigurationModules(t *testing.T) {
+	pwd, err := os.Getwd()
+	require.NoError(t, err)
+	defer os.Chdir(pwd)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	files := map[string]string{
+		"main.tf": `
+terraform {
+  required_providers {
+    aviatrix = {
+      source = "aviatrixsystems/aviatrix"
+    }
+    aws = {
+      source = "hashicorp/aws"
+    }
+  }
+}
+variable "region" {
+  default = "us-east-1"
+}
+provider "aviatrix" {
+  controller_ip = "10.0.0.1"
+}
+provider "aws" {
+  alias  = "west"
+  region = "us-west-2"
+}
+module "network" {
+  source = "./modules/network"
+  count  = 2
+  name   = "net-${var.region}"
+  providers = {
+    aws      = aws.west
+    aviatrix = aviatrix
+  }
+}
+module "other" {
+  source = "./modules/other"
+  name   = var.region
+}
+`,
+		"modules/network/main.tf": `
+terraform {
+  required_providers {
+    aviatrix = {
+      source = "aviatrixsystems/aviatrix"
+    }
+    aws = {
+      source = "hashicorp/aws"
+    }
+  }
+}
+variable "name" {}
+resource "aviatrix_vpc" "this" {
+  name = var.name
+}
+module "subnets" {
+  source   = "./subnets"
+  for_each = toset(["a", "b"])
+  name     = var.name
+}
+`,
+		"modules/network/subnets/main.tf": `
+terraform {
+  required_providers {
+    aviatrix = {
+      source = "aviatrixsystems/aviatrix"
+    }
+  }
+}
+variable "name" {}
+`,
+		"modules/other/main.tf": `
+terraform {
+  required_providers {
+    aviatrix = {
+      source = "aviatrixsystems/aviatrix"
+    }
+  }
+}
+variable "name" {}
+provider "aviatrix" {
+  controller_ip = "${var.name}.example.com"
+}
+`,
+	}
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(name), 0755))
+		require.NoError(t, os.WriteFile(name, []byte(content), 0644))
+	}
+	var state TerraformState
+	require.NoError(t, json.Unmarshal([]byte(moduleTestState), &state))
+	resource := state.resourcesByType("managed")["aviatrix_vpc"]
+	require.Equal(t, 5, resource.Count)
+	require.Equal(t, []string{`module.network[0]`, `module.network[1].module.subnets["a"]`, `module.other`}, resource.ModuleInstances)
+
+	generated, _, err := createModifiedTerraformConfiguration(resource, "", &TerraformVersion{TerraformVersion: "1.0.0"}, false)
+	require.NoError(t, err)
+	require.Len(t, generated, 5)
+	main := string(generated["main.tf"])
+	require.Contains(t, main, `controller_ip = "10.0.0.1"`)
+	require.NotContains(t, main, "us-west-2")
+	require.NotContains(t, main, "hashicorp/aws")
+	require.NotContains(t, main, "module")
+
+	modules := string(generated["modules.tf"])
+	require.Contains(t, modules, `module "network" {`)
+	require.Contains(t, modules, `source = "./modules/network"`)
+	require.Contains(t, modules, `count  = 2`)
+	require.Contains(t, modules, "aviatrix = aviatrix")
+	require.NotContains(t, modules, "aws")
+	require.Contains(t, modules, `source = "./modules/other"`)
+
+	network := string(generated[filepath.Join("modules", "network", "main.tf")])
+	require.Contains(t, network, `source = "../network.subnets"`)
+	require.Contains(t, network, `for_each = {`)
+	require.Contains(t, network, `aviatrixsystems/aviatrix`)
+	require.NotContains(t, network, "hashicorp/aws")
+	require.NotContains(t, network, "aviatrix_vpc")
+
+	require.Contains(t, generated, filepath.Join("modules", "network.subnets", "main.tf"))
+
+	other := string(generated[filepath.Join("modules", "other", "main.tf")])
+	require.Contains(t, other, `controller_ip = "us-east-1.example.com"`)
+
+	// Secrets of provider configurations in child modules are passed down from the root module.
+	generated, env, err := createModifiedTerraformConfiguration(resource, "", &TerraformVersion{TerraformVersion: "1.0.0"}, true)
+	require.NoError(t, err)
+	require.Contains(t, string(generated["modules.tf"]), "tfbench_secret_0 = var.tfbench_secret_0")
+	require.Contains(t, string(generated["main.tf"]), `variable "tfbench_secret_0"`)
+	other = string(generated[filepath.Join("modules", "other", "main.tf")])
+	require.Contains(t, other, `variable "tfbench_secret_0"`)
+	require.Contains(t, other, "controller_ip = var.tfbench_secret_0")
+	require.NotContains(t, other, "example.com")
+	require.Contains(t, env, `TF_VAR_tfbench_secret_0="us-east-1.example.com"`)
+
+	// Resources of a single module keep just that module.
+	byModule := state.resourcesByModule("", "aviatrix_vpc")
+	require.Len(t, byModule, 4)
+	other2, err := filterState([]byte(moduleTestState), byModule["module.other"])
+	require.NoError(t, err)
+	var filtered TerraformState
+	require.NoError(t, json.Unmarshal(other2, &filtered))
+	require.Len(t, filtered.Resources, 1)
+	require.Equal(t, "module.other", filtered.Resources[0].Module)
+
+	all, err := filterState([]byte(moduleTestState), resource)
+	require.NoError(t, err)
+	filtered = TerraformState{}
+	require.NoError(t, json.Unmarshal(all, &filtered))
+	require.Len(t, filtered.Resources, 4)
+}
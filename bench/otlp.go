@@ -0,0 +1,133 @@
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/CyrusJavan/tf-bench/internal/otlp"
+)
+
+// errNoEvents is returned when exporting a report without event-log events as
+// a trace.
+var errNoEvents = errors.New("only reports of the event-log method can be exported as a trace")
+
+// runEvents is what happened during a benchmark with the event-log method.
+type runEvents struct {
+	end        time.Time         // end of the benchmark
+	providers  map[string]string // providers of the resource types in state
+	iterations []*iterationEvents
+}
+
+// iterationEvents is an iteration of the event-log method.
+type iterationEvents struct {
+	start   time.Time
+	end     time.Time
+	samples []refreshSample // samples of every refresh, including those of dependencies of sampled resources
+	failed  []refreshSample // failed refreshes
+	err     error           // err is the error terraform exited with, if any
+}
+
+// traceSpans returns the spans of the benchmark: the benchmark is the root
+// span, its iterations are children of it, and the refreshes of every address
+// are children of their iteration. condition is set as an attribute when the
+// report is part of a comparison.
+func (r *RefreshReport) traceSpans(condition string) ([]*otlp.Span, error) {
+	if r.events == nil {
+		return nil, errNoEvents
+	}
+	traceID, err := otlp.NewTraceID()
+	if err != nil {
+		return nil, fmt.Errorf("could not generate trace ID: %w", err)
+	}
+	newSpan := func(parent *otlp.Span, name string, start, end time.Time, attributes ...otlp.Attribute) (*otlp.Span, error) {
+		spanID, err := otlp.NewSpanID()
+		if err != nil {
+			return nil, fmt.Errorf("could not generate span ID: %w", err)
+		}
+		span := &otlp.Span{TraceID: traceID, SpanID: spanID, Name: name, Start: start, End: end, Attributes: attributes}
+		if parent != nil {
+			span.ParentSpanID = parent.SpanID
+		}
+		return span, nil
+	}
+
+	attributes := []otlp.Attribute{
+		otlp.String("tfbench.method", string(r.Config.Method.orDefault())),
+		otlp.Int("tfbench.iterations", int64(r.Config.Iterations)),
+		otlp.Float("tfbench.workspace.refresh_seconds", r.TotalTime.Seconds()),
+	}
+	if condition != "" {
+		attributes = append(attributes, otlp.String("tfbench.condition", condition))
+	}
+	if r.Fingerprint != nil {
+		attributes = append(attributes, otlp.String("tfbench.workspace.fingerprint", r.Fingerprint.Hash()))
+	}
+	if tv := r.TerraformVersion; tv != nil {
+		attributes = append(attributes, otlp.String("terraform.engine", string(tv.Engine)), otlp.String("terraform.version", tv.TerraformVersion))
+	}
+	root, err := newSpan(nil, "tf-bench refresh", r.Timestamp, r.events.end, attributes...)
+	if err != nil {
+		return nil, err
+	}
+	spans := []*otlp.Span{root}
+	for i, it := range r.events.iterations {
+		refreshes := append(append([]refreshSample{}, it.samples...), it.failed...)
+		sort.SliceStable(refreshes, func(i, j int) bool {
+			return refreshes[i].Start.Before(refreshes[j].Start)
+		})
+		iteration, err := newSpan(root, fmt.Sprintf("iteration %d", i+1), it.start, it.end,
+			otlp.Int("tfbench.iteration", int64(i+1)),
+			otlp.Int("tfbench.refreshes", int64(len(refreshes))))
+		if err != nil {
+			return nil, err
+		}
+		if it.err != nil {
+			iteration.Error = it.err.Error()
+		}
+		spans = append(spans, iteration)
+		for _, s := range refreshes {
+			attributes := []otlp.Attribute{
+				otlp.String("terraform.resource.address", s.Addr),
+				otlp.String("terraform.resource.type", s.Type),
+				otlp.String("terraform.resource.mode", s.Mode),
+			}
+			if s.Module != "" {
+				attributes = append(attributes, otlp.String("terraform.module", s.Module))
+			}
+			if provider := r.events.providers[s.Type]; provider != "" {
+				attributes = append(attributes, otlp.String("terraform.provider", provider))
+			}
+			refresh, err := newSpan(iteration, s.Addr, s.Start, s.Start.Add(s.Duration), attributes...)
+			if err != nil {
+				return nil, err
+			}
+			refresh.Error = s.Error
+			spans = append(spans, refresh)
+		}
+	}
+	return spans, nil
+}
+
+// ExportTrace exports the benchmark of a report of the event-log method as a
+// trace and returns its ID. condition is the label of the report in a
+// comparison, empty otherwise.
+func (r *RefreshReport) ExportTrace(exporter *otlp.Exporter, condition string) (otlp.TraceID, error) {
+	spans, err := r.traceSpans(condition)
+	if err != nil {
+		return otlp.TraceID{}, err
+	}
+	resource := []otlp.Attribute{
+		otlp.String("service.name", "tf-bench"),
+		otlp.String("service.version", r.BuildVersion),
+	}
+	if r.Host != nil && r.Host.Info != nil {
+		resource = append(resource, otlp.String("os.type", r.Host.Info.OS), otlp.String("host.arch", r.Host.Info.Arch))
+	}
+	err = exporter.Export(resource, "github.com/CyrusJavan/tf-bench", r.BuildVersion, spans)
+	if err != nil {
+		return otlp.TraceID{}, err
+	}
+	return spans[0].TraceID, nil
+}
@@ -0,0 +1,107 @@
+package bench
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CyrusJavan/tf-bench/internal/otlp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceSpans(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	report := &RefreshReport{
+		Timestamp: start,
+		TotalTime: 3 * time.Second,
+		Config:    &Config{Iterations: 1},
+		events: &runEvents{
+			end:       start.Add(5 * time.Second),
+			providers: map[string]string{"aviatrix_vpc": "registry.terraform.io/aviatrixsystems/aviatrix"},
+			iterations: []*iterationEvents{{
+				start: start.Add(time.Second),
+				end:   start.Add(4 * time.Second),
+				samples: []refreshSample{
+					{Addr: "module.network.aviatrix_vpc.b", Type: "aviatrix_vpc", Module: "module.network", Mode: "managed",
+						Start: start.Add(1500 * time.Millisecond), Duration: time.Second},
+				},
+				failed: []refreshSample{
+					{Addr: "aviatrix_vpc.a", Type: "aviatrix_vpc", Mode: "managed", Start: start.Add(1200 * time.Millisecond),
+						Duration: 2 * time.Second, Error: "rate limited"},
+				},
+				err: errors.New("exit status 1"),
+			}},
+		},
+	}
+	spans, err := report.traceSpans("baseline")
+	require.NoError(t, err)
+	require.Len(t, spans, 4)
+	root, iteration, failed, refresh := spans[0], spans[1], spans[2], spans[3]
+	for _, s := range spans {
+		require.Equal(t, root.TraceID, s.TraceID)
+	}
+	require.Equal(t, "tf-bench refresh", root.Name)
+	require.Equal(t, otlp.SpanID{}, root.ParentSpanID)
+	require.Equal(t, start.Add(5*time.Second), root.End)
+	require.Contains(t, root.Attributes, otlp.String("tfbench.condition", "baseline"))
+
+	require.Equal(t, "iteration 1", iteration.Name)
+	require.Equal(t, root.SpanID, iteration.ParentSpanID)
+	require.Equal(t, "exit status 1", iteration.Error)
+
+	// Refreshes are in the order they started.
+	require.Equal(t, "aviatrix_vpc.a", failed.Name)
+	require.Equal(t, iteration.SpanID, failed.ParentSpanID)
+	require.Equal(t, "rate limited", failed.Error)
+	require.Equal(t, start.Add(3200*time.Millisecond), failed.End)
+	require.Equal(t, "module.network.aviatrix_vpc.b", refresh.Name)
+	require.Equal(t, iteration.SpanID, refresh.ParentSpanID)
+	require.Empty(t, refresh.Error)
+	require.Equal(t, []otlp.Attribute{
+		otlp.String("terraform.resource.address", "module.network.aviatrix_vpc.b"),
+		otlp.String("terraform.resource.type", "aviatrix_vpc"),
+		otlp.String("terraform.resource.mode", "managed"),
+		otlp.String("terraform.module", "module.network"),
+		otlp.String("terraform.provider", "registry.terraform.io/aviatrixsystems/aviatrix"),
+	}, refresh.Attributes)
+
+	_, err = (&RefreshReport{Config: &Config{Method: MethodTempDir}}).traceSpans("")
+	require.True(t, errors.Is(err, errNoEvents))
+}
+
+func TestExportTrace(t *testing.T) {
+	var traceID string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		var body struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []struct {
+						TraceID string
+					}
+				}
+			}
+		}
+		require.NoError(t, json.Unmarshal(b, &body))
+		traceID = body.ResourceSpans[0].ScopeSpans[0].Spans[0].TraceID
+	}))
+	defer collector.Close()
+
+	start := time.Now()
+	report := &RefreshReport{
+		Timestamp:    start,
+		Config:       &Config{Iterations: 1},
+		BuildVersion: "v1.0.0",
+		events:       &runEvents{end: start.Add(time.Second), iterations: []*iterationEvents{{start: start, end: start.Add(time.Second)}}},
+	}
+	exporter, err := otlp.NewExporter(collector.URL, nil)
+	require.NoError(t, err)
+	id, err := report.ExportTrace(exporter, "")
+	require.NoError(t, err)
+	require.Equal(t, id.String(), traceID)
+}
@@ -0,0 +1,145 @@
+package bench
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/CyrusJavan/tf-bench/internal/util"
+	"go.uber.org/zap"
+)
+
+// ProviderOverride replaces a released provider with a locally built binary.
+type ProviderOverride struct {
+	Name string // Name is the provider source address, or just its type such as "aviatrix"
+	Path string // Path is the locally built provider binary
+}
+
+// ParseProviderOverride parses an override in the form name=/path/to/binary.
+func ParseProviderOverride(s string) (*ProviderOverride, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("provider override %q must be in the form name=/path/to/binary", s)
+	}
+	path, err := filepath.Abs(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve provider override path %s: %w", parts[1], err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read provider override binary: %w", err)
+	}
+	if fi.IsDir() {
+		return nil, fmt.Errorf("provider override %s must be the provider binary, not a directory", path)
+	}
+	return &ProviderOverride{Name: parts[0], Path: path}, nil
+}
+
+// source resolves the provider source address of the override, using the
+// provider selections of the workspace when only the type was given.
+func (o *ProviderOverride) source(tv *TerraformVersion) (string, error) {
+	if strings.Contains(o.Name, "/") {
+		return o.Name, nil
+	}
+	if tv != nil {
+		for addr := range tv.ProviderSelections {
+			if strings.HasSuffix(addr, "/"+o.Name) {
+				return addr, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("could not find provider %s in the workspace, use the full source address such as aviatrixsystems/%s", o.Name, o.Name)
+}
+
+// providerType is the type of the provider at a source address,
+// for example "aviatrix" for "registry.terraform.io/aviatrixsystems/aviatrix".
+func providerType(source string) string {
+	return source[strings.LastIndex(source, "/")+1:]
+}
+
+// withProviderOverrides returns a copy of the runner that uses the locally
+// built providers through the dev_overrides of a generated CLI config file.
+// The returned func removes the generated files.
+func (tr *TerraformRunner) withProviderOverrides(overrides []*ProviderOverride, tv *TerraformVersion) (*TerraformRunner, func(), error) {
+	dir, err := util.MkdirTemp("tf-bench-override.")
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create provider override dir: %w", err)
+	}
+	cleanup := func() {
+		util.RemoveTempDir(dir)
+	}
+	var devOverrides strings.Builder
+	for i, o := range overrides {
+		source, err := o.source(tv)
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		// dev_overrides points at a directory that must contain the
+		// binary under its conventional name.
+		pluginDir := filepath.Join(dir, fmt.Sprintf("%d", i))
+		err = os.Mkdir(pluginDir, 0700)
+		if err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("could not create provider override dir: %w", err)
+		}
+		name := "terraform-provider-" + providerType(source)
+		if runtime.GOOS == "windows" {
+			name += ".exe"
+		}
+		err = os.Symlink(o.Path, filepath.Join(pluginDir, name))
+		if err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("could not link provider override binary: %w", err)
+		}
+		fmt.Fprintf(&devOverrides, "    %q = %q\n", source, pluginDir)
+	}
+	cliConfig := fmt.Sprintf(`provider_installation {
+  dev_overrides {
+%s  }
+  direct {}
+}
+`, devOverrides.String())
+	cliConfigFile := filepath.Join(dir, "tf-bench.tfrc")
+	err = os.WriteFile(cliConfigFile, []byte(cliConfig), 0600)
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("could not write CLI config file: %w", err)
+	}
+	return tr.WithEnv("TF_CLI_CONFIG_FILE=" + cliConfigFile), cleanup, nil
+}
+
+// ProviderOverrideBenchmark runs RefreshBenchmark once with the released
+// providers of the workspace and once with the locally built overrides.
+func ProviderOverrideBenchmark(cfg *Config, tfRunner *TerraformRunner, overrides []*ProviderOverride, logger *zap.Logger) (*Comparison, error) {
+	tv, err := terraformVersion(tfRunner)
+	if err != nil {
+		return nil, fmt.Errorf("could not find provider selections of the workspace: %w", err)
+	}
+	overrideRunner, cleanup, err := tfRunner.withProviderOverrides(overrides, tv)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	comparison := &Comparison{Timestamp: time.Now()}
+	fmt.Println("Benchmarking with released providers")
+	released, err := RefreshBenchmark(cfg, tfRunner, logger)
+	if err != nil {
+		return nil, fmt.Errorf("benchmark with released providers: %w", err)
+	}
+	fmt.Println("Benchmarking with provider overrides")
+	local, err := RefreshBenchmark(cfg, overrideRunner, logger)
+	if err != nil {
+		return nil, fmt.Errorf("benchmark with provider overrides: %w", err)
+	}
+	for _, o := range overrides {
+		comparison.Notes = append(comparison.Notes, fmt.Sprintf("provider override: %s=%s", o.Name, o.Path))
+	}
+	comparison.Labels = []string{"released", "local build"}
+	comparison.Reports = []*RefreshReport{released, local}
+	return comparison, nil
+}
@@ -0,0 +1,47 @@
+package bench
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProviderOverrides(t *testing.T) {
+	binary := filepath.Join(t.TempDir(), "terraform-provider-aviatrix_v2.20.0-dev")
+	err := os.WriteFile(binary, []byte("binary"), 0755)
+	require.NoError(t, err)
+
+	_, err = ParseProviderOverride("aviatrix")
+	require.Error(t, err)
+	_, err = ParseProviderOverride("aviatrix=" + filepath.Dir(binary))
+	require.Error(t, err)
+	o, err := ParseProviderOverride("aviatrix=" + binary)
+	require.NoError(t, err)
+
+	tv := &TerraformVersion{
+		ProviderSelections: map[string]string{
+			"registry.terraform.io/aviatrixsystems/aviatrix": "2.19.3",
+			"registry.terraform.io/hashicorp/random":         "3.1.0",
+		},
+	}
+	overrideRunner, cleanup, err := SystemTerraform.withProviderOverrides([]*ProviderOverride{o}, tv)
+	require.NoError(t, err)
+	defer cleanup()
+	require.Len(t, overrideRunner.env, 1)
+	cliConfigFile := strings.TrimPrefix(overrideRunner.env[0], "TF_CLI_CONFIG_FILE=")
+	cliConfig, err := os.ReadFile(cliConfigFile)
+	require.NoError(t, err)
+	require.Contains(t, string(cliConfig), `"registry.terraform.io/aviatrixsystems/aviatrix" = "`)
+	linked, err := filepath.EvalSymlinks(filepath.Join(filepath.Dir(cliConfigFile), "0", "terraform-provider-aviatrix"))
+	require.NoError(t, err)
+	wantLinked, err := filepath.EvalSymlinks(binary)
+	require.NoError(t, err)
+	require.Equal(t, wantLinked, linked)
+	require.Empty(t, SystemTerraform.env, "overrides must not leak into the released runner")
+
+	_, _, err = SystemTerraform.withProviderOverrides([]*ProviderOverride{{Name: "aws", Path: binary}}, tv)
+	require.Error(t, err)
+}
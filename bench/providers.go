@@ -0,0 +1,125 @@
+package bench
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ProviderAddr is the provider configuration a resource in state belongs to,
+// parsed from the provider field of the resource.
+type ProviderAddr struct {
+	Module string // Module is the module path the provider is configured in, empty for the root module
+	Source string // Source is the provider source address, empty in state written by terraform v0.12
+	Type   string // Type is the provider type, for example "aws"
+	Alias  string // Alias of the provider configuration, empty for the default configuration
+}
+
+// providerAddrRe matches both provider["registry.terraform.io/hashicorp/aws"].west
+// and the terraform v0.12 form provider.aws.west, optionally prefixed with a module path.
+var providerAddrRe = regexp.MustCompile(`^((?:module\.[^.\[]+(?:\[[^\]]*\])?\.)*)provider(?:\["([^"]+)"\]|\.([^.\[\]"]+))(?:\.([^.\[\]"]+))?$`)
+
+func parseProviderAddr(s string) (*ProviderAddr, error) {
+	m := providerAddrRe.FindStringSubmatch(s)
+	if m == nil {
+		return nil, fmt.Errorf("could not parse provider address %q", s)
+	}
+	p := &ProviderAddr{
+		Module: strings.TrimSuffix(m[1], "."),
+		Source: m[2],
+		Type:   m[3],
+		Alias:  m[4],
+	}
+	if p.Source != "" {
+		p.Type = providerType(p.Source)
+		// Legacy providers upgraded from v0.12 state have no namespace.
+		if strings.Contains(p.Source, "/-/") {
+			p.Source = ""
+		}
+	}
+	return p, nil
+}
+
+func (p *ProviderAddr) String() string {
+	var s string
+	if p.Source != "" {
+		s = fmt.Sprintf("provider[%q]", p.Source)
+	} else {
+		s = "provider." + p.Type
+	}
+	if p.Alias != "" {
+		s += "." + p.Alias
+	}
+	if p.Module != "" {
+		s = p.Module + "." + s
+	}
+	return s
+}
+
+// matches reports whether the provider configured under localName with
+// the given source address, which may be empty when it is implied by the
+// local name, is the provider of p.
+func (p *ProviderAddr) matches(localName, source string) bool {
+	if p.Source == "" {
+		return localName == p.Type
+	}
+	if source == "" {
+		source = "hashicorp/" + localName
+	}
+	return sourceKey(source) == sourceKey(p.Source)
+}
+
+// sourceKey normalizes a provider source address to "namespace/type" so
+// addresses with and without the registry hostname compare equal.
+func sourceKey(source string) string {
+	parts := strings.Split(strings.ToLower(source), "/")
+	if len(parts) > 2 {
+		parts = parts[len(parts)-2:]
+	}
+	return strings.Join(parts, "/")
+}
+
+// requiredProviderSource returns the source address declared by a
+// required_providers entry, or "" if it only declares a version.
+func requiredProviderSource(attr *hclwrite.Attribute) string {
+	v, ok := literalValue(attr)
+	if !ok || !v.Type().IsObjectType() || !v.Type().HasAttribute("source") {
+		return ""
+	}
+	source := v.GetAttr("source")
+	if source.IsNull() || !source.IsKnown() || source.Type() != cty.String {
+		return ""
+	}
+	return source.AsString()
+}
+
+// providerBlockAlias returns the alias of a provider block, or "" for the default configuration.
+func providerBlockAlias(block *hclwrite.Block) string {
+	attr := block.Body().GetAttribute("alias")
+	if attr == nil {
+		return ""
+	}
+	v, ok := literalValue(attr)
+	if !ok || v.IsNull() || v.Type() != cty.String {
+		return ""
+	}
+	return v.AsString()
+}
+
+// literalValue evaluates an attribute that does not reference anything.
+func literalValue(attr *hclwrite.Attribute) (cty.Value, bool) {
+	expr, diags := hclsyntax.ParseExpression(attr.Expr().BuildTokens(nil).Bytes(), "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return cty.NilVal, false
+	}
+	v, diags := expr.Value(nil)
+	if diags.HasErrors() || !v.IsWhollyKnown() {
+		return cty.NilVal, false
+	}
+	return v, true
+}
@@ -0,0 +1,97 @@
+package bench
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProviderAddr(t *testing.T) {
+	tt := map[string]ProviderAddr{
+		`provider["registry.terraform.io/hashicorp/aws"]`:                   {Source: "registry.terraform.io/hashicorp/aws", Type: "aws"},
+		`provider["registry.terraform.io/hashicorp/aws"].west`:              {Source: "registry.terraform.io/hashicorp/aws", Type: "aws", Alias: "west"},
+		`module.network.provider["registry.terraform.io/hashicorp/aws"]`:    {Module: "module.network", Source: "registry.terraform.io/hashicorp/aws", Type: "aws"},
+		`module.a.module.b.provider["registry.opentofu.org/hashicorp/aws"]`: {Module: "module.a.module.b", Source: "registry.opentofu.org/hashicorp/aws", Type: "aws"},
+		`provider["registry.terraform.io/-/aws"]`:                           {Type: "aws"},
+		`provider.aws`:                {Type: "aws"},
+		`provider.aws.west`:           {Type: "aws", Alias: "west"},
+		`module.network.provider.aws`: {Module: "module.network", Type: "aws"},
+	}
+	for s, want := range tt {
+		p, err := parseProviderAddr(s)
+		require.NoError(t, err, s)
+		require.Equal(t, want, *p, s)
+	}
+	_, err := parseProviderAddr("aws")
+	require.Error(t, err)
+}
+
+func TestCreateModifiedTerraformConfigurationProviders(t *testing.T) {
+	pwd, err := os.Getwd()
+	require.NoError(t, err)
+	defer os.Chdir(pwd)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	err = os.WriteFile("main.tf", []byte(`
+terraform {
+  required_providers {
+    controller = {
+      source = "aviatrixsystems/aviatrix"
+    }
+    aws = {
+      source = "hashicorp/aws"
+    }
+  }
+  backend "s3" {
+    bucket = "my-tf-test-bucket"
+  }
+}
+provider "controller" {
+  skip_version_validation = true
+}
+provider "aws" {
+  region = "us-east-1"
+}
+provider "aws" {
+  alias  = "west"
+  region = "us-west-2"
+}
+`), 0644)
+	require.NoError(t, err)
+	tv := &TerraformVersion{TerraformVersion: "1.0.0"}
+
+	tt := []struct {
+		name        string
+		provider    string
+		contains    []string
+		notContains []string
+	}{
+		{
+			name:        "aliased provider",
+			provider:    `provider["registry.terraform.io/hashicorp/aws"].west`,
+			contains:    []string{`"us-west-2"`, `source = "hashicorp/aws"`},
+			notContains: []string{`"us-east-1"`, `skip_version_validation`, `aviatrixsystems/aviatrix`, `backend`},
+		},
+		{
+			name:        "local name differs from type prefix",
+			provider:    `provider["registry.terraform.io/aviatrixsystems/aviatrix"]`,
+			contains:    []string{`provider "controller"`, `aviatrixsystems/aviatrix`},
+			notContains: []string{`us-east-1`, `us-west-2`, `hashicorp/aws`},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := parseProviderAddr(tc.provider)
+			require.NoError(t, err)
+			resource := &Resource{Name: "aws_instance", Count: 1, Providers: []*ProviderAddr{p}}
+			files, _, err := createModifiedTerraformConfiguration(resource, "", tv, false)
+			require.NoError(t, err)
+			for _, s := range tc.contains {
+				require.Contains(t, string(files["main.tf"]), s)
+			}
+			for _, s := range tc.notContains {
+				require.NotContains(t, string(files["main.tf"]), s)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package bench
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"gonum.org/v1/gonum/stat"
+)
+
+// SamplingReport describes the sample of resources measured by a benchmark
+// that did not measure every resource in the workspace.
+type SamplingReport struct {
+	Seed        int64         // Seed the sample was drawn with
+	Sampled     int           // Sampled is the number of resources measured
+	Population  int           // Population is the number of resources in the workspace
+	Total       time.Duration // Total is the estimated sum of the refresh times of every resource in the workspace
+	TotalStdErr time.Duration // TotalStdErr is the standard error of Total
+}
+
+// instanceSample is a stratified random sample of the resource instances in
+// state, with the resources of every type as a stratum.
+type instanceSample struct {
+	seed   int64
+	strata map[string]*stratum // strata by resource type, prefixed with data. for data sources
+	addrs  map[string]bool     // addrs are the addresses of every sampled instance
+}
+
+// stratum is the sample of the instances of one resource type.
+type stratum struct {
+	population int
+	addrs      []string
+}
+
+// sampleSize returns how many of population instances to sample, either n or
+// the given fraction of them. At least two instances are sampled when there
+// are that many, so the sampling error can be estimated.
+func sampleSize(population, n int, fraction float64) int {
+	size := n
+	if fraction > 0 {
+		size = int(math.Ceil(fraction * float64(population)))
+	}
+	if size < 2 {
+		size = 2
+	}
+	if size > population {
+		size = population
+	}
+	return size
+}
+
+// sampleInstances draws n instances, or the given fraction of the instances,
+// of every resource type in state, and of every data source type with
+// dataSources. The same seed draws the same sample from the same state.
+func sampleInstances(tfstate *TerraformState, dataSources bool, n int, fraction float64, seed int64) *instanceSample {
+	all := map[string][]string{}
+	for _, r := range tfstate.Resources {
+		if r.Mode == "data" && !dataSources {
+			continue
+		}
+		name := refreshSample{Type: r.Type, Mode: r.Mode}.name()
+		for _, instance := range r.Instances {
+			all[name] = append(all[name], r.InstanceAddr(instance.IndexKey))
+		}
+	}
+	var names []string
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	s := &instanceSample{
+		seed:   seed,
+		strata: map[string]*stratum{},
+		addrs:  map[string]bool{},
+	}
+	rnd := rand.New(rand.NewSource(seed))
+	for _, name := range names {
+		addrs := all[name]
+		sort.Strings(addrs)
+		st := &stratum{population: len(addrs)}
+		for _, i := range rnd.Perm(len(addrs))[:sampleSize(len(addrs), n, fraction)] {
+			st.addrs = append(st.addrs, addrs[i])
+			s.addrs[addrs[i]] = true
+		}
+		sort.Strings(st.addrs)
+		s.strata[name] = st
+	}
+	return s
+}
+
+// targets returns the -target arguments that refresh just the sampled instances.
+func (s *instanceSample) targets() []string {
+	var targets []string
+	for addr := range s.addrs {
+		targets = append(targets, "-target="+addr)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// estimate turns the per type reports of the sampled instances into
+// estimates for the whole workspace. Count becomes the number of resources
+// of the type in the workspace, and StdErr the standard error of TotalTime
+// with the finite population correction.
+func (s *instanceSample) estimate(reports []*ResourceReport, samples []refreshSample) *SamplingReport {
+	// The refresh time of an instance is its average over iterations.
+	totals := map[string]time.Duration{}
+	counts := map[string]int{}
+	for _, sample := range samples {
+		totals[sample.Addr] += sample.Duration
+		counts[sample.Addr]++
+	}
+	sr := &SamplingReport{Seed: s.seed}
+	for _, st := range s.strata {
+		sr.Population += st.population
+		sr.Sampled += len(st.addrs)
+	}
+	var totalVariance float64
+	for _, rr := range reports {
+		st, ok := s.strata[rr.Name]
+		if !ok {
+			continue
+		}
+		var ys []float64
+		for _, addr := range st.addrs {
+			if counts[addr] > 0 {
+				ys = append(ys, float64(totals[addr])/float64(counts[addr]))
+			}
+		}
+		rr.Sampled = len(ys)
+		rr.Count = st.population
+		if n := float64(len(ys)); n > 1 {
+			fpc := 1 - n/float64(st.population)
+			se := math.Sqrt(fpc * stat.Variance(ys, nil) / n)
+			rr.StdErr = time.Duration(se)
+			totalVariance += math.Pow(float64(st.population)*se, 2)
+		}
+		sr.Total += time.Duration(int64(rr.TotalTime) * int64(rr.Count))
+	}
+	sr.TotalStdErr = time.Duration(math.Sqrt(totalVariance))
+	// Reverse sort the reports by the estimated TotalTime * Count
+	sort.Slice(reports, func(i, j int) bool {
+		return (int64(reports[i].TotalTime) * int64(reports[i].Count)) > (int64(reports[j].TotalTime) * int64(reports[j].Count))
+	})
+	return sr
+}
+
+// validateSampling checks the sampling options of cfg.
+func (cfg *Config) validateSampling(method Method) error {
+	if !cfg.sampling() {
+		return nil
+	}
+	switch {
+	case cfg.Sample < 0:
+		return fmt.Errorf("sample size must be positive")
+	case cfg.Sample > 0 && cfg.SampleFraction != 0:
+		return fmt.Errorf("set either a sample size or a sample fraction, not both")
+	case cfg.SampleFraction < 0 || cfg.SampleFraction > 1:
+		return fmt.Errorf("sample fraction must be between 0 and 1")
+	case !method.perInstance():
+		return fmt.Errorf("sampling requires the event log measurement method")
+	case cfg.GroupBy.orDefault() != GroupByType || len(cfg.Groups) > 0:
+		return fmt.Errorf("sampling estimates are per resource type and cannot be grouped")
+	}
+	return nil
+}
+
+// sampling reports whether only a sample of the resources is measured.
+func (cfg *Config) sampling() bool {
+	return cfg.Sample != 0 || cfg.SampleFraction != 0
+}
@@ -0,0 +1,98 @@
+package bench
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSampleSize(t *testing.T) {
+	require.Equal(t, 5, sampleSize(100, 5, 0))
+	require.Equal(t, 3, sampleSize(3, 5, 0))
+	require.Equal(t, 10, sampleSize(100, 0, 0.1))
+	require.Equal(t, 11, sampleSize(101, 0, 0.1))
+	require.Equal(t, 2, sampleSize(10, 0, 0.01))
+	require.Equal(t, 1, sampleSize(1, 0, 0.01))
+}
+
+func TestSampleInstances(t *testing.T) {
+	vpcs := &StateResource{Type: "aviatrix_vpc", Name: "a", Mode: "managed"}
+	for i := 0; i < 100; i++ {
+		vpcs.Instances = append(vpcs.Instances, StateInstance{IndexKey: float64(i)})
+	}
+	gateways := &StateResource{Module: "module.spoke", Type: "aviatrix_spoke_gateway", Name: "gw", Mode: "managed",
+		Instances: []StateInstance{{IndexKey: "east"}, {IndexKey: "west"}, {IndexKey: "north"}}}
+	account := &StateResource{Type: "aviatrix_account", Name: "acc", Mode: "data", Instances: []StateInstance{{}}}
+	tfstate := &TerraformState{Resources: []*StateResource{vpcs, gateways, account}}
+
+	require.Equal(t, "aviatrix_vpc.a[7]", vpcs.InstanceAddr(float64(7)))
+	require.Equal(t, `module.spoke.aviatrix_spoke_gateway.gw["east"]`, gateways.InstanceAddr("east"))
+	require.Equal(t, "data.aviatrix_account.acc", account.InstanceAddr(nil))
+
+	s := sampleInstances(tfstate, true, 0, 0.1, 42)
+	require.Len(t, s.strata, 3)
+	require.Equal(t, 100, s.strata["aviatrix_vpc"].population)
+	require.Len(t, s.strata["aviatrix_vpc"].addrs, 10)
+	require.Len(t, s.strata["aviatrix_spoke_gateway"].addrs, 2)
+	require.Equal(t, []string{"data.aviatrix_account.acc"}, s.strata["data.aviatrix_account"].addrs)
+	require.Len(t, s.targets(), 13)
+
+	again := sampleInstances(tfstate, true, 0, 0.1, 42)
+	require.Equal(t, s.targets(), again.targets())
+	other := sampleInstances(tfstate, true, 0, 0.1, 43)
+	require.NotEqual(t, s.targets(), other.targets())
+
+	s = sampleInstances(tfstate, false, 5, 0, 42)
+	require.Len(t, s.strata, 2)
+	require.Len(t, s.strata["aviatrix_vpc"].addrs, 5)
+	require.Len(t, s.strata["aviatrix_spoke_gateway"].addrs, 3)
+}
+
+func TestSampleEstimate(t *testing.T) {
+	s := &instanceSample{
+		seed: 42,
+		strata: map[string]*stratum{
+			"aviatrix_vpc": {population: 10, addrs: []string{"aviatrix_vpc.a[0]", "aviatrix_vpc.a[1]", "aviatrix_vpc.a[2]", "aviatrix_vpc.a[3]"}},
+			"aws_vpc":      {population: 2, addrs: []string{"aws_vpc.b[0]", "aws_vpc.b[1]"}},
+		},
+	}
+	var samples []refreshSample
+	for i, d := range []time.Duration{1, 2, 3, 4} {
+		for it := 0; it < 2; it++ {
+			samples = append(samples, refreshSample{Addr: fmt.Sprintf("aviatrix_vpc.a[%d]", i), Type: "aviatrix_vpc", Iteration: it, Duration: d * time.Second})
+		}
+	}
+	samples = append(samples,
+		refreshSample{Addr: "aws_vpc.b[0]", Type: "aws_vpc", Iteration: 0, Duration: 9 * time.Second},
+		refreshSample{Addr: "aws_vpc.b[1]", Type: "aws_vpc", Iteration: 0, Duration: 11 * time.Second},
+	)
+	reports := groupSamples(samples, GroupByType, nil, 2)
+	sr := s.estimate(reports, samples)
+
+	require.Equal(t, 6, sr.Sampled)
+	require.Equal(t, 12, sr.Population)
+	require.Equal(t, "aviatrix_vpc", reports[0].Name)
+	require.Equal(t, 10, reports[0].Count)
+	require.Equal(t, 4, reports[0].Sampled)
+	require.Equal(t, 2500*time.Millisecond, reports[0].TotalTime)
+	// Variance 5/3 s², finite population correction 1-4/10.
+	require.InDelta(t, 0.5*float64(time.Second), float64(reports[0].StdErr), float64(time.Millisecond))
+	// Every aws_vpc was measured, so there is no sampling error.
+	require.Equal(t, 2, reports[1].Count)
+	require.Equal(t, time.Duration(0), reports[1].StdErr)
+	require.Equal(t, 25*time.Second+10*time.Second, sr.Total)
+	require.InDelta(t, 5*float64(time.Second), float64(sr.TotalStdErr), float64(time.Millisecond))
+}
+
+func TestValidateSampling(t *testing.T) {
+	require.NoError(t, (&Config{}).validateSampling(MethodTarget))
+	require.NoError(t, (&Config{Sample: 10}).validateSampling(MethodEventLog))
+	require.NoError(t, (&Config{SampleFraction: 0.1}).validateSampling(MethodEventLog))
+	require.Error(t, (&Config{Sample: -1}).validateSampling(MethodEventLog))
+	require.Error(t, (&Config{Sample: 10, SampleFraction: 0.1}).validateSampling(MethodEventLog))
+	require.Error(t, (&Config{SampleFraction: 1.5}).validateSampling(MethodEventLog))
+	require.Error(t, (&Config{Sample: 10}).validateSampling(MethodTempDir))
+	require.Error(t, (&Config{Sample: 10, GroupBy: GroupByModule}).validateSampling(MethodEventLog))
+}
@@ -0,0 +1,222 @@
+package bench
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"go.uber.org/zap"
+	"gonum.org/v1/gonum/stat"
+)
+
+// ScalingConfig describes the resource type whose refresh time is measured
+// against the number of instances refreshed.
+type ScalingConfig struct {
+	ResourceType string // ResourceType to measure, prefixed with data. for a data source
+}
+
+// ScalingReport is the refresh time of growing subsets of the instances of a
+// resource type, with linear and power-law models fitted to it.
+type ScalingReport struct {
+	Timestamp        time.Time         // Timestamp is the start of the benchmark
+	Config           *ScalingConfig    // Config that this report was generated with
+	Iterations       int               // Iterations of every subset measurement
+	Seed             int64             // Seed the order instances are added to the subsets in was shuffled with
+	TerraformVersion *TerraformVersion // TerraformVersion that is running the benchmark
+	Points           []*ScalingPoint   // Points are the measurements from the smallest subset to all instances
+	Linear           *LinearFit        // Linear is the fit of time = fixed + perInstance * count
+	PowerLaw         *PowerLawFit      // PowerLaw is the fit of time = coefficient * count^exponent
+	BuildVersion     string            // BuildVersion of tf-bench
+}
+
+// ScalingPoint is the refresh time of a subset of Count instances in every iteration.
+type ScalingPoint struct {
+	Count int
+	Times []time.Duration
+}
+
+// LinearFit is a least squares fit of refresh time as a linear function of the instance count.
+type LinearFit struct {
+	Fixed       time.Duration // Fixed is the refresh time independent of the count
+	PerInstance time.Duration // PerInstance is the refresh time added by every instance
+	RSquared    float64       // RSquared is the coefficient of determination of the fit
+}
+
+// PowerLawFit is a least squares fit of log refresh time as a linear
+// function of log instance count.
+type PowerLawFit struct {
+	Coefficient time.Duration // Coefficient is the estimated refresh time of a single instance
+	Exponent    float64       // Exponent is 1 for linear growth, above 1 when every instance costs more than the last
+	RSquared    float64       // RSquared is the coefficient of determination in log space
+}
+
+func (r *ScalingReport) String() string {
+	t := table.NewWriter()
+	t.Style().Format.Header = text.FormatDefault
+	t.AppendHeader(table.Row{"Instances", "Average Refresh Time", "Linear Model", "Power-Law Model"})
+	for _, p := range r.Points {
+		count := float64(p.Count)
+		linear := r.Linear.Fixed + time.Duration(count*float64(r.Linear.PerInstance))
+		power := time.Duration(float64(r.PowerLaw.Coefficient) * math.Pow(count, r.PowerLaw.Exponent))
+		t.AppendRow(table.Row{p.Count, averageDuration(p.Times).Round(time.Millisecond),
+			linear.Round(time.Millisecond), power.Round(time.Millisecond)})
+	}
+	if r.BuildVersion == "" {
+		r.BuildVersion = "development-build"
+	}
+	var terraformVer string
+	if r.TerraformVersion != nil {
+		terraformVer = "\n" + r.TerraformVersion.String()
+	}
+	return fmt.Sprintf(`tf-bench (%s) Scaling Report %s
+resource type: %s
+iterations per measurement: %d
+seed: %d%s
+linear model: %s fixed + %s per instance, R² %.3f
+power-law model: %s × count^%.3f, R² %.3f (log space)
+refresh time of %s grows %s with the number of instances, %s
+%s
+`, r.BuildVersion, r.Timestamp.Format(time.RFC3339Nano), r.Config.ResourceType, r.Iterations, r.Seed, terraformVer,
+		r.Linear.Fixed.Round(time.Millisecond), r.Linear.PerInstance.Round(time.Microsecond), r.Linear.RSquared,
+		r.PowerLaw.Coefficient.Round(time.Millisecond), r.PowerLaw.Exponent, r.PowerLaw.RSquared,
+		r.Config.ResourceType, r.PowerLaw.growth(), r.advice(), t.Render())
+}
+
+// growth describes how refresh time grows with the count according to the exponent.
+func (f *PowerLawFit) growth() string {
+	switch {
+	case f.Exponent < 0.9:
+		return "slower than linearly"
+	case f.Exponent <= 1.1:
+		return "about linearly"
+	}
+	return "faster than linearly"
+}
+
+// advice describes whether splitting the instances across workspaces would
+// reduce their total refresh time.
+func (r *ScalingReport) advice() string {
+	if r.PowerLaw.Exponent > 1.1 {
+		return "so splitting them across workspaces would reduce their total refresh time"
+	}
+	return fmt.Sprintf("so splitting them across workspaces would not help, and adds about %s of fixed cost per workspace",
+		r.Linear.Fixed.Round(time.Millisecond))
+}
+
+// scalingCounts returns the subset sizes 1, 2, 4 … up to and including n.
+func scalingCounts(n int) []int {
+	var counts []int
+	for c := 1; c < n; c *= 2 {
+		counts = append(counts, c)
+	}
+	if n > 0 {
+		counts = append(counts, n)
+	}
+	return counts
+}
+
+// fitScaling fits linear and power-law models to the refresh times of every
+// iteration of every point.
+func fitScaling(points []*ScalingPoint) (*LinearFit, *PowerLawFit, error) {
+	if len(points) < 2 {
+		return nil, nil, fmt.Errorf("at least two subset sizes are needed to fit a model, there is %d", len(points))
+	}
+	var xs, ys, logXs, logYs []float64
+	for _, p := range points {
+		for _, d := range p.Times {
+			xs = append(xs, float64(p.Count))
+			ys = append(ys, float64(d))
+			logXs = append(logXs, math.Log(float64(p.Count)))
+			logYs = append(logYs, math.Log(float64(d)))
+		}
+	}
+	alpha, beta := stat.LinearRegression(xs, ys, nil, false)
+	linear := &LinearFit{
+		Fixed:       time.Duration(alpha),
+		PerInstance: time.Duration(beta),
+		RSquared:    stat.RSquared(xs, ys, nil, alpha, beta),
+	}
+	alpha, beta = stat.LinearRegression(logXs, logYs, nil, false)
+	powerLaw := &PowerLawFit{
+		Coefficient: time.Duration(math.Exp(alpha)),
+		Exponent:    beta,
+		RSquared:    stat.RSquared(logXs, logYs, nil, alpha, beta),
+	}
+	return linear, powerLaw, nil
+}
+
+// scalingAddrs returns the addresses of every instance of the resource type
+// in state, in an order shuffled with seed.
+func scalingAddrs(tfstate *TerraformState, resourceType string, seed int64) []string {
+	mode := "managed"
+	if strings.HasPrefix(resourceType, "data.") {
+		mode = "data"
+		resourceType = strings.TrimPrefix(resourceType, "data.")
+	}
+	var addrs []string
+	for _, r := range tfstate.Resources {
+		if r.Mode != mode || r.Type != resourceType {
+			continue
+		}
+		for _, instance := range r.Instances {
+			addrs = append(addrs, r.InstanceAddr(instance.IndexKey))
+		}
+	}
+	sort.Strings(addrs)
+	rand.New(rand.NewSource(seed)).Shuffle(len(addrs), func(i, j int) {
+		addrs[i], addrs[j] = addrs[j], addrs[i]
+	})
+	return addrs
+}
+
+// ScalingBenchmark refreshes subsets of 1, 2, 4 … N of the N instances of the
+// resource type by targeting them, and fits models of refresh time against
+// the number of instances. Every subset contains the smaller ones.
+func ScalingBenchmark(cfg *Config, scfg *ScalingConfig, tfRunner *TerraformRunner, logger *zap.Logger) (*ScalingReport, error) {
+	if logger == nil {
+		var err error
+		logger, err = zap.NewProduction()
+		if err != nil {
+			return nil, fmt.Errorf("could not initialize logger: %w", err)
+		}
+	}
+	tfstate, _, err := terraformState(tfRunner)
+	if err != nil {
+		return nil, err
+	}
+	addrs := scalingAddrs(tfstate, scfg.ResourceType, cfg.Seed)
+	if len(addrs) < 2 {
+		return nil, fmt.Errorf("there are %d %s resources in the state file, at least two are needed to measure scaling", len(addrs), scfg.ResourceType)
+	}
+	tv, err := terraformVersion(tfRunner)
+	if err != nil {
+		fmt.Printf("WARN: Could not find terraform version: %v\n", err)
+	}
+	report := &ScalingReport{
+		Timestamp:        time.Now(),
+		Config:           scfg,
+		Iterations:       cfg.Iterations,
+		Seed:             cfg.Seed,
+		TerraformVersion: tv,
+	}
+	for _, count := range scalingCounts(len(addrs)) {
+		logger.Debug("Measuring subset", zap.Int("count", count))
+		fmt.Printf("%d of %d %s measurement:  ", count, len(addrs), scfg.ResourceType)
+		ds, _, err := measureRefresh(".", cfg.Iterations, tfRunner, nil, targetRefreshArgs(tv, cfg.VarFile, addrs[:count])...)
+		fmt.Println()
+		if err != nil {
+			return nil, fmt.Errorf("could not measure %d %s resources: %w", count, scfg.ResourceType, err)
+		}
+		report.Points = append(report.Points, &ScalingPoint{Count: count, Times: ds})
+	}
+	report.Linear, report.PowerLaw, err = fitScaling(report.Points)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
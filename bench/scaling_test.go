@@ -0,0 +1,57 @@
+package bench
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScalingCounts(t *testing.T) {
+	require.Equal(t, []int{1, 2}, scalingCounts(2))
+	require.Equal(t, []int{1, 2, 4, 5}, scalingCounts(5))
+	require.Equal(t, []int{1, 2, 4, 8}, scalingCounts(8))
+	require.Empty(t, scalingCounts(0))
+}
+
+func TestFitScaling(t *testing.T) {
+	var linearPoints, quadraticPoints []*ScalingPoint
+	for _, count := range scalingCounts(64) {
+		linearPoints = append(linearPoints, &ScalingPoint{
+			Count: count,
+			Times: []time.Duration{2*time.Second + time.Duration(count)*100*time.Millisecond},
+		})
+		quadraticPoints = append(quadraticPoints, &ScalingPoint{
+			Count: count,
+			Times: []time.Duration{time.Duration(math.Pow(float64(count), 2)) * 10 * time.Millisecond},
+		})
+	}
+	linear, powerLaw, err := fitScaling(linearPoints)
+	require.NoError(t, err)
+	require.InDelta(t, float64(2*time.Second), float64(linear.Fixed), float64(time.Millisecond))
+	require.InDelta(t, float64(100*time.Millisecond), float64(linear.PerInstance), float64(time.Millisecond))
+	require.InDelta(t, 1, linear.RSquared, 1e-9)
+	require.Less(t, powerLaw.Exponent, 1.1)
+
+	_, powerLaw, err = fitScaling(quadraticPoints)
+	require.NoError(t, err)
+	require.InDelta(t, 2, powerLaw.Exponent, 1e-9)
+	require.InDelta(t, float64(10*time.Millisecond), float64(powerLaw.Coefficient), float64(time.Microsecond))
+	require.Equal(t, "faster than linearly", powerLaw.growth())
+
+	_, _, err = fitScaling(linearPoints[:1])
+	require.Error(t, err)
+}
+
+func TestScalingAddrs(t *testing.T) {
+	tfstate := &TerraformState{Resources: []*StateResource{
+		{Type: "aviatrix_vpc", Name: "a", Mode: "managed", Instances: []StateInstance{{IndexKey: float64(0)}, {IndexKey: float64(1)}}},
+		{Module: "module.network", Type: "aviatrix_vpc", Name: "b", Mode: "managed", Instances: []StateInstance{{}}},
+		{Type: "aviatrix_vpc", Name: "c", Mode: "data", Instances: []StateInstance{{}}},
+	}}
+	addrs := scalingAddrs(tfstate, "aviatrix_vpc", 1)
+	require.ElementsMatch(t, []string{"aviatrix_vpc.a[0]", "aviatrix_vpc.a[1]", "module.network.aviatrix_vpc.b"}, addrs)
+	require.Equal(t, addrs, scalingAddrs(tfstate, "aviatrix_vpc", 1))
+	require.Equal(t, []string{"data.aviatrix_vpc.c"}, scalingAddrs(tfstate, "data.aviatrix_vpc", 1))
+}
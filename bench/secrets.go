@@ -0,0 +1,117 @@
+package bench
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// secretVariables collects provider argument values that are handed to
+// terraform through TF_VAR_ environment variables instead of being written
+// into generated configurations.
+type secretVariables struct {
+	names     []string
+	values    map[string]cty.Value
+	sensitive bool // sensitive is true when variables can be declared sensitive
+}
+
+func newSecretVariables(tv *TerraformVersion) *secretVariables {
+	return &secretVariables{
+		values:    map[string]cty.Value{},
+		sensitive: tv.coreVersion().GreaterThanOrEqual(tf14),
+	}
+}
+
+// add stores val and returns the name of the variable that holds it.
+func (s *secretVariables) add(val cty.Value) string {
+	name := fmt.Sprintf("tfbench_secret_%d", len(s.names))
+	s.names = append(s.names, name)
+	s.values[name] = val
+	return name
+}
+
+// declare appends a variable block for every collected value to body.
+func (s *secretVariables) declare(body *hclwrite.Body) {
+	for _, name := range s.names {
+		s.declareVariable(body, name)
+	}
+}
+
+// declareVariable appends the variable block of one collected value to body.
+func (s *secretVariables) declareVariable(body *hclwrite.Body, name string) {
+	block := body.AppendNewBlock("variable", []string{name})
+	block.Body().SetAttributeTraversal("type", hcl.Traversal{hcl.TraverseRoot{Name: "any"}})
+	if s.sensitive {
+		block.Body().SetAttributeValue("sensitive", cty.True)
+	}
+}
+
+// environ returns the TF_VAR_ environment variables that assign the
+// input variables of ev and the collected values. Variables left at their
+// default are not assigned, the generated configuration keeps their
+// variable blocks with the default.
+func (s *secretVariables) environ(ev *evaluator) ([]string, error) {
+	var env []string
+	var names []string
+	for name := range ev.variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v := ev.variables[name]
+		if !v.Assigned || v.Defaulted || v.Value.IsNull() {
+			continue
+		}
+		encoded, err := encodeVariableValue(v.Value, v.parsesHCL())
+		if err != nil {
+			return nil, fmt.Errorf("variable %s: %w", name, err)
+		}
+		env = append(env, "TF_VAR_"+name+"="+encoded)
+	}
+	for _, name := range s.names {
+		encoded, err := encodeVariableValue(s.values[name], true)
+		if err != nil {
+			return nil, fmt.Errorf("variable %s: %w", name, err)
+		}
+		env = append(env, "TF_VAR_"+name+"="+encoded)
+	}
+	return env, nil
+}
+
+// encodeVariableValue encodes val the way terraform parses it from a TF_VAR_
+// environment variable, as an HCL expression if parseHCL is true and as a
+// literal string otherwise.
+func encodeVariableValue(val cty.Value, parseHCL bool) (string, error) {
+	if !val.IsWhollyKnown() {
+		return "", fmt.Errorf("value is not known")
+	}
+	if parseHCL {
+		return string(hclwrite.TokensForValue(val).Bytes()), nil
+	}
+	switch val.Type() {
+	case cty.String:
+		return val.AsString(), nil
+	case cty.Number:
+		return val.AsBigFloat().Text('f', -1), nil
+	case cty.Bool:
+		if val.True() {
+			return "true", nil
+		}
+		return "false", nil
+	}
+	return "", fmt.Errorf("value of type %s cannot be passed to a variable without a type constraint", val.Type().FriendlyName())
+}
+
+// onlyInputVariables reports whether every traversal references an input variable.
+func onlyInputVariables(traversals []*hclwrite.Traversal) bool {
+	for _, traversal := range traversals {
+		tokens := traversal.BuildTokens(nil)
+		if len(tokens) == 0 || string(tokens[0].Bytes) != "var" {
+			return false
+		}
+	}
+	return true
+}
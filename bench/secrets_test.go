@@ -0,0 +1,110 @@
+package bench
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateModifiedTerraformConfigurationSecretsSafe(t *testing.T) {
+	pwd, err := os.Getwd()
+	require.NoError(t, err)
+	defer os.Chdir(pwd)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	files := map[string]string{
+		"main.tf": `
+terraform {
+  required_providers {
+    aviatrix = {
+      source = "aviatrixsystems/aviatrix"
+    }
+  }
+}
+variable "password" {}
+variable "zones" {
+  type = list(string)
+}
+locals {
+  user = "admin-${var.zones[0]}"
+}
+provider "aviatrix" {
+  controller_ip = "10.0.0.1"
+  username      = local.user
+  password      = var.password
+}
+`,
+		"terraform.tfvars": `
+password = "hunter2"
+zones    = ["a", "b"]
+`,
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(name, []byte(content), 0644))
+	}
+	p, err := parseProviderAddr(`provider["registry.terraform.io/aviatrixsystems/aviatrix"]`)
+	require.NoError(t, err)
+	resource := &Resource{Name: "aviatrix_vpc", Count: 1, Providers: []*ProviderAddr{p}}
+
+	generated, env, err := createModifiedTerraformConfiguration(resource, "", &TerraformVersion{TerraformVersion: "1.0.0"}, true)
+	require.NoError(t, err)
+	out := string(generated["main.tf"])
+	require.NotContains(t, out, "hunter2")
+	require.NotContains(t, out, "admin-a")
+	require.Contains(t, out, `controller_ip = "10.0.0.1"`)
+	require.Contains(t, out, `password      = var.password`)
+	require.Contains(t, out, `username      = var.tfbench_secret_0`)
+	require.Contains(t, out, `variable "tfbench_secret_0"`)
+	require.Contains(t, out, `sensitive = true`)
+	require.Equal(t, []string{
+		"TF_VAR_password=hunter2",
+		`TF_VAR_zones=["a", "b"]`,
+		`TF_VAR_tfbench_secret_0="admin-a"`,
+	}, env)
+
+	// Old versions cannot declare sensitive variables.
+	generated, _, err = createModifiedTerraformConfiguration(resource, "", &TerraformVersion{TerraformVersion: "0.13.7"}, true)
+	require.NoError(t, err)
+	require.NotContains(t, string(generated["main.tf"]), "sensitive")
+}
+
+func TestSecretsSafeDefaults(t *testing.T) {
+	pwd, err := os.Getwd()
+	require.NoError(t, err)
+	defer os.Chdir(pwd)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	main := `
+variable "password" {}
+variable "tags" {
+  default = {
+    team = "network"
+  }
+}
+variable "region" {
+  default = "us-east-1"
+}
+provider "aviatrix" {
+  controller_ip = "10.0.0.1"
+  username      = "admin"
+  password      = var.password
+}
+`
+	require.NoError(t, os.WriteFile("main.tf", []byte(main), 0644))
+	require.NoError(t, os.WriteFile("terraform.tfvars", []byte(`password = "hunter2"`), 0644))
+	p, err := parseProviderAddr(`provider["registry.terraform.io/aviatrixsystems/aviatrix"]`)
+	require.NoError(t, err)
+	resource := &Resource{Name: "aviatrix_vpc", Count: 1, Providers: []*ProviderAddr{p}}
+
+	// An untyped map default cannot be passed as a TF_VAR_ literal, and the
+	// generated configuration keeps the default.
+	generated, env, err := createModifiedTerraformConfiguration(resource, "", &TerraformVersion{TerraformVersion: "1.0.0"}, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"TF_VAR_password=hunter2"}, env)
+	require.Contains(t, string(generated["main.tf"]), `team = "network"`)
+
+	// A value from a var file replaces the default and is passed.
+	require.NoError(t, os.WriteFile("terraform.tfvars", []byte("password = \"hunter2\"\nregion = \"eu-west-1\""), 0644))
+	_, env, err = createModifiedTerraformConfiguration(resource, "", &TerraformVersion{TerraformVersion: "1.0.0"}, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"TF_VAR_password=hunter2", "TF_VAR_region=eu-west-1"}, env)
+}
@@ -0,0 +1,228 @@
+package bench
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/CyrusJavan/tf-bench/internal/mockprovider"
+	"github.com/CyrusJavan/tf-bench/internal/util"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"go.uber.org/zap"
+)
+
+// mockProviderSource is the source address the mock provider is overridden at.
+const mockProviderSource = "tf-bench/mock"
+
+// Tolerances of the selftest. The measured read time includes the overhead
+// of terraform and the plugin protocol on top of the mock latency.
+const (
+	selftestMeanTolerance   = 0.1
+	selftestStdDevTolerance = 0.25
+	selftestSlack           = 50 * time.Millisecond
+)
+
+// SelftestConfig describes the mock provider workspace of a selftest.
+type SelftestConfig struct {
+	MockConfig   string // MockConfig is the mock provider config file, the default config if empty
+	Count        int    // Count is the number of instances of every mock resource type
+	ProviderPath string // ProviderPath is the tf-bench binary, which serves the mock provider
+}
+
+// SelftestReport compares the measured refresh time of every mock resource
+// type with the latency it was configured with.
+type SelftestReport struct {
+	Timestamp    time.Time         // Timestamp is the start of the selftest
+	Config       *SelftestConfig   // Config that this report was generated with
+	Results      []*SelftestResult // Results of every mock resource type
+	Refresh      *RefreshReport    // Refresh is the benchmark of the mock workspace
+	BuildVersion string            // BuildVersion of tf-bench
+}
+
+// SelftestResult is the expected and measured read latency of a mock resource type.
+type SelftestResult struct {
+	ResourceType   string
+	Distribution   mockprovider.Distribution
+	ExpectedMean   time.Duration
+	ExpectedStdDev time.Duration
+	Mean           time.Duration // Mean is the TotalTime of the ResourceReport of the type
+	StdDev         time.Duration
+	Pass           bool // Pass is whether both statistics are within tolerance
+}
+
+// Pass reports whether every mock resource type was measured within tolerance.
+func (r *SelftestReport) Pass() bool {
+	for _, res := range r.Results {
+		if !res.Pass {
+			return false
+		}
+	}
+	return len(r.Results) > 0
+}
+
+func (r *SelftestReport) String() string {
+	t := table.NewWriter()
+	t.Style().Format.Header = text.FormatDefault
+	t.AppendHeader(table.Row{"Resource Type", "Distribution", "Expected Mean", "Measured Mean", "Expected Std Dev", "Measured Std Dev", "Result"})
+	for _, res := range r.Results {
+		result := "pass"
+		if !res.Pass {
+			result = "FAIL"
+		}
+		t.AppendRow(table.Row{res.ResourceType, res.Distribution,
+			res.ExpectedMean.Round(time.Millisecond), res.Mean.Round(time.Millisecond),
+			res.ExpectedStdDev.Round(time.Millisecond), res.StdDev.Round(time.Millisecond), result})
+	}
+	if r.BuildVersion == "" {
+		r.BuildVersion = "development-build"
+	}
+	mockConfig := r.Config.MockConfig
+	if mockConfig == "" {
+		mockConfig = "default"
+	}
+	result := "PASS"
+	if !r.Pass() {
+		result = "FAIL"
+	}
+	return fmt.Sprintf(`tf-bench (%s) Selftest Report %s
+mock provider config: %s
+instances per resource type: %d
+tolerance: mean within %.0f%% + %s, std dev within %.0f%% + %s
+result: %s
+%s
+
+%s`, r.BuildVersion, r.Timestamp.Format(time.RFC3339Nano), mockConfig, r.Config.Count,
+		selftestMeanTolerance*100, selftestSlack, selftestStdDevTolerance*100, selftestSlack, result, t.Render(), r.Refresh)
+}
+
+// withinTolerance reports whether measured is within the fraction tolerance
+// of expected, plus the fixed slack.
+func withinTolerance(measured, expected time.Duration, tolerance float64) bool {
+	return math.Abs(float64(measured-expected)) <= tolerance*float64(expected)+float64(selftestSlack)
+}
+
+// selftestResults compares the refresh reports of the mock resource types
+// with their configured read latency.
+func selftestResults(mockCfg *mockprovider.Config, reports []*ResourceReport) []*SelftestResult {
+	var results []*SelftestResult
+	for _, r := range mockCfg.Resources {
+		res := &SelftestResult{
+			ResourceType:   r.Type,
+			Distribution:   r.Read.Distribution,
+			ExpectedMean:   r.Read.Mean,
+			ExpectedStdDev: r.Read.StdDev,
+		}
+		for _, rr := range reports {
+			if rr.Name == r.Type {
+				res.Mean = rr.TotalTime
+				res.StdDev = rr.StdDev
+				res.Pass = withinTolerance(rr.TotalTime, r.Read.Mean, selftestMeanTolerance) &&
+					withinTolerance(rr.StdDev, r.Read.StdDev, selftestStdDevTolerance)
+			}
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// selftestWorkspace returns the configuration of count instances of every
+// mock resource type.
+func selftestWorkspace(mockCfg *mockprovider.Config, count int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `terraform {
+  required_providers {
+    mock = {
+      source = %q
+    }
+  }
+}
+`, mockProviderSource)
+	for _, r := range mockCfg.Resources {
+		fmt.Fprintf(&b, `
+resource %q "selftest" {
+  count = %d
+  name  = "selftest-${count.index}"
+}
+`, r.Type, count)
+	}
+	return b.String()
+}
+
+// Selftest creates a workspace of mock provider resources with known read
+// latencies, benchmarks it with the event log method and checks that the
+// measured statistics match the configured distributions.
+func Selftest(cfg *Config, scfg *SelftestConfig, tfRunner *TerraformRunner, logger *zap.Logger) (*SelftestReport, error) {
+	mockCfg, err := mockprovider.LoadConfig(scfg.MockConfig)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range mockCfg.Resources {
+		if r.Read.ErrorRate > 0 || r.Create.ErrorRate > 0 {
+			return nil, fmt.Errorf("resource %s has a read or create error rate, which would fail the selftest", r.Type)
+		}
+	}
+	if scfg.Count < 2 {
+		return nil, fmt.Errorf("count must be at least 2 to measure a standard deviation")
+	}
+	dir, err := util.MkdirTemp("tf-bench-selftest.")
+	if err != nil {
+		return nil, fmt.Errorf("could not create selftest workspace: %w", err)
+	}
+	defer util.RemoveTempDir(dir)
+	// The provider runs in the workspace, so it needs an absolute path
+	// to its config.
+	var mockConfigFile string
+	if scfg.MockConfig == "" {
+		mockConfigFile = filepath.Join(dir, "mock.hcl")
+		err = os.WriteFile(mockConfigFile, []byte(mockprovider.DefaultConfig), 0644)
+	} else {
+		mockConfigFile, err = filepath.Abs(scfg.MockConfig)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not write mock provider config: %w", err)
+	}
+	workspace := filepath.Join(dir, "workspace")
+	err = os.Mkdir(workspace, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("could not create selftest workspace: %w", err)
+	}
+	err = os.WriteFile(filepath.Join(workspace, "main.tf"), []byte(selftestWorkspace(mockCfg, scfg.Count)), 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not write selftest workspace: %w", err)
+	}
+	mockRunner, cleanup, err := tfRunner.withProviderOverrides([]*ProviderOverride{{Name: mockProviderSource, Path: scfg.ProviderPath}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	mockRunner = mockRunner.WithEnv(mockprovider.ConfigEnv + "=" + mockConfigFile)
+
+	pwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("could not get current working dir: %w", err)
+	}
+	err = os.Chdir(workspace)
+	if err != nil {
+		return nil, fmt.Errorf("could not change dir: %w", err)
+	}
+	defer func(dir string) {
+		_ = os.Chdir(dir)
+	}(pwd)
+	report := &SelftestReport{Timestamp: time.Now(), Config: scfg}
+	fmt.Printf("Creating %d instances of %d mock resource types\n", scfg.Count, len(mockCfg.Resources))
+	// Providers under dev_overrides need no terraform init.
+	_, err = mockRunner.Run("apply", "-auto-approve", "-input=false", fmt.Sprintf("-parallelism=%d", defaultParallelism))
+	if err != nil {
+		return nil, fmt.Errorf("terraform apply: %w", err)
+	}
+	report.Refresh, err = RefreshBenchmark(cfg, mockRunner, logger)
+	if err != nil {
+		return nil, err
+	}
+	report.Results = selftestResults(mockCfg, report.Refresh.Resources)
+	return report, nil
+}
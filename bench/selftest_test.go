@@ -0,0 +1,45 @@
+package bench
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CyrusJavan/tf-bench/internal/mockprovider"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelftestWorkspace(t *testing.T) {
+	mockCfg, err := mockprovider.LoadConfig("")
+	require.NoError(t, err)
+	src := selftestWorkspace(mockCfg, 20)
+	f, diags := hclsyntax.ParseConfig([]byte(src), "main.tf", hcl.InitialPos)
+	require.False(t, diags.HasErrors(), diags.Error())
+	blocks := f.Body.(*hclsyntax.Body).Blocks
+	require.Len(t, blocks, 4)
+	require.Equal(t, "terraform", blocks[0].Type)
+	require.Equal(t, []string{"mock_fixed", "selftest"}, blocks[1].Labels)
+	require.Contains(t, src, `source = "tf-bench/mock"`)
+}
+
+func TestSelftestResults(t *testing.T) {
+	mockCfg, err := mockprovider.LoadConfig("")
+	require.NoError(t, err)
+	reports := []*ResourceReport{
+		{Name: "mock_fixed", TotalTime: 230 * time.Millisecond, StdDev: 10 * time.Millisecond},
+		{Name: "mock_normal", TotalTime: 420 * time.Millisecond, StdDev: 55 * time.Millisecond},
+	}
+	results := selftestResults(mockCfg, reports)
+	require.Len(t, results, 3)
+	require.True(t, results[0].Pass)
+	// 420ms is more than 10% + 50ms above the mean of 300ms.
+	require.False(t, results[1].Pass)
+	require.Equal(t, 420*time.Millisecond, results[1].Mean)
+	// Resource types without a measurement fail.
+	require.False(t, results[2].Pass)
+	report := &SelftestReport{Config: &SelftestConfig{}, Results: results}
+	require.False(t, report.Pass())
+	report.Results = results[:1]
+	require.True(t, report.Pass())
+}
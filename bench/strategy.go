@@ -0,0 +1,242 @@
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/CyrusJavan/tf-bench/internal/util"
+	"go.uber.org/zap"
+)
+
+// Method selects how the refresh time of the resources in a workspace is measured.
+type Method string
+
+const (
+	MethodEventLog Method = "event-log"
+	MethodTempDir  Method = "temp-dir"
+	MethodTarget   Method = "target"
+)
+
+// ParseMethod parses the value of the --method flag.
+func ParseMethod(s string) (Method, error) {
+	switch m := Method(s); m {
+	case MethodEventLog, MethodTempDir, MethodTarget:
+		return m, nil
+	case "":
+		return MethodEventLog, nil
+	}
+	return "", fmt.Errorf("invalid method %q, must be one of event-log, temp-dir or target", s)
+}
+
+// orDefault returns m, or MethodEventLog when it is not set.
+func (m Method) orDefault() Method {
+	if m == "" {
+		return MethodEventLog
+	}
+	return m
+}
+
+// perInstance reports whether the method measures every resource instance on
+// its own, rather than all the resources of a type together.
+func (m Method) perInstance() bool {
+	return m.orDefault() == MethodEventLog
+}
+
+// measurementStrategy is a way of measuring the refresh time of the resources
+// in a workspace. Every strategy produces the same raw samples, which
+// RefreshBenchmark aggregates into a report.
+type measurementStrategy interface {
+	// Method is the value of --method that selects the strategy.
+	Method() Method
+	// measure refreshes the workspace the configured number of iterations.
+	measure(w *workspace) (*measurement, error)
+}
+
+// newMeasurementStrategy returns the strategy of the given method.
+func newMeasurementStrategy(m Method) (measurementStrategy, error) {
+	switch m.orDefault() {
+	case MethodEventLog:
+		return eventLogStrategy{}, nil
+	case MethodTempDir:
+		return tempDirStrategy{}, nil
+	case MethodTarget:
+		return targetStrategy{}, nil
+	}
+	return nil, fmt.Errorf("unknown measurement method %s", m)
+}
+
+// workspace is the workspace in the current directory being benchmarked.
+type workspace struct {
+	cfg       *Config
+	tfRunner  *TerraformRunner
+	logger    *zap.Logger
+	tfVersion *TerraformVersion
+	tfstate   *TerraformState
+	state     []byte          // state is the raw state file
+	sample    *instanceSample // sample is the sample of instances to measure, nil to measure all
+	host      *hostMonitor    // host watches the load of the host during every measured run
+}
+
+// measurement is the result of a measurementStrategy.
+type measurement struct {
+	workspace []time.Duration // workspace is the refresh time of the whole workspace in every iteration
+	usage     []*util.Usage   // usage is the CPU time and memory of the whole workspace refresh in every iteration
+	samples   []refreshSample
+	events    []*iterationEvents // events of every iteration of the event-log method
+}
+
+// measureTypes measures every resource type with measureResource. When the
+// resources of a type are in more than one module, the resources in every
+// module are measured on their own as well. The samples have the given mode.
+// Types that fail to measure are skipped, unless the host was too busy.
+func (m *measurement) measureTypes(tfstate *TerraformState, mode string, measureResource func(*Resource) ([]time.Duration, []*util.Usage, error)) error {
+	resourceTypes := tfstate.resourcesByType(mode)
+	var names []string
+	for name := range resourceTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	prefix := ""
+	if mode == "data" {
+		prefix = "data."
+	}
+	for _, name := range names {
+		resource := resourceTypes[name]
+		fmt.Printf("%s%s measurement:  ", prefix, name)
+		ds, usage, err := measureResource(resource)
+		if errors.Is(err, errBusyHost) {
+			return err
+		}
+		if err != nil {
+			fmt.Printf("During the individual resource benchmark for resourceType=%s the following error occured: %v\n", name, err)
+			continue
+		}
+		modules := tfstate.resourcesByModule(mode, name)
+		module := ""
+		if len(modules) == 1 {
+			for call := range modules {
+				module = call
+			}
+		}
+		m.add(resource, module, mode, false, ds, usage)
+		fmt.Println("average: " + averageDuration(ds).Round(time.Millisecond).String())
+		if len(modules) == 1 {
+			continue
+		}
+		// Measure the resources in every module on their own as well.
+		var calls []string
+		for call := range modules {
+			calls = append(calls, call)
+		}
+		sort.Strings(calls)
+		for _, call := range calls {
+			fmt.Printf("%s%s in %s measurement:  ", prefix, name, moduleName(call))
+			ds, usage, err := measureResource(modules[call])
+			if errors.Is(err, errBusyHost) {
+				return err
+			}
+			if err != nil {
+				fmt.Printf("During the individual resource benchmark for resourceType=%s in %s the following error occured: %v\n", name, moduleName(call), err)
+				continue
+			}
+			m.add(modules[call], call, mode, true, ds, usage)
+			fmt.Println("average: " + averageDuration(ds).Round(time.Millisecond).String())
+		}
+	}
+	return nil
+}
+
+// add records the refresh time of resource in every iteration, with the
+// usage of every iteration when it is known.
+func (m *measurement) add(resource *Resource, module, mode string, scoped bool, ds []time.Duration, usage []*util.Usage) {
+	for i, d := range ds {
+		var u *util.Usage
+		if i < len(usage) {
+			u = usage[i]
+		}
+		m.samples = append(m.samples, refreshSample{
+			Type:      resource.Name,
+			Module:    module,
+			Mode:      mode,
+			Count:     resource.Count,
+			Scoped:    scoped,
+			Iteration: i,
+			Duration:  d,
+			Usage:     u,
+		})
+	}
+}
+
+// typeSampleReports aggregates the samples of methods that measure all the
+// resources of a type together. It returns the reports of every type, and the
+// reports of the types in child modules per module.
+func typeSampleReports(samples []refreshSample) (resources, moduleResources []*ResourceReport) {
+	type key struct {
+		name   string
+		module string
+		scoped bool
+	}
+	reports := map[key]*ResourceReport{}
+	durations := map[key][]float64{}
+	usageCounts := map[key]int{}
+	var keys []key
+	for _, s := range samples {
+		k := key{name: s.name(), module: s.Module, scoped: s.Scoped}
+		rr, ok := reports[k]
+		if !ok {
+			rr = &ResourceReport{Name: k.name, Module: s.Module, Count: s.Count}
+			reports[k] = rr
+			keys = append(keys, k)
+		}
+		rr.TotalTime += s.Duration
+		durations[k] = append(durations[k], float64(s.Duration))
+		if s.Usage != nil {
+			rr.CPUTime += s.Usage.CPUTime()
+			if s.Usage.MaxRSS > rr.MaxRSS {
+				rr.MaxRSS = s.Usage.MaxRSS
+			}
+			usageCounts[k]++
+		}
+	}
+	for _, k := range keys {
+		rr := reports[k]
+		rr.TotalTime = time.Duration(int64(rr.TotalTime) / int64(len(durations[k])))
+		rr.observe(durations[k])
+		if usageCounts[k] > 0 {
+			rr.CPUTime = time.Duration(int64(rr.CPUTime) / int64(usageCounts[k]))
+		}
+		if !k.scoped {
+			resources = append(resources, rr)
+		}
+		if k.scoped || k.module != "" {
+			moduleReport := *rr
+			moduleResources = append(moduleResources, &moduleReport)
+		}
+	}
+	// Reverse sort the reports by TotalTime
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].TotalTime > resources[j].TotalTime
+	})
+	sort.Slice(moduleResources, func(i, j int) bool {
+		a, b := moduleResources[i], moduleResources[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Module < b.Module
+	})
+	return resources, moduleResources
+}
+
+// averageDuration returns the mean of ds.
+func averageDuration(ds []time.Duration) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, d := range ds {
+		total += d
+	}
+	return time.Duration(int64(total) / int64(len(ds)))
+}
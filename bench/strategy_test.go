@@ -0,0 +1,78 @@
+package bench
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CyrusJavan/tf-bench/internal/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMethod(t *testing.T) {
+	for _, s := range []string{"event-log", "temp-dir", "target"} {
+		m, err := ParseMethod(s)
+		require.NoError(t, err)
+		require.Equal(t, Method(s), m)
+		strategy, err := newMeasurementStrategy(m)
+		require.NoError(t, err)
+		require.Equal(t, m, strategy.Method())
+	}
+	m, err := ParseMethod("")
+	require.NoError(t, err)
+	require.Equal(t, MethodEventLog, m)
+	_, err = ParseMethod("apply")
+	require.Error(t, err)
+}
+
+func TestTypeSampleReports(t *testing.T) {
+	m := &measurement{}
+	vpc := &Resource{Name: "aviatrix_vpc", Count: 3}
+	m.add(vpc, "", "managed", false, []time.Duration{2 * time.Second, 4 * time.Second}, []*util.Usage{
+		{UserTime: 800 * time.Millisecond, SystemTime: 200 * time.Millisecond, MaxRSS: 100 << 20},
+		{UserTime: 2 * time.Second, MaxRSS: 300 << 20},
+	})
+	m.add(&Resource{Name: "aviatrix_vpc", Count: 1}, "", "managed", true, []time.Duration{1 * time.Second, 1 * time.Second}, nil)
+	m.add(&Resource{Name: "aviatrix_vpc", Count: 2}, "module.network", "managed", true, []time.Duration{2 * time.Second, 2 * time.Second}, nil)
+	m.add(&Resource{Name: "aws_vpc", Count: 1}, "module.network", "managed", false, []time.Duration{5 * time.Second, 5 * time.Second}, nil)
+	m.add(&Resource{Name: "aviatrix_account", Count: 1}, "", "data", false, []time.Duration{time.Second, 2 * time.Second}, nil)
+
+	resources, moduleResources := typeSampleReports(m.samples)
+	require.Len(t, resources, 3)
+	require.Equal(t, "aws_vpc", resources[0].Name)
+	require.Equal(t, "aviatrix_vpc", resources[1].Name)
+	require.Equal(t, 3, resources[1].Count)
+	require.Equal(t, 3*time.Second, resources[1].TotalTime)
+	require.Equal(t, 1500*time.Millisecond, resources[1].CPUTime)
+	require.Equal(t, int64(300<<20), resources[1].MaxRSS)
+	require.Equal(t, []time.Duration{2 * time.Second, 4 * time.Second, 4 * time.Second}, resources[1].Quantiles)
+	require.NotZero(t, resources[1].Observations)
+	require.Equal(t, time.Duration(resources[1].Observations)*resources[1].TotalTime, resources[1].ObservedTime)
+	require.Equal(t, "data.aviatrix_account", resources[2].Name)
+	require.Equal(t, 1500*time.Millisecond, resources[2].TotalTime)
+
+	require.Len(t, moduleResources, 3)
+	require.Equal(t, "", moduleResources[0].Module)
+	require.Equal(t, 1*time.Second, moduleResources[0].TotalTime)
+	require.Equal(t, "module.network", moduleResources[1].Module)
+	require.Equal(t, 2, moduleResources[1].Count)
+	require.Equal(t, "aws_vpc", moduleResources[2].Name)
+	require.Equal(t, "module.network", moduleResources[2].Module)
+}
+
+func TestTargetRefreshArgs(t *testing.T) {
+	state := &TerraformState{Resources: []*StateResource{
+		{Type: "aviatrix_vpc", Name: "a", Mode: "managed", Instances: make([]StateInstance, 2)},
+		{Module: "module.network[0]", Type: "aviatrix_vpc", Name: "b", Mode: "managed", Instances: make([]StateInstance, 1)},
+		{Type: "aviatrix_account", Name: "acc", Mode: "data", Instances: make([]StateInstance, 1)},
+	}}
+	vpc := state.resourcesByType("managed")["aviatrix_vpc"]
+	require.Equal(t, []string{"aviatrix_vpc.a", "module.network[0].aviatrix_vpc.b"}, vpc.Addrs)
+	account := state.resourcesByType("data")["aviatrix_account"]
+	require.Equal(t, []string{"data.aviatrix_account.acc"}, account.Addrs)
+
+	args := targetRefreshArgs(&TerraformVersion{TerraformVersion: "1.0.0"}, "prod.tfvars", vpc.Addrs)
+	require.Equal(t, []string{"plan", "-refresh-only", "-input=false", "-parallelism=10", "-var-file=prod.tfvars",
+		"-target=aviatrix_vpc.a", "-target=module.network[0].aviatrix_vpc.b"}, args)
+	args = targetRefreshArgs(&TerraformVersion{TerraformVersion: "0.13.7"}, "", account.Addrs)
+	require.Equal(t, []string{"refresh", "-parallelism=10", "-target=data.aviatrix_account.acc"}, args)
+}
@@ -0,0 +1,64 @@
+package bench
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/CyrusJavan/tf-bench/internal/util"
+)
+
+// targetStrategy measures every resource type in the workspace itself, with a
+// refresh that targets just the resources of that type. Terraform also
+// refreshes whatever the targeted resources depend on.
+type targetStrategy struct{}
+
+func (targetStrategy) Method() Method {
+	return MethodTarget
+}
+
+func (targetStrategy) measure(w *workspace) (*measurement, error) {
+	modes := []string{"managed"}
+	if w.cfg.DataSources {
+		modes = append(modes, "data")
+	}
+	var totalCount int
+	for _, mode := range modes {
+		for _, v := range w.tfstate.resourcesByType(mode) {
+			totalCount += v.Count
+		}
+	}
+	fmt.Printf("Found %d resources/data_sources in the state file.\n", totalCount)
+
+	fmt.Print("All resources measurement:  ")
+	ds, usage, err := measureRefresh(".", w.cfg.Iterations, w.tfRunner, w.host, targetRefreshArgs(w.tfVersion, w.cfg.VarFile, nil)...)
+	if err != nil {
+		return nil, fmt.Errorf("could not measure refresh for workspace: %w", err)
+	}
+	fmt.Println()
+	m := &measurement{workspace: ds, usage: usage}
+	for _, mode := range modes {
+		err = m.measureTypes(w.tfstate, mode, func(resource *Resource) ([]time.Duration, []*util.Usage, error) {
+			return measureRefresh(".", w.cfg.Iterations, w.tfRunner, w.host, targetRefreshArgs(w.tfVersion, w.cfg.VarFile, resource.Addrs)...)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// targetRefreshArgs returns the arguments of a refresh of the resources with
+// the given addresses, or of the whole workspace when there are none. A
+// refresh-only plan is used when the engine supports it, as it does not
+// write the refreshed state.
+func targetRefreshArgs(tv *TerraformVersion, varFile string, addrs []string) []string {
+	args := refreshArgs(varFile)
+	if tv.SupportsEventLog() {
+		// Refresh-only plans arrived in the same release as the event log.
+		args = append([]string{"plan", "-refresh-only", "-input=false"}, args[1:]...)
+	}
+	for _, addr := range addrs {
+		args = append(args, "-target="+addr)
+	}
+	return args
+}
@@ -0,0 +1,231 @@
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/CyrusJavan/tf-bench/internal/util"
+	"github.com/hashicorp/go-version"
+)
+
+// Engine is the flavor of Terraform compatible binary that runs a benchmark.
+type Engine string
+
+const (
+	EngineTerraform Engine = "terraform"
+	EngineOpenTofu  Engine = "opentofu"
+)
+
+var (
+	tf12    = version.Must(version.NewVersion("v0.12"))
+	tf14    = version.Must(version.NewVersion("v0.14"))
+	tf15    = version.Must(version.NewVersion("v0.15"))
+	tf154   = version.Must(version.NewVersion("v0.15.4"))
+	tofu160 = version.Must(version.NewVersion("v1.6.0"))
+)
+
+type TerraformRunner struct {
+	execPath string
+	env      []string
+}
+
+// NewTerraformRunner returns a TerraformRunner that executes the binary at execPath.
+func NewTerraformRunner(execPath string) *TerraformRunner {
+	return &TerraformRunner{execPath: execPath}
+}
+
+// FindTerraform returns a TerraformRunner for the binary named by execPath.
+// When execPath is empty the first of `terraform` or `tofu` found on PATH is used.
+func FindTerraform(execPath string) (*TerraformRunner, error) {
+	if execPath != "" {
+		p, err := exec.LookPath(execPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not find terraform binary %s: %w", execPath, err)
+		}
+		return NewTerraformRunner(p), nil
+	}
+	for _, name := range []string{"terraform", "tofu"} {
+		if p, err := exec.LookPath(name); err == nil {
+			return NewTerraformRunner(p), nil
+		}
+	}
+	return nil, fmt.Errorf("could not find `terraform` or `tofu` on PATH, set --terraform-bin to the binary to benchmark with")
+}
+
+// ExecPath is the path of the binary this runner executes.
+func (tr *TerraformRunner) ExecPath() string {
+	return tr.execPath
+}
+
+// WithEnv returns a copy of the runner that adds env to the environment of
+// every command it runs.
+func (tr *TerraformRunner) WithEnv(env ...string) *TerraformRunner {
+	return &TerraformRunner{
+		execPath: tr.execPath,
+		env:      append(append([]string{}, tr.env...), env...),
+	}
+}
+
+func (tr *TerraformRunner) Run(arg ...string) ([]byte, error) {
+	return util.RunCommandWithEnv(tr.env, tr.execPath, arg...)
+}
+
+// RunWithUsage is Run that also returns the CPU time and memory used by
+// terraform and its provider processes.
+func (tr *TerraformRunner) RunWithUsage(arg ...string) ([]byte, *util.Usage, error) {
+	return util.RunCommandWithUsage("", tr.env, tr.execPath, arg...)
+}
+
+// RunAsync starts terraform and returns its stdout, and a function that waits
+// for it to finish and returns the CPU time and memory it used.
+func (tr *TerraformRunner) RunAsync(arg ...string) (io.Reader, func() (*util.Usage, error), error) {
+	c := tr.command(arg...)
+	pipe, err := c.StdoutPipe()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not get StdoutPipe of command: %w", err)
+	}
+	m, err := util.StartMonitored(c)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not start command: %w", err)
+	}
+	return pipe, m.Wait, nil
+}
+
+// command returns the exec.Cmd to run terraform with the runner's environment.
+func (tr *TerraformRunner) command(arg ...string) *exec.Cmd {
+	c := exec.Command(tr.execPath, arg...)
+	if len(tr.env) > 0 {
+		c.Env = append(os.Environ(), tr.env...)
+	}
+	return c
+}
+
+var SystemTerraform = &TerraformRunner{execPath: "terraform"}
+
+type TerraformVersion struct {
+	Engine             Engine            `json:"engine"`
+	TerraformVersion   string            `json:"terraform_version"`
+	ProviderSelections map[string]string `json:"provider_selections"`
+}
+
+// coreVersion returns the Terraform version whose features the engine
+// supports. Every OpenTofu release is a fork of at least Terraform v1.6.
+func (tv *TerraformVersion) coreVersion() *version.Version {
+	if tv == nil {
+		return tf12
+	}
+	v, err := version.NewVersion(tv.TerraformVersion)
+	if err != nil {
+		return tf12
+	}
+	if tv.Engine == EngineOpenTofu && v.LessThan(tofu160) {
+		return tofu160
+	}
+	return v
+}
+
+// SupportsEventLog reports whether the engine can produce the JSON event log
+// used by the event log measurement method.
+func (tv *TerraformVersion) SupportsEventLog() bool {
+	if tv == nil {
+		return true
+	}
+	if _, err := version.NewVersion(tv.TerraformVersion); err != nil {
+		return true
+	}
+	return tv.coreVersion().GreaterThanOrEqual(tf154)
+}
+
+// String returns the engine and version, for example "opentofu version: v1.6.2".
+func (tv *TerraformVersion) String() string {
+	engine := tv.Engine
+	if engine == "" {
+		engine = EngineTerraform
+	}
+	return fmt.Sprintf("%s version: v%s", engine, tv.TerraformVersion)
+}
+
+var (
+	simpleVersionRe = `v?(?P<version>[0-9]+(?:\.[0-9]+)*(?:-[A-Za-z0-9\.]+)?)`
+
+	versionOutputRe         = regexp.MustCompile(`^(?:Terraform|OpenTofu) ` + simpleVersionRe)
+	providerVersionOutputRe = regexp.MustCompile(`(\n\+ provider[\. ](?P<name>\S+) ` + simpleVersionRe + `)`)
+)
+
+func terraformVersion(tfRunner *TerraformRunner) (*TerraformVersion, error) {
+	out, err := tfRunner.Run("version", "-json")
+	if err != nil {
+		return nil, fmt.Errorf("running terraform version -json command: %w", err)
+	}
+	var tv TerraformVersion
+	err = json.Unmarshal(out, &tv)
+	if err != nil {
+		// Couldn't unmarshal, could be on old Terraform that does not
+		// support -json output.
+		v, pv, err := parseOldVersionOutput(string(out))
+		if err != nil {
+			return nil, fmt.Errorf("parsing terraform version output: %w", err)
+		}
+		pvs := map[string]string{}
+		for k, v := range pv {
+			pvs[k] = v.String()
+		}
+		tv = TerraformVersion{
+			TerraformVersion:   v.String(),
+			ProviderSelections: pvs,
+		}
+	}
+	// The JSON output is identical between engines, only the human
+	// readable output names the engine.
+	out, err = tfRunner.Run("version")
+	if err != nil {
+		return nil, fmt.Errorf("running terraform version command: %w", err)
+	}
+	tv.Engine = detectEngine(string(out))
+	return &tv, nil
+}
+
+// detectEngine determines the engine from the output of the version command.
+func detectEngine(stdout string) Engine {
+	if strings.HasPrefix(strings.TrimSpace(stdout), "OpenTofu") {
+		return EngineOpenTofu
+	}
+	return EngineTerraform
+}
+
+// From: github.com/hashicorp/terraform-exec/tfexec/version.go
+func parseOldVersionOutput(stdout string) (*version.Version, map[string]*version.Version, error) {
+	stdout = strings.TrimSpace(stdout)
+
+	submatches := versionOutputRe.FindStringSubmatch(stdout)
+	if len(submatches) != 2 {
+		return nil, nil, fmt.Errorf("unexpected number of version matches %d for %s", len(submatches), stdout)
+	}
+	v, err := version.NewVersion(submatches[1])
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to parse version %q: %w", submatches[1], err)
+	}
+
+	allSubmatches := providerVersionOutputRe.FindAllStringSubmatch(stdout, -1)
+	provV := map[string]*version.Version{}
+
+	for _, submatches := range allSubmatches {
+		if len(submatches) != 4 {
+			return nil, nil, fmt.Errorf("unexpected number of providerion version matches %d for %s", len(submatches), stdout)
+		}
+
+		v, err := version.NewVersion(submatches[3])
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to parse provider version %q: %w", submatches[3], err)
+		}
+
+		provV[submatches[2]] = v
+	}
+
+	return v, provV, err
+}
@@ -0,0 +1,80 @@
+package bench
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTerraformVersionEngine(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake terraform binary is a shell script")
+	}
+	tt := []struct {
+		name             string
+		jsonOutput       string
+		textOutput       string
+		engine           Engine
+		version          string
+		supportsEventLog bool
+	}{
+		{
+			name:             "terraform v1.0.0",
+			jsonOutput:       `{"terraform_version":"1.0.0","provider_selections":{"registry.terraform.io/hashicorp/random":"3.1.0"}}`,
+			textOutput:       "Terraform v1.0.0\non linux_amd64",
+			engine:           EngineTerraform,
+			version:          "1.0.0",
+			supportsEventLog: true,
+		},
+		{
+			name:             "terraform v0.15.3",
+			jsonOutput:       `{"terraform_version":"0.15.3","provider_selections":{}}`,
+			textOutput:       "Terraform v0.15.3\non linux_amd64",
+			engine:           EngineTerraform,
+			version:          "0.15.3",
+			supportsEventLog: false,
+		},
+		{
+			name:             "terraform v0.12.31 without -json support",
+			jsonOutput:       "Terraform v0.12.31\n+ provider.random v3.1.0",
+			textOutput:       "Terraform v0.12.31\n+ provider.random v3.1.0",
+			engine:           EngineTerraform,
+			version:          "0.12.31",
+			supportsEventLog: false,
+		},
+		{
+			name:             "opentofu v1.6.2",
+			jsonOutput:       `{"terraform_version":"1.6.2","platform":"linux_amd64","provider_selections":{},"terraform_outdated":false}`,
+			textOutput:       "OpenTofu v1.6.2\non linux_amd64",
+			engine:           EngineOpenTofu,
+			version:          "1.6.2",
+			supportsEventLog: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			tfRunner := fakeTerraform(t, fmt.Sprintf(`if [ "$2" = "-json" ]; then
+  printf '%%s\n' '%s'
+else
+  printf '%%s\n' '%s'
+fi`, tc.jsonOutput, tc.textOutput))
+			tv, err := terraformVersion(tfRunner)
+			require.NoError(t, err)
+			require.Equal(t, tc.engine, tv.Engine)
+			require.Equal(t, tc.version, tv.TerraformVersion)
+			require.Equal(t, tc.supportsEventLog, tv.SupportsEventLog())
+		})
+	}
+}
+
+// fakeTerraform returns a TerraformRunner for a shell script with the given body.
+func fakeTerraform(t *testing.T, body string) *TerraformRunner {
+	execPath := filepath.Join(t.TempDir(), "terraform")
+	err := os.WriteFile(execPath, []byte("#!/bin/sh\n"+body+"\n"), 0755)
+	require.NoError(t, err)
+	return NewTerraformRunner(execPath)
+}
@@ -0,0 +1,332 @@
+package bench
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// traceTimeLayout is the timestamp format of terraform log lines.
+const traceTimeLayout = "2006-01-02T15:04:05.000Z0700"
+
+// traceLinePattern matches a terraform log line such as
+// 2021-06-01T10:00:00.123-0700 [TRACE] provider: plugin started: path=… pid=123
+var traceLinePattern = regexp.MustCompile(`^(\S+) \[(TRACE|DEBUG|INFO|WARN|ERROR)\] (.*)$`)
+
+// traceFieldPattern matches the key=value fields of a log line, with
+// optionally quoted values.
+var traceFieldPattern = regexp.MustCompile(`(?:^|\s)([@\w.]+)=("(?:[^"\\]|\\.)*"|\S*)`)
+
+// traceLine is a parsed line of the terraform log.
+type traceLine struct {
+	Time    time.Time
+	Message string // Message is the text before the first field
+	Fields  map[string]string
+}
+
+// parseTraceLine parses a line of the terraform log. Lines that continue a
+// multi-line entry have no timestamp and are not parsed.
+func parseTraceLine(line string) (traceLine, bool) {
+	m := traceLinePattern.FindStringSubmatch(strings.TrimRight(line, "\r\n"))
+	if m == nil {
+		return traceLine{}, false
+	}
+	t, err := time.Parse(traceTimeLayout, m[1])
+	if err != nil {
+		return traceLine{}, false
+	}
+	tl := traceLine{Time: t, Message: m[3], Fields: map[string]string{}}
+	rest := m[3]
+	if loc := traceFieldPattern.FindStringIndex(rest); loc != nil {
+		tl.Message = strings.TrimSpace(rest[:loc[0]])
+	}
+	for _, f := range traceFieldPattern.FindAllStringSubmatch(rest, -1) {
+		value := f[2]
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		tl.Fields[f[1]] = value
+	}
+	return tl, true
+}
+
+// pluginName returns the name of the plugin that wrote a line relayed from
+// its stderr, for example terraform-provider-aws_v3.0.0_x5 for
+// "provider.terraform-provider-aws_v3.0.0_x5: plugin address:".
+func (tl traceLine) pluginName() string {
+	if !strings.HasPrefix(tl.Message, "provider.") {
+		return ""
+	}
+	i := strings.Index(tl.Message, ": ")
+	if i == -1 {
+		return ""
+	}
+	return tl.Message[len("provider."):i]
+}
+
+// providerTime returns when a provider wrote a line relayed from its stderr.
+// Terraform stamps relayed lines with the time it read them, which lags behind
+// when the provider is busy, so the timestamp field of the provider is used
+// when there is one.
+func (tl traceLine) providerTime() time.Time {
+	ts := tl.Fields["timestamp"]
+	if ts == "" {
+		return tl.Time
+	}
+	for _, layout := range []string{time.RFC3339Nano, traceTimeLayout} {
+		if t, err := time.Parse(layout, ts); err == nil {
+			return t
+		}
+	}
+	return tl.Time
+}
+
+// rpcCall is a provider gRPC call timed from the log of the provider.
+type rpcCall struct {
+	RPC          string
+	ResourceType string // ResourceType is the resource or data source type, empty for provider calls
+	Start        time.Time
+	Duration     time.Duration
+}
+
+// traceAnalysis is what the terraform log tells about the providers.
+type traceAnalysis struct {
+	providerStarts []time.Duration
+	calls          []rpcCall
+}
+
+// analyzeTrace reads the terraform log and times provider process startups,
+// from starting the plugin until it is listening, and the gRPC calls logged by
+// providers built with terraform-plugin-go, which log every request they
+// receive and serve with its id. Lines of providers are timed by the provider
+// itself, see providerTime.
+func analyzeTrace(r io.Reader) (*traceAnalysis, error) {
+	a := &traceAnalysis{}
+	type start struct {
+		name string
+		time time.Time
+	}
+	var starts []start
+	var ready []start
+	var using []time.Time
+	received := map[string]rpcCall{}
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if tl, ok := parseTraceLine(line); ok {
+			switch {
+			case strings.HasSuffix(tl.Message, "starting plugin:") && tl.Fields["path"] != "":
+				starts = append(starts, start{name: filepath.Base(tl.Fields["path"]), time: tl.Time})
+			case strings.HasSuffix(tl.Message, "plugin address:") && tl.pluginName() != "":
+				ready = append(ready, start{name: tl.pluginName(), time: tl.providerTime()})
+			case strings.HasSuffix(tl.Message, "using plugin:"):
+				using = append(using, tl.Time)
+			case strings.HasSuffix(tl.Message, "Received request:") && tl.Fields["tf_req_id"] != "":
+				resourceType := tl.Fields["tf_resource_type"]
+				if resourceType == "" {
+					resourceType = tl.Fields["tf_data_source_type"]
+				}
+				received[tl.Fields["tf_req_id"]] = rpcCall{RPC: tl.Fields["tf_rpc"], ResourceType: resourceType, Start: tl.providerTime()}
+			case strings.HasSuffix(tl.Message, "Served request:") && tl.Fields["tf_req_id"] != "":
+				call, ok := received[tl.Fields["tf_req_id"]]
+				if !ok {
+					break
+				}
+				delete(received, tl.Fields["tf_req_id"])
+				call.Duration = tl.providerTime().Sub(call.Start)
+				a.calls = append(a.calls, call)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read terraform log: %w", err)
+		}
+	}
+	// Plugins log their address when they are listening. Without those
+	// lines, the handshake completing in order is the best there is.
+	if len(ready) > 0 {
+		used := make([]bool, len(ready))
+		for _, s := range starts {
+			for i, r := range ready {
+				if !used[i] && r.name == s.name && !r.time.Before(s.time) {
+					used[i] = true
+					a.providerStarts = append(a.providerStarts, r.time.Sub(s.time))
+					break
+				}
+			}
+		}
+	} else {
+		for i := 0; i < len(starts) && i < len(using); i++ {
+			a.providerStarts = append(a.providerStarts, using[i].Sub(starts[i].time))
+		}
+	}
+	sort.SliceStable(a.calls, func(i, j int) bool {
+		return a.calls[i].Start.Before(a.calls[j].Start)
+	})
+	return a, nil
+}
+
+// readTraceReport analyzes the terraform log written to path during the
+// measurement.
+func readTraceReport(path string, samples []refreshSample, reports []*ResourceReport) (*TraceReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open terraform log: %w", err)
+	}
+	defer f.Close()
+	a, err := analyzeTrace(f)
+	if err != nil {
+		return nil, err
+	}
+	return a.traceReport(samples, reports), nil
+}
+
+// TraceReport breaks refresh time down into provider startup, schema
+// loading, the gRPC calls to the provider and the overhead of terraform core.
+type TraceReport struct {
+	ProviderStarts    int                // ProviderStarts is the number of provider processes started
+	ProviderStartTime time.Duration      // ProviderStartTime is the average time until a provider process is listening
+	SchemaLoads       int                // SchemaLoads is the number of GetProviderSchema calls
+	SchemaLoadTime    time.Duration      // SchemaLoadTime is the average time of a GetProviderSchema call
+	Calls             map[string]int     // Calls is the number of calls of every gRPC method
+	Types             []*TraceTypeReport // Types in the order of the resource reports
+}
+
+// TraceTypeReport breaks the refresh time of a resource type down into its
+// gRPC call and the rest, which is spent in terraform core.
+type TraceTypeReport struct {
+	Name        string
+	Refreshes   int           // Refreshes of instances of the type over all iterations
+	Matched     int           // Matched is the number of refreshes a gRPC call was found for
+	RefreshTime time.Duration // RefreshTime is the average refresh time of the matched refreshes
+	GRPCTime    time.Duration // GRPCTime is the average time of the ReadResource or ReadDataSource call
+}
+
+// CoreOverhead is the part of the refresh time spent outside the provider.
+func (r *TraceTypeReport) CoreOverhead() time.Duration {
+	if r.GRPCTime > r.RefreshTime {
+		return 0
+	}
+	return r.RefreshTime - r.GRPCTime
+}
+
+// readRPC is the gRPC method that refreshes a sample.
+func (s refreshSample) readRPC() string {
+	if s.Mode == "data" {
+		return "ReadDataSource"
+	}
+	return "ReadResource"
+}
+
+// traceReport matches every refresh with the first read call of its type that
+// started during it, and averages the breakdown per resource type.
+func (a *traceAnalysis) traceReport(samples []refreshSample, reports []*ResourceReport) *TraceReport {
+	report := &TraceReport{ProviderStarts: len(a.providerStarts), Calls: map[string]int{}}
+	report.ProviderStartTime = averageDuration(a.providerStarts)
+	var schemaLoads []time.Duration
+	for _, c := range a.calls {
+		report.Calls[c.RPC]++
+		if c.RPC == "GetProviderSchema" {
+			schemaLoads = append(schemaLoads, c.Duration)
+		}
+	}
+	report.SchemaLoads = len(schemaLoads)
+	report.SchemaLoadTime = averageDuration(schemaLoads)
+
+	sorted := append([]refreshSample{}, samples...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Start.Before(sorted[j].Start)
+	})
+	used := make([]bool, len(a.calls))
+	types := map[string]*TraceTypeReport{}
+	var refreshTimes, grpcTimes = map[string][]time.Duration{}, map[string][]time.Duration{}
+	for _, s := range sorted {
+		name := s.name()
+		tr, ok := types[name]
+		if !ok {
+			tr = &TraceTypeReport{Name: name}
+			types[name] = tr
+		}
+		tr.Refreshes++
+		end := s.Start.Add(s.Duration)
+		for i, c := range a.calls {
+			if c.Start.After(end) {
+				break
+			}
+			if used[i] || c.Start.Before(s.Start) || c.RPC != s.readRPC() || c.ResourceType != s.Type {
+				continue
+			}
+			used[i] = true
+			tr.Matched++
+			refreshTimes[name] = append(refreshTimes[name], s.Duration)
+			grpcTimes[name] = append(grpcTimes[name], c.Duration)
+			break
+		}
+	}
+	for name, tr := range types {
+		tr.RefreshTime = averageDuration(refreshTimes[name])
+		tr.GRPCTime = averageDuration(grpcTimes[name])
+	}
+	// Follow the order of the refresh report, which is sorted by refresh time.
+	for _, rr := range reports {
+		if tr, ok := types[rr.Name]; ok {
+			report.Types = append(report.Types, tr)
+			delete(types, rr.Name)
+		}
+	}
+	var rest []string
+	for name := range types {
+		rest = append(rest, name)
+	}
+	sort.Strings(rest)
+	for _, name := range rest {
+		report.Types = append(report.Types, types[name])
+	}
+	return report
+}
+
+func (r *TraceReport) String() string {
+	t := table.NewWriter()
+	t.Style().Format.Header = text.FormatDefault
+	t.AppendHeader(table.Row{"Resource Type", "Refreshes", "Matched gRPC Calls", "Average Refresh Time", "gRPC Call Time", "Core Overhead"})
+	for _, tr := range r.Types {
+		if tr.Matched == 0 {
+			t.AppendRow(table.Row{tr.Name, tr.Refreshes, 0, "-", "-", "-"})
+			continue
+		}
+		t.AppendRow(table.Row{tr.Name, tr.Refreshes, tr.Matched, tr.RefreshTime.Round(time.Millisecond),
+			tr.GRPCTime.Round(time.Millisecond), tr.CoreOverhead().Round(time.Millisecond)})
+	}
+	var rpcs []string
+	for rpc := range r.Calls {
+		rpcs = append(rpcs, rpc)
+	}
+	sort.Strings(rpcs)
+	var calls []string
+	for _, rpc := range rpcs {
+		calls = append(calls, fmt.Sprintf("%s=%d", rpc, r.Calls[rpc]))
+	}
+	callSummary := strings.Join(calls, ", ")
+	if callSummary == "" {
+		callSummary = "none logged, the providers may be too old to log their requests"
+	}
+	return fmt.Sprintf(`Trace log breakdown (TF_LOG=trace slows terraform down, compare times within this table):
+provider processes started: %d, average %s until listening
+provider schema loads: %d, average %s
+provider gRPC calls: %s
+%s
+`, r.ProviderStarts, r.ProviderStartTime.Round(time.Millisecond), r.SchemaLoads, r.SchemaLoadTime.Round(time.Millisecond),
+		callSummary, t.Render())
+}
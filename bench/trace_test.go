@@ -0,0 +1,98 @@
+package bench
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testTraceLog = `2021-06-01T10:00:00.000Z [INFO]  Terraform version: 1.0.0
+2021-06-01T10:00:00.100Z [DEBUG] provider: starting plugin: path=.terraform/providers/registry.terraform.io/aviatrixsystems/aviatrix/2.19.0/linux_amd64/terraform-provider-aviatrix_v2.19.0 args=[.terraform/providers/registry.terraform.io/aviatrixsystems/aviatrix/2.19.0/linux_amd64/terraform-provider-aviatrix_v2.19.0]
+2021-06-01T10:00:00.120Z [DEBUG] provider: plugin started: path=.terraform/providers/registry.terraform.io/aviatrixsystems/aviatrix/2.19.0/linux_amd64/terraform-provider-aviatrix_v2.19.0 pid=1234
+2021-06-01T10:00:00.400Z [INFO]  provider.terraform-provider-aviatrix_v2.19.0: configuring server automatic mTLS: timestamp=2021-06-01T10:00:00.400Z
+2021-06-01T10:00:00.450Z [DEBUG] provider.terraform-provider-aviatrix_v2.19.0: plugin address: address=/tmp/plugin123 network=unix timestamp=2021-06-01T10:00:00.450Z
+2021-06-01T10:00:00.460Z [DEBUG] provider: using plugin: version=5
+2021-06-01T10:00:00.500Z [TRACE] provider.terraform-provider-aviatrix_v2.19.0: Received request: tf_req_id=1 tf_rpc=GetProviderSchema tf_proto_version=5.2 @module=sdk.proto
+2021-06-01T10:00:00.580Z [TRACE] provider.terraform-provider-aviatrix_v2.19.0: Served request: tf_req_id=1 tf_rpc=GetProviderSchema tf_proto_version=5.2 @module=sdk.proto
+2021-06-01T10:00:01.010Z [TRACE] provider.terraform-provider-aviatrix_v2.19.0: Received request: tf_req_id=2 tf_rpc=ReadResource tf_resource_type=aviatrix_vpc @caller="/go/pkg/mod/server.go:742"
+2021-06-01T10:00:01.020Z [TRACE] provider.terraform-provider-aviatrix_v2.19.0: Received request: tf_req_id=3 tf_rpc=ReadResource tf_resource_type=aviatrix_vpc
+2021-06-01T10:00:01.300Z [TRACE] provider.terraform-provider-aviatrix_v2.19.0: Served request: tf_req_id=3 tf_rpc=ReadResource tf_resource_type=aviatrix_vpc
+2021-06-01T10:00:01.410Z [TRACE] provider.terraform-provider-aviatrix_v2.19.0: Served request: tf_req_id=2 tf_rpc=ReadResource tf_resource_type=aviatrix_vpc
+  continuation of a multi-line entry
+2021-06-01T10:00:02.050Z [TRACE] provider.terraform-provider-aviatrix_v2.19.0: Received request: tf_req_id=4 tf_rpc=ReadDataSource tf_data_source_type=aviatrix_account
+2021-06-01T10:00:02.250Z [TRACE] provider.terraform-provider-aviatrix_v2.19.0: Served request: tf_req_id=4 tf_rpc=ReadDataSource tf_data_source_type=aviatrix_account
+2021-06-01T10:00:03.000Z [TRACE] provider.terraform-provider-aviatrix_v2.19.0: Received request: tf_req_id=5 tf_rpc=StopProvider`
+
+func TestParseTraceLine(t *testing.T) {
+	tl, ok := parseTraceLine(`2021-06-01T10:00:00.450-0700 [DEBUG] provider.terraform-provider-aws: plugin address: address=/tmp/plugin123 msg="quoted value" empty=` + "\n")
+	require.True(t, ok)
+	require.Equal(t, time.Date(2021, 6, 1, 17, 0, 0, 450000000, time.UTC), tl.Time.UTC())
+	require.Equal(t, "provider.terraform-provider-aws: plugin address:", tl.Message)
+	require.Equal(t, map[string]string{"address": "/tmp/plugin123", "msg": "quoted value", "empty": ""}, tl.Fields)
+	require.Equal(t, "terraform-provider-aws", tl.pluginName())
+
+	_, ok = parseTraceLine("  continuation of a multi-line entry")
+	require.False(t, ok)
+}
+
+func TestTraceProviderTime(t *testing.T) {
+	// Terraform relays the lines of a busy provider late, the timestamp field
+	// is when the provider wrote them.
+	const log = `2021-06-01T10:00:01.300Z [TRACE] provider.terraform-provider-aviatrix_v2.19.0: Received request: tf_req_id=2 tf_rpc=ReadResource tf_resource_type=aviatrix_vpc timestamp=2021-06-01T10:00:01.010Z
+2021-06-01T10:00:01.310Z [TRACE] provider.terraform-provider-aviatrix_v2.19.0: Served request: tf_req_id=2 tf_rpc=ReadResource tf_resource_type=aviatrix_vpc timestamp="2021-06-01T10:00:01.250-0000"
+2021-06-01T10:00:02.000Z [TRACE] provider.terraform-provider-aviatrix_v2.19.0: Received request: tf_req_id=3 tf_rpc=ReadResource tf_resource_type=aviatrix_vpc timestamp=invalid
+2021-06-01T10:00:02.100Z [TRACE] provider.terraform-provider-aviatrix_v2.19.0: Served request: tf_req_id=3 tf_rpc=ReadResource tf_resource_type=aviatrix_vpc`
+	a, err := analyzeTrace(strings.NewReader(log))
+	require.NoError(t, err)
+	require.Len(t, a.calls, 2)
+	require.Equal(t, time.Date(2021, 6, 1, 10, 0, 1, 10000000, time.UTC), a.calls[0].Start.UTC())
+	require.Equal(t, 240*time.Millisecond, a.calls[0].Duration)
+	require.Equal(t, time.Date(2021, 6, 1, 10, 0, 2, 0, time.UTC), a.calls[1].Start.UTC())
+	require.Equal(t, 100*time.Millisecond, a.calls[1].Duration)
+}
+
+func TestTraceReport(t *testing.T) {
+	a, err := analyzeTrace(strings.NewReader(testTraceLog))
+	require.NoError(t, err)
+	require.Equal(t, []time.Duration{350 * time.Millisecond}, a.providerStarts)
+	require.Len(t, a.calls, 4)
+
+	t0 := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time {
+		return t0.Add(time.Duration(ms) * time.Millisecond)
+	}
+	samples := []refreshSample{
+		{Addr: "aviatrix_vpc.a", Type: "aviatrix_vpc", Mode: "managed", Start: at(1000), Duration: 500 * time.Millisecond},
+		{Addr: "aviatrix_vpc.b", Type: "aviatrix_vpc", Mode: "managed", Start: at(1015), Duration: 300 * time.Millisecond},
+		{Addr: "data.aviatrix_account.acc", Type: "aviatrix_account", Mode: "data", Start: at(2000), Duration: 300 * time.Millisecond},
+		{Addr: "aviatrix_gateway.gw", Type: "aviatrix_gateway", Mode: "managed", Start: at(2500), Duration: 100 * time.Millisecond},
+	}
+	report := a.traceReport(samples, []*ResourceReport{{Name: "data.aviatrix_account"}, {Name: "aviatrix_vpc"}})
+	require.Equal(t, 1, report.ProviderStarts)
+	require.Equal(t, 350*time.Millisecond, report.ProviderStartTime)
+	require.Equal(t, 1, report.SchemaLoads)
+	require.Equal(t, 80*time.Millisecond, report.SchemaLoadTime)
+	require.Equal(t, map[string]int{"GetProviderSchema": 1, "ReadResource": 2, "ReadDataSource": 1}, report.Calls)
+	require.Len(t, report.Types, 3)
+
+	account := report.Types[0]
+	require.Equal(t, "data.aviatrix_account", account.Name)
+	require.Equal(t, 1, account.Matched)
+	require.Equal(t, 200*time.Millisecond, account.GRPCTime)
+	require.Equal(t, 100*time.Millisecond, account.CoreOverhead())
+
+	vpc := report.Types[1]
+	require.Equal(t, "aviatrix_vpc", vpc.Name)
+	require.Equal(t, 2, vpc.Refreshes)
+	require.Equal(t, 2, vpc.Matched)
+	require.Equal(t, 400*time.Millisecond, vpc.RefreshTime)
+	require.Equal(t, 340*time.Millisecond, vpc.GRPCTime)
+	require.Equal(t, 60*time.Millisecond, vpc.CoreOverhead())
+
+	gateway := report.Types[2]
+	require.Equal(t, "aviatrix_gateway", gateway.Name)
+	require.Equal(t, 0, gateway.Matched)
+	require.Contains(t, report.String(), "provider processes started: 1, average 350ms until listening")
+}
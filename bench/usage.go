@@ -0,0 +1,97 @@
+package bench
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/CyrusJavan/tf-bench/internal/util"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// UsageReport is the CPU time and memory used while refreshing the whole
+// workspace, from the rusage of terraform and samples of its child processes.
+type UsageReport struct {
+	Iterations int                   // Iterations the usage is known for
+	UserTime   time.Duration         // UserTime is the average per iteration, including the providers terraform waited for
+	SystemTime time.Duration         // SystemTime is the average per iteration, including the providers terraform waited for
+	MaxRSS     int64                 // MaxRSS is the peak memory in bytes of terraform or its largest provider
+	Processes  []*ProcessUsageReport // Processes are the child processes of terraform by name, sorted by CPU time
+}
+
+// ProcessUsageReport is the usage of the child processes of terraform with
+// the same name, such as the processes of a provider.
+type ProcessUsageReport struct {
+	Name      string
+	Processes float64       // Processes is the average number of processes per iteration
+	CPUTime   time.Duration // CPUTime is the average per iteration of all the processes
+	MaxRSS    int64         // MaxRSS is the peak memory in bytes of any of the processes
+}
+
+// CPUTime is the average user and system CPU time per iteration.
+func (r *UsageReport) CPUTime() time.Duration {
+	return r.UserTime + r.SystemTime
+}
+
+// newUsageReport aggregates the usage of every iteration, nil when it is
+// unknown.
+func newUsageReport(usage []*util.Usage) *UsageReport {
+	if len(usage) == 0 {
+		return nil
+	}
+	report := &UsageReport{Iterations: len(usage)}
+	processes := map[string]*ProcessUsageReport{}
+	for _, u := range usage {
+		report.UserTime += u.UserTime
+		report.SystemTime += u.SystemTime
+		if u.MaxRSS > report.MaxRSS {
+			report.MaxRSS = u.MaxRSS
+		}
+		for _, c := range u.Children {
+			pr, ok := processes[c.Name]
+			if !ok {
+				pr = &ProcessUsageReport{Name: c.Name}
+				processes[c.Name] = pr
+				report.Processes = append(report.Processes, pr)
+			}
+			pr.Processes++
+			pr.CPUTime += c.CPUTime
+			if c.MaxRSS > pr.MaxRSS {
+				pr.MaxRSS = c.MaxRSS
+			}
+		}
+	}
+	n := time.Duration(len(usage))
+	report.UserTime /= n
+	report.SystemTime /= n
+	for _, pr := range report.Processes {
+		pr.Processes /= float64(len(usage))
+		pr.CPUTime /= n
+	}
+	sort.SliceStable(report.Processes, func(i, j int) bool {
+		return report.Processes[i].CPUTime > report.Processes[j].CPUTime
+	})
+	return report
+}
+
+// summary is the workspace usage printed under the workspace refresh time.
+func (r *UsageReport) summary() string {
+	return fmt.Sprintf("\nCPU Time: %s (user %s, system %s)\nPeak Memory: %s", r.CPUTime().Round(time.Millisecond),
+		r.UserTime.Round(time.Millisecond), r.SystemTime.Round(time.Millisecond), util.FormatBytes(r.MaxRSS))
+}
+
+func (r *UsageReport) String() string {
+	if len(r.Processes) == 0 {
+		return ""
+	}
+	t := table.NewWriter()
+	t.Style().Format.Header = text.FormatDefault
+	t.AppendHeader(table.Row{"Process", "Processes Per Iteration", "CPU Time Per Iteration", "Peak Memory"})
+	for _, pr := range r.Processes {
+		t.AppendRow(table.Row{pr.Name, fmt.Sprintf("%.1f", pr.Processes), pr.CPUTime.Round(time.Millisecond), util.FormatBytes(pr.MaxRSS)})
+	}
+	return fmt.Sprintf(`Child processes of terraform, sampled every %s:
+%s
+`, util.ChildSampleInterval, t.Render())
+}
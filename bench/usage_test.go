@@ -0,0 +1,42 @@
+package bench
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CyrusJavan/tf-bench/internal/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageReport(t *testing.T) {
+	require.Nil(t, newUsageReport(nil))
+	report := newUsageReport([]*util.Usage{
+		{UserTime: 3 * time.Second, SystemTime: time.Second, MaxRSS: 200 << 20, Children: []*util.ChildUsage{
+			{PID: 10, Name: "terraform-provider-aviatrix_v2.19.0", CPUTime: 2 * time.Second, MaxRSS: 80 << 20},
+			{PID: 11, Name: "terraform-provider-aws_v3.0.0_x5", CPUTime: 500 * time.Millisecond, MaxRSS: 150 << 20},
+			{PID: 12, Name: "terraform-provider-aws_v3.0.0_x5", CPUTime: 500 * time.Millisecond, MaxRSS: 120 << 20},
+		}},
+		{UserTime: 5 * time.Second, SystemTime: time.Second, MaxRSS: 300 << 20, Children: []*util.ChildUsage{
+			{PID: 20, Name: "terraform-provider-aviatrix_v2.19.0", CPUTime: 4 * time.Second, MaxRSS: 90 << 20},
+		}},
+	})
+	require.Equal(t, 2, report.Iterations)
+	require.Equal(t, 4*time.Second, report.UserTime)
+	require.Equal(t, 5*time.Second, report.CPUTime())
+	require.Equal(t, int64(300<<20), report.MaxRSS)
+	require.Len(t, report.Processes, 2)
+
+	aviatrix := report.Processes[0]
+	require.Equal(t, "terraform-provider-aviatrix_v2.19.0", aviatrix.Name)
+	require.Equal(t, 1.0, aviatrix.Processes)
+	require.Equal(t, 3*time.Second, aviatrix.CPUTime)
+	require.Equal(t, int64(90<<20), aviatrix.MaxRSS)
+
+	aws := report.Processes[1]
+	require.Equal(t, 1.0, aws.Processes)
+	require.Equal(t, 500*time.Millisecond, aws.CPUTime)
+	require.Equal(t, int64(150<<20), aws.MaxRSS)
+
+	require.Equal(t, "\nCPU Time: 5s (user 4s, system 1s)\nPeak Memory: 300.0MiB", report.summary())
+	require.Contains(t, report.String(), "terraform-provider-aws_v3.0.0_x5")
+}
@@ -2,12 +2,9 @@ package cmd
 
 import (
 	"fmt"
-	"os"
-	"time"
 
 	"github.com/CyrusJavan/tf-bench/bench"
 	"github.com/spf13/cobra"
-	"go.uber.org/zap"
 )
 
 var applyCmd = &cobra.Command{
@@ -23,37 +20,20 @@ func applyRun(cmd *cobra.Command, args []string) error {
 		VarFile:               VarFile,
 	}
 	fmt.Printf("Starting benchmark with configuration=%+v\n", cfg)
-	var logger *zap.Logger
-	var err error
-	if Verbose {
-		logger, err = zap.NewDevelopment()
-		if err != nil {
-			return fmt.Errorf("could not initialize verbose logger: %w", err)
-		}
-	} else {
-		logger, err = zap.NewProduction()
-		if err != nil {
-			return fmt.Errorf("could not initialize production logger: %w", err)
-		}
-	}
-	report, err := bench.ApplyBenchmark(cfg, bench.SystemTerraform, logger)
+	logger, err := newLogger()
 	if err != nil {
 		return err
 	}
-	if version == "" {
-		version = "development-build"
+	tfRunner, err := bench.FindTerraform(TerraformBin)
+	if err != nil {
+		return err
 	}
-	report.BuildVersion = version
-	reportString := report.String()
-	fmt.Println(reportString)
-	// Save report to file as well
-	filename := "tf-bench-apply-report-" + report.Timestamp.Format(time.RFC3339)
-	err = os.WriteFile(filename, []byte(reportString), 0644)
+	report, err := bench.ApplyBenchmark(cfg, tfRunner, logger)
 	if err != nil {
-		return fmt.Errorf("could not write report to file. The report has also been output to the console please recover the report from there: %w", err)
+		return err
 	}
-	fmt.Printf("Wrote report to file %s\n", filename)
-	return nil
+	report.BuildVersion = buildVersion()
+	return writeReport("apply", report.Timestamp, report.String())
 }
 
 func applyPreRun(cmd *cobra.Command, args []string) error {
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/CyrusJavan/tf-bench/bench"
+	"github.com/spf13/cobra"
+)
+
+var bisectCmd = &cobra.Command{
+	Use:   "bisect",
+	Short: "Find the provider commit that slowed down refresh of a resource type",
+	Long: `
+Binary search the history of a provider repository for the first
+commit whose refresh time of a resource type crosses a threshold.
+At each step the provider is built with go build and benchmarked
+in place of the released provider.
+`,
+	RunE:    bisectRun,
+	PreRunE: bisectPreRun,
+}
+
+func bisectRun(cmd *cobra.Command, args []string) error {
+	threshold, err := bench.ParseThreshold(BisectThreshold)
+	if err != nil {
+		return err
+	}
+	cfg := &bench.Config{
+		SkipControllerVersion: true,
+		Iterations:            Iterations,
+		VarFile:               VarFile,
+		SecretsSafe:           SecretsSafe,
+	}
+	bcfg := &bench.BisectConfig{
+		ProviderRepo: BisectProviderRepo,
+		Good:         BisectGood,
+		Bad:          BisectBad,
+		ResourceType: BisectResourceType,
+		Provider:     BisectProvider,
+		Threshold:    threshold,
+	}
+	fmt.Printf("Starting bisect with configuration=%+v\n", bcfg)
+	logger, err := newLogger()
+	if err != nil {
+		return err
+	}
+	tfRunner, err := bench.FindTerraform(TerraformBin)
+	if err != nil {
+		return err
+	}
+	result, err := bench.Bisect(cfg, bcfg, tfRunner, logger)
+	if err != nil {
+		return err
+	}
+	result.BuildVersion = buildVersion()
+	return writeReport("bisect", result.Timestamp, result.String())
+}
+
+func bisectPreRun(cmd *cobra.Command, args []string) error {
+	if _, err := bench.ParseThreshold(BisectThreshold); err != nil {
+		return err
+	}
+	return validateEnv(true)
+}
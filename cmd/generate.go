@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/CyrusJavan/tf-bench/bench"
+	"github.com/spf13/cobra"
+)
+
+var generateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate a synthetic workspace and measure its refresh performance",
+	Long: `
+Write a workspace with a given number of resources of one type, from a
+built-in template or a template file with a resource block in which
+${index} is replaced with the index of every resource. Then run
+terraform init and apply in it, and benchmark it.
+`,
+	RunE:    generateRun,
+	PreRunE: generatePreRun,
+}
+
+func generateRun(cmd *cobra.Command, args []string) error {
+	method, err := measurementMethod(cmd)
+	if err != nil {
+		return err
+	}
+	groupBy, err := bench.ParseGroupBy(GroupBy)
+	if err != nil {
+		return err
+	}
+	// The generated workspace declares no variables, so --var-file is not
+	// passed to it.
+	cfg := &bench.Config{
+		SkipControllerVersion: true,
+		Iterations:            Iterations,
+		MaxLoad:               MaxLoad,
+		MaxSteal:              MaxSteal,
+		AbortOnNoise:          AbortOnNoise,
+		Method:                method,
+		GroupBy:               groupBy,
+		DataSources:           DataSources,
+	}
+	gcfg := &bench.GenerateConfig{
+		ResourceType: GenerateResourceType,
+		Count:        GenerateCount,
+		Template:     GenerateTemplate,
+		Out:          GenerateOut,
+	}
+	fmt.Printf("Starting generated benchmark with configuration=%+v\n", gcfg)
+	logger, err := newLogger()
+	if err != nil {
+		return err
+	}
+	tfRunner, err := bench.FindTerraform(TerraformBin)
+	if err != nil {
+		return err
+	}
+	report, err := bench.GenerateBenchmark(cfg, gcfg, tfRunner, logger)
+	if err != nil {
+		return err
+	}
+	report.BuildVersion = buildVersion()
+	err = writeReport("generate", report.Timestamp, report.String())
+	if err != nil {
+		return err
+	}
+	recordHistory(report, GenerateOut, nil)
+	return nil
+}
+
+func generatePreRun(cmd *cobra.Command, args []string) error {
+	if GenerateResourceType == "" && GenerateTemplate == "" {
+		return fmt.Errorf("set --type, --template or both")
+	}
+	if _, err := measurementMethod(cmd); err != nil {
+		return err
+	}
+	if _, err := bench.ParseGroupBy(GroupBy); err != nil {
+		return err
+	}
+	return validateEnv(true)
+}
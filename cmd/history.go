@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/CyrusJavan/tf-bench/bench"
+	"github.com/CyrusJavan/tf-bench/internal/history"
+	"github.com/spf13/cobra"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List, show and follow the trend of past benchmark runs",
+	Long: `
+Every refresh report is recorded in the history, by default in
+~/.tf-bench/history, labeled with its workspace fingerprint and the git
+commit and branch of the workspace.
+`,
+}
+
+var historyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the runs in the history",
+	Args:  cobra.NoArgs,
+	RunE:  historyListRun,
+}
+
+var historyShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Print the report of a run in the history, by its ID or a unique prefix of it",
+	Args:  cobra.ExactArgs(1),
+	RunE:  historyShowRun,
+}
+
+var historyTrendCmd = &cobra.Command{
+	Use:   "trend",
+	Short: "Print the refresh time of a resource type over the runs of a workspace and flag when it shifted",
+	Args:  cobra.NoArgs,
+	RunE:  historyTrendRun,
+}
+
+// openHistory opens the --history-dir, or the default history.
+func openHistory() (*history.Store, error) {
+	dir := HistoryDir
+	if dir == "" {
+		var err error
+		dir, err = history.DefaultDir()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return history.Open(dir)
+}
+
+// recordHistory appends a report of the workspace in dir, the current
+// directory when dir is empty, to the history unless --no-history is set.
+// Failing to record is only a warning, the report is already written.
+func recordHistory(report *bench.RefreshReport, dir string, labels map[string]string) {
+	if NoHistory {
+		return
+	}
+	store, err := openHistory()
+	if err != nil {
+		fmt.Printf("WARN: Could not record run in history: %v\n", err)
+		return
+	}
+	report.BuildVersion = buildVersion()
+	run := bench.NewHistoryRun(report, dir, labels)
+	err = store.Append(run)
+	if err != nil {
+		fmt.Printf("WARN: Could not record run in history: %v\n", err)
+		return
+	}
+	fmt.Printf("Recorded run %s in history.\n", run.ID)
+}
+
+// recordComparison appends every report of a comparison to the history,
+// labeled with the condition it was taken under.
+func recordComparison(comparison *bench.Comparison) {
+	for i, report := range comparison.Reports {
+		recordHistory(report, "", map[string]string{bench.LabelCondition: comparison.Labels[i]})
+	}
+}
+
+// historyWorkspace returns the --workspace flag as an absolute path, the
+// current directory when it is not set.
+func historyWorkspace() (string, error) {
+	if HistoryWorkspace == "" {
+		return os.Getwd()
+	}
+	return filepath.Abs(HistoryWorkspace)
+}
+
+// workspaceRuns returns the runs of the --workspace, or of every workspace
+// with --all-workspaces.
+func workspaceRuns(store *history.Store) ([]*history.Run, error) {
+	runs, err := store.Runs()
+	if err != nil {
+		return nil, err
+	}
+	if HistoryAllWorkspaces {
+		return runs, nil
+	}
+	dir, err := historyWorkspace()
+	if err != nil {
+		return nil, err
+	}
+	var filtered []*history.Run
+	for _, run := range runs {
+		if run.Labels[bench.LabelWorkspace] == dir {
+			filtered = append(filtered, run)
+		}
+	}
+	return filtered, nil
+}
+
+func historyListRun(cmd *cobra.Command, args []string) error {
+	store, err := openHistory()
+	if err != nil {
+		return err
+	}
+	runs, err := workspaceRuns(store)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		fmt.Println("No runs in the history of this workspace. Use --all-workspaces to list every run.")
+		return nil
+	}
+	fmt.Println(bench.HistoryList(runs))
+	return nil
+}
+
+func historyShowRun(cmd *cobra.Command, args []string) error {
+	store, err := openHistory()
+	if err != nil {
+		return err
+	}
+	run, err := store.Run(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Println(run.Report)
+	return nil
+}
+
+func historyTrendRun(cmd *cobra.Command, args []string) error {
+	store, err := openHistory()
+	if err != nil {
+		return err
+	}
+	runs, err := workspaceRuns(store)
+	if err != nil {
+		return err
+	}
+	trend, err := bench.HistoryTrend(runs, HistoryResourceType, HistoryCondition, HistoryThreshold)
+	if err != nil {
+		return err
+	}
+	fmt.Print(trend.String())
+	return nil
+}
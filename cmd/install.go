@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/CyrusJavan/tf-bench/bench"
+	"github.com/spf13/cobra"
+)
+
+var installCmd = &cobra.Command{
+	Use:   "install <version>",
+	Short: "Install a terraform release from a local release archive",
+	Long: `
+Install a terraform release for use with tf-bench matrix.
+The release zip is verified against the SHA256SUMS file
+published with the release before it is installed into ~/.tf-bench.
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: installRun,
+}
+
+func installRun(cmd *cobra.Command, args []string) error {
+	tfRunner, err := bench.InstallTerraform(args[0], InstallFrom, InstallSHA256Sums)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Installed terraform v%s to %s\n", args[0], tfRunner.ExecPath())
+	return nil
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/CyrusJavan/tf-bench/bench"
+	"github.com/spf13/cobra"
+)
+
+var matrixCmd = &cobra.Command{
+	Use:     "matrix",
+	Short:   "Compare refresh performance across terraform versions",
+	RunE:    matrixRun,
+	PreRunE: matrixPreRun,
+}
+
+func matrixRun(cmd *cobra.Command, args []string) error {
+	method, err := measurementMethod(cmd)
+	if err != nil {
+		return err
+	}
+	groupBy, err := bench.ParseGroupBy(GroupBy)
+	if err != nil {
+		return err
+	}
+	fc, err := fileConfig()
+	if err != nil {
+		return err
+	}
+	cfg := &bench.Config{
+		SkipControllerVersion: SkipControllerVersion,
+		Iterations:            Iterations,
+		MaxLoad:               MaxLoad,
+		MaxSteal:              MaxSteal,
+		AbortOnNoise:          AbortOnNoise,
+		VarFile:               VarFile,
+		SecretsSafe:           SecretsSafe,
+		Method:                method,
+		GroupBy:               groupBy,
+		DataSources:           DataSources,
+		Sample:                Sample,
+		SampleFraction:        SampleFraction,
+		Seed:                  sampleSeed(cmd),
+		Groups:                fc.Groups,
+	}
+	fmt.Printf("Starting benchmark with configuration=%+v terraform versions=%v\n", cfg, TerraformVersions)
+	logger, err := newLogger()
+	if err != nil {
+		return err
+	}
+	comparison, err := bench.MatrixBenchmark(cfg, TerraformVersions, logger)
+	if err != nil {
+		return err
+	}
+	comparison.BuildVersion = buildVersion()
+	err = writeReport("matrix", comparison.Timestamp, comparison.String())
+	if err != nil {
+		return err
+	}
+	recordComparison(comparison)
+	return nil
+}
+
+func matrixPreRun(cmd *cobra.Command, args []string) error {
+	if _, err := measurementMethod(cmd); err != nil {
+		return err
+	}
+	if _, err := bench.ParseGroupBy(GroupBy); err != nil {
+		return err
+	}
+	if _, err := fileConfig(); err != nil {
+		return err
+	}
+	for _, v := range TerraformVersions {
+		if _, err := bench.TerraformAtVersion(v); err != nil {
+			return err
+		}
+	}
+	return validateControllerEnv(SkipControllerVersion)
+}
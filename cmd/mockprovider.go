@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/CyrusJavan/tf-bench/internal/mockprovider"
+	"github.com/spf13/cobra"
+)
+
+var mockProviderCmd = &cobra.Command{
+	Use:   "mock-provider",
+	Short: "Serve a terraform provider whose resources have configurable latencies",
+	Long: `
+Serve the mock terraform provider. Its resource types, and the
+distributions of the latency and error rate of their reads, creates and
+deletes, are read from the file in the ` + mockprovider.ConfigEnv + `
+environment variable, or a default config without it.
+
+Terraform starts it through dev_overrides, with the tf-bench binary linked
+as terraform-provider-mock.
+`,
+	RunE: mockProviderRun,
+}
+
+func mockProviderRun(cmd *cobra.Command, args []string) error {
+	return serveMockProvider()
+}
+
+// serveMockProvider serves the mock provider with the config from the environment.
+func serveMockProvider() error {
+	cfg, err := mockprovider.LoadConfig(os.Getenv(mockprovider.ConfigEnv))
+	if err != nil {
+		return err
+	}
+	return mockprovider.Serve(cfg)
+}
+
+// isMockProvider reports whether tf-bench was started by terraform as the
+// mock provider, through a link named after the provider.
+func isMockProvider() bool {
+	return strings.HasPrefix(filepath.Base(os.Args[0]), "terraform-provider-mock")
+}
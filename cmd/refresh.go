@@ -3,12 +3,12 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"time"
+	"strings"
 
 	"github.com/CyrusJavan/tf-bench/bench"
-	"github.com/CyrusJavan/tf-bench/internal/util"
+	"github.com/CyrusJavan/tf-bench/internal/otlp"
+	"github.com/CyrusJavan/tf-bench/internal/proxy"
 	"github.com/spf13/cobra"
-	"go.uber.org/zap"
 )
 
 var refreshCmd = &cobra.Command{
@@ -19,57 +19,243 @@ var refreshCmd = &cobra.Command{
 }
 
 func refreshRun(cmd *cobra.Command, args []string) error {
+	method, err := measurementMethod(cmd)
+	if err != nil {
+		return err
+	}
+	groupBy, err := bench.ParseGroupBy(GroupBy)
+	if err != nil {
+		return err
+	}
+	fc, err := fileConfig()
+	if err != nil {
+		return err
+	}
 	cfg := &bench.Config{
 		SkipControllerVersion: SkipControllerVersion,
 		Iterations:            Iterations,
+		MaxLoad:               MaxLoad,
+		MaxSteal:              MaxSteal,
+		AbortOnNoise:          AbortOnNoise,
 		VarFile:               VarFile,
-		EventLog:              EventLog,
+		SecretsSafe:           SecretsSafe,
+		Method:                method,
+		GroupBy:               groupBy,
+		DataSources:           DataSources,
+		Sample:                Sample,
+		SampleFraction:        SampleFraction,
+		Seed:                  sampleSeed(cmd),
+		Groups:                fc.Groups,
+		APIProxy:              APIProxy,
+		APIProxyInsecure:      APIProxyInsecure,
+		TraceLog:              TraceLog,
 	}
 	fmt.Printf("Starting benchmark with configuration=%+v\n", cfg)
-	var logger *zap.Logger
-	var err error
-	if Verbose {
-		logger, err = zap.NewDevelopment()
+	logger, err := newLogger()
+	if err != nil {
+		return err
+	}
+	tfRunner, err := bench.FindTerraform(TerraformBin)
+	if err != nil {
+		return err
+	}
+	faults, err := injectedFaults(cmd)
+	if err != nil {
+		return err
+	}
+	if len(faults) > 0 {
+		comparison, err := bench.FaultInjectionBenchmark(cfg, tfRunner, faults, logger)
+		if err != nil {
+			return err
+		}
+		comparison.BuildVersion = buildVersion()
+		err = writeReport("fault-injection", comparison.Timestamp, comparison.String())
 		if err != nil {
-			return fmt.Errorf("could not initialize verbose logger: %w", err)
+			return err
 		}
-	} else {
-		logger, err = zap.NewProduction()
+		recordComparison(comparison)
+		exportComparison(comparison)
+		return nil
+	}
+	if len(ProviderOverrides) > 0 {
+		overrides, err := providerOverrides()
+		if err != nil {
+			return err
+		}
+		comparison, err := bench.ProviderOverrideBenchmark(cfg, tfRunner, overrides, logger)
+		if err != nil {
+			return err
+		}
+		comparison.BuildVersion = buildVersion()
+		err = writeReport("provider-override", comparison.Timestamp, comparison.String())
 		if err != nil {
-			return fmt.Errorf("could not initialize production logger: %w", err)
+			return err
 		}
+		recordComparison(comparison)
+		exportComparison(comparison)
+		return nil
 	}
-	report, err := bench.RefreshBenchmark(cfg, bench.SystemTerraform, logger)
+	report, err := bench.RefreshBenchmark(cfg, tfRunner, logger)
 	if err != nil {
 		return err
 	}
-	if version == "" {
-		version = "development-build"
-	}
-	report.BuildVersion = version
-	reportString := report.String()
-	fmt.Println(reportString)
-	// Save report to file as well
-	filename := "tf-bench-refresh-report-" + report.Timestamp.Format(time.RFC3339)
-	err = os.WriteFile(filename, []byte(reportString), 0644)
+	report.BuildVersion = buildVersion()
+	err = writeReport("refresh", report.Timestamp, report.String())
 	if err != nil {
-		return fmt.Errorf("could not write report to file. The report has also been output to the console please recover the report from there: %w", err)
+		return err
 	}
-	fmt.Printf("Wrote report to file %s\n", filename)
+	recordHistory(report, "", nil)
+	exportTrace(report, "")
 	return nil
 }
 
 func refreshPreRun(cmd *cobra.Command, args []string) error {
+	method, err := measurementMethod(cmd)
+	if err != nil {
+		return err
+	}
+	if APIProxy && method != bench.MethodEventLog {
+		return fmt.Errorf("--api-proxy requires --method=event-log")
+	}
+	if TraceLog && method != bench.MethodEventLog {
+		return fmt.Errorf("--trace-log requires --method=event-log")
+	}
+	if err := validateOTLP(method); err != nil {
+		return err
+	}
+	if _, err := bench.ParseGroupBy(GroupBy); err != nil {
+		return err
+	}
+	if _, err := fileConfig(); err != nil {
+		return err
+	}
+	if _, err := providerOverrides(); err != nil {
+		return err
+	}
+	faults, err := injectedFaults(cmd)
+	if err != nil {
+		return err
+	}
+	if len(faults) > 0 && len(ProviderOverrides) > 0 {
+		return fmt.Errorf("fault injection can not be combined with --provider-override")
+	}
+	if APIProxy || len(faults) > 0 {
+		if err := proxy.Supported(); err != nil {
+			return err
+		}
+	}
 	return validateEnv(SkipControllerVersion)
 }
 
+// providerOverrides parses the --provider-override flags.
+func providerOverrides() ([]*bench.ProviderOverride, error) {
+	var overrides []*bench.ProviderOverride
+	for _, s := range ProviderOverrides {
+		o, err := bench.ParseProviderOverride(s)
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, o)
+	}
+	return overrides, nil
+}
+
+// otlpExporter returns the exporter to --otlp-endpoint with the --otlp-header
+// headers, nil when no endpoint is set.
+func otlpExporter() (*otlp.Exporter, error) {
+	if OTLPEndpoint == "" {
+		return nil, nil
+	}
+	headers := map[string]string{}
+	for _, h := range OTLPHeaders {
+		i := strings.Index(h, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid --otlp-header %q, must be in the form key=value", h)
+		}
+		headers[strings.TrimSpace(h[:i])] = strings.TrimSpace(h[i+1:])
+	}
+	return otlp.NewExporter(OTLPEndpoint, headers)
+}
+
+// validateOTLP checks the --otlp-endpoint and --otlp-header flags.
+func validateOTLP(method bench.Method) error {
+	if OTLPEndpoint != "" && method != bench.MethodEventLog {
+		return fmt.Errorf("--otlp-endpoint requires --method=event-log")
+	}
+	_, err := otlpExporter()
+	return err
+}
+
+// exportTrace exports a report as a trace when --otlp-endpoint is set.
+// Failing to export is only a warning, the report is already written.
+func exportTrace(report *bench.RefreshReport, condition string) {
+	exporter, err := otlpExporter()
+	if exporter == nil && err == nil {
+		return
+	}
+	if err == nil {
+		report.BuildVersion = buildVersion()
+		var id otlp.TraceID
+		id, err = report.ExportTrace(exporter, condition)
+		if err == nil {
+			fmt.Printf("Exported trace %s to %s\n", id, OTLPEndpoint)
+			return
+		}
+	}
+	fmt.Printf("WARN: Could not export trace: %v\n", err)
+}
+
+// exportComparison exports every report of a comparison as a trace, with the
+// condition it was taken under.
+func exportComparison(comparison *bench.Comparison) {
+	for i, report := range comparison.Reports {
+		exportTrace(report, comparison.Labels[i])
+	}
+}
+
+// injectedFaults parses the --inject-rule flags, followed by a rule for every
+// host from the --inject-latency, --inject-jitter and --inject-error-rate flags.
+func injectedFaults(cmd *cobra.Command) ([]*proxy.Fault, error) {
+	var faults []*proxy.Fault
+	for _, s := range InjectRules {
+		f, err := proxy.ParseFault(s)
+		if err != nil {
+			return nil, err
+		}
+		faults = append(faults, f)
+	}
+	flags := cmd.Flags()
+	if flags.Changed("inject-latency") || flags.Changed("inject-jitter") || flags.Changed("inject-error-rate") {
+		f := &proxy.Fault{
+			Latency:   InjectLatency,
+			Jitter:    InjectJitter,
+			ErrorRate: InjectErrorRate,
+			Status:    InjectStatus,
+		}
+		if err := f.Validate(); err != nil {
+			return nil, err
+		}
+		faults = append(faults, f)
+	}
+	return faults, nil
+}
+
 // validateEnv checks if we can run a benchmark.
 func validateEnv(skipControllerVersion bool) error {
 	// Must be able to execute terraform binary
-	_, err := util.RunCommand("terraform", "-help")
+	tfRunner, err := bench.FindTerraform(TerraformBin)
 	if err != nil {
-		return fmt.Errorf("could not execute `terraform` command")
+		return err
+	}
+	_, err = tfRunner.Run("version")
+	if err != nil {
+		return fmt.Errorf("could not execute `%s` command", tfRunner.ExecPath())
 	}
+	return validateControllerEnv(skipControllerVersion)
+}
+
+// validateControllerEnv checks if we can include the controller version in the report.
+func validateControllerEnv(skipControllerVersion bool) error {
 	// Need Aviatrix environment variables as well if not skipping controller version
 	if !skipControllerVersion {
 		requiredEnvVars := []string{
@@ -1,7 +1,17 @@
 package cmd
 
 import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/CyrusJavan/tf-bench/bench"
+	"github.com/CyrusJavan/tf-bench/internal/history"
+	"github.com/CyrusJavan/tf-bench/internal/util"
 	"github.com/spf13/cobra"
+	"go.uber.org/zap"
 )
 
 var (
@@ -9,15 +19,71 @@ var (
 	Iterations            int
 	VarFile               string
 	EventLog              bool
+	Method                string
 	Verbose               bool
+	TerraformBin          string
+	SecretsSafe           bool
+	GroupBy               string
+	DataSources           bool
+	Sample                int
+	SampleFraction        float64
+	Seed                  int64
+	ConfigFile            string
+	TerraformVersions     []string
+	InstallFrom           string
+	InstallSHA256Sums     string
+	ProviderOverrides     []string
+	BisectProviderRepo    string
+	BisectGood            string
+	BisectBad             string
+	BisectResourceType    string
+	BisectProvider        string
+	BisectThreshold       string
+	ScalingResourceType   string
+	GenerateResourceType  string
+	GenerateCount         int
+	GenerateTemplate      string
+	GenerateOut           string
+	SelftestMockConfig    string
+	APIProxy              bool
+	APIProxyInsecure      bool
+	TraceLog              bool
+	MaxLoad               float64
+	MaxSteal              float64
+	AbortOnNoise          bool
+	HistoryDir            string
+	NoHistory             bool
+	HistoryWorkspace      string
+	HistoryAllWorkspaces  bool
+	HistoryResourceType   string
+	HistoryThreshold      float64
+	HistoryCondition      string
+	ServeInterval         time.Duration
+	ServeListen           string
+	OTLPEndpoint          string
+	OTLPHeaders           []string
+	InjectLatency         time.Duration
+	InjectJitter          time.Duration
+	InjectErrorRate       float64
+	InjectStatus          int
+	InjectRules           []string
+	SelftestCount         int
 	version               string
 )
 
 func init() {
 	// Global flags
-	rootCmd.Flags().BoolVar(&SkipControllerVersion, "skip-controller-version", false, "Skip adding controller version to generated report")
-	rootCmd.Flags().BoolVarP(&Verbose, "verbose", "v", false, "Enable debug logging")
-	rootCmd.Flags().StringVar(&VarFile, "var-file", "", "var-file to pass to terraform commands")
+	rootCmd.PersistentFlags().BoolVar(&SkipControllerVersion, "skip-controller-version", false, "Skip adding controller version to generated report")
+	rootCmd.PersistentFlags().BoolVarP(&Verbose, "verbose", "v", false, "Enable debug logging")
+	rootCmd.PersistentFlags().StringVar(&VarFile, "var-file", "", "var-file to pass to terraform commands")
+	rootCmd.PersistentFlags().StringVar(&TerraformBin, "terraform-bin", "", "Terraform or OpenTofu binary to benchmark with. Defaults to terraform or tofu found on PATH")
+	rootCmd.PersistentFlags().StringVar(&ConfigFile, "config", "", "tf-bench config file. Defaults to "+bench.DefaultConfigFile+" in the workspace if it exists")
+	rootCmd.PersistentFlags().Float64Var(&MaxLoad, "max-load", 1, "Load average per CPU above which the host is too busy to benchmark. 0 disables the check")
+	rootCmd.PersistentFlags().Float64Var(&MaxSteal, "max-steal", 5, "Percentage of CPU time stolen by the hypervisor above which the host is too busy to benchmark. 0 disables the check")
+	rootCmd.PersistentFlags().BoolVar(&AbortOnNoise, "abort-on-noise", false, "Abort instead of warning when the host is too busy to benchmark")
+	rootCmd.PersistentFlags().StringVar(&HistoryDir, "history-dir", "", "Directory of the benchmark history. Defaults to ~/.tf-bench/history")
+	rootCmd.PersistentFlags().BoolVar(&NoHistory, "no-history", false, "Do not record refresh reports in the history")
+	rootCmd.PersistentFlags().BoolVar(&SecretsSafe, "secrets-safe", false, "Pass provider arguments to terraform through TF_VAR_ environment variables instead of writing them to generated configurations")
 
 	// tf-bench version
 	rootCmd.AddCommand(versionCmd)
@@ -25,10 +91,116 @@ func init() {
 	// tf-bench refresh
 	rootCmd.AddCommand(refreshCmd)
 	refreshCmd.Flags().IntVar(&Iterations, "iterations", 3, "How many times to run each refresh test. Higher number will be more accurate but slower")
+	refreshCmd.Flags().StringVar(&Method, "method", string(bench.MethodEventLog), "Method of measuring refresh: event-log, temp-dir or target")
 	refreshCmd.Flags().BoolVar(&EventLog, "event-log", true, "Use event log method of measuring refresh")
+	_ = refreshCmd.Flags().MarkDeprecated("event-log", "use --method instead")
+	refreshCmd.Flags().StringVar(&GroupBy, "group-by", "type", "Aggregate event log measurements by type, module, provider or module+type")
+	refreshCmd.Flags().BoolVar(&DataSources, "data-sources", true, "Measure data source reads as well as resource refreshes. Not supported by the temp-dir method")
+	refreshCmd.Flags().IntVar(&Sample, "sample", 0, "Measure a random sample of this many instances of every resource type, and estimate the rest")
+	refreshCmd.Flags().Float64Var(&SampleFraction, "sample-fraction", 0, "Measure a random sample of this fraction of the instances of every resource type, and estimate the rest")
+	refreshCmd.Flags().Int64Var(&Seed, "seed", 0, "Seed of the random sample. Defaults to a random seed, which is included in the report")
+	refreshCmd.Flags().BoolVar(&APIProxy, "api-proxy", false, "Record the API calls of providers through a local proxy and attribute them to resources. Requires the event-log method")
+	refreshCmd.Flags().BoolVar(&APIProxyInsecure, "api-proxy-insecure", false, "Do not verify the certificates of the APIs behind the API proxy, for controllers with self-signed certificates")
+	refreshCmd.Flags().BoolVar(&TraceLog, "trace-log", false, "Run terraform with TF_LOG=trace and break refresh times down into provider startup, schema loading, gRPC calls and core overhead. Requires the event-log method")
+	refreshCmd.Flags().DurationVar(&InjectLatency, "inject-latency", 0, "Add this latency to every API call through the API proxy but those to the registry and state backend, and compare against a run without it")
+	refreshCmd.Flags().DurationVar(&InjectJitter, "inject-jitter", 0, "Add a random latency of up to this much to every API call through the API proxy but those to the registry and state backend")
+	refreshCmd.Flags().Float64Var(&InjectErrorRate, "inject-error-rate", 0, "Answer this fraction of API calls through the API proxy, but those to the registry and state backend, with an error")
+	refreshCmd.Flags().IntVar(&InjectStatus, "inject-status", 503, "HTTP status of injected errors")
+	refreshCmd.Flags().StringArrayVar(&InjectRules, "inject-rule", nil, "Inject faults into the API calls to some hosts, in the form host=glob,latency=200ms,jitter=50ms,error-rate=0.05,status=429. Can be repeated, the first matching rule applies. Without a host, the registry and state backend are spared")
+	refreshCmd.Flags().StringVar(&OTLPEndpoint, "otlp-endpoint", "", "Export every benchmark as a trace to this OTLP/HTTP endpoint, for example http://localhost:4318. Requires the event-log method")
+	refreshCmd.Flags().StringArrayVar(&OTLPHeaders, "otlp-header", nil, "Header to send to the OTLP endpoint, in the form key=value. Can be repeated")
+	refreshCmd.Flags().StringArrayVar(&ProviderOverrides, "provider-override", nil, "Compare a locally built provider against the released one, in the form name=/path/to/binary. Can be repeated")
 
 	// tf-bench apply
 	rootCmd.AddCommand(applyCmd)
+
+	// tf-bench install
+	rootCmd.AddCommand(installCmd)
+	installCmd.Flags().StringVar(&InstallFrom, "from", "", "Terraform release zip, or directory containing the release zip for this platform")
+	installCmd.Flags().StringVar(&InstallSHA256Sums, "sha256sums", "", "SHA256SUMS file to verify the release zip against. Defaults to the SHA256SUMS file next to the release zip")
+	_ = installCmd.MarkFlagRequired("from")
+
+	// tf-bench matrix
+	rootCmd.AddCommand(matrixCmd)
+	matrixCmd.Flags().StringSliceVar(&TerraformVersions, "terraform", nil, "Comma separated list of installed terraform versions to benchmark with")
+	matrixCmd.Flags().IntVar(&Iterations, "iterations", 3, "How many times to run each refresh test. Higher number will be more accurate but slower")
+	matrixCmd.Flags().StringVar(&Method, "method", string(bench.MethodEventLog), "Method of measuring refresh: event-log, temp-dir or target")
+	matrixCmd.Flags().BoolVar(&EventLog, "event-log", true, "Use event log method of measuring refresh")
+	_ = matrixCmd.Flags().MarkDeprecated("event-log", "use --method instead")
+	matrixCmd.Flags().StringVar(&GroupBy, "group-by", "type", "Aggregate event log measurements by type, module, provider or module+type")
+	matrixCmd.Flags().BoolVar(&DataSources, "data-sources", true, "Measure data source reads as well as resource refreshes. Not supported by the temp-dir method")
+	matrixCmd.Flags().IntVar(&Sample, "sample", 0, "Measure a random sample of this many instances of every resource type, and estimate the rest")
+	matrixCmd.Flags().Float64Var(&SampleFraction, "sample-fraction", 0, "Measure a random sample of this fraction of the instances of every resource type, and estimate the rest")
+	matrixCmd.Flags().Int64Var(&Seed, "seed", 0, "Seed of the random sample. Defaults to a random seed, which is included in the report")
+	_ = matrixCmd.MarkFlagRequired("terraform")
+
+	// tf-bench bisect
+	rootCmd.AddCommand(bisectCmd)
+	bisectCmd.Flags().StringVar(&BisectProviderRepo, "provider-repo", "", "Path to the git repository of the provider")
+	bisectCmd.Flags().StringVar(&BisectGood, "good", "", "Provider revision without the regression")
+	bisectCmd.Flags().StringVar(&BisectBad, "bad", "", "Provider revision with the regression")
+	bisectCmd.Flags().StringVar(&BisectResourceType, "type", "", "Resource type to benchmark, for example aviatrix_vpc")
+	bisectCmd.Flags().StringVar(&BisectProvider, "provider", "", "Provider built from the repository. Defaults to the provider of --type in the state file")
+	bisectCmd.Flags().StringVar(&BisectThreshold, "threshold", "20%", "Slowdown relative to the good revision that marks a revision bad")
+	bisectCmd.Flags().IntVar(&Iterations, "iterations", 3, "How many times to run each refresh test. Higher number will be more accurate but slower")
+	for _, name := range []string{"provider-repo", "good", "bad", "type"} {
+		_ = bisectCmd.MarkFlagRequired(name)
+	}
+
+	// tf-bench scaling
+	rootCmd.AddCommand(scalingCmd)
+	scalingCmd.Flags().StringVar(&ScalingResourceType, "type", "", "Resource type to measure, for example aviatrix_vpc, or data.aviatrix_account for a data source")
+	scalingCmd.Flags().IntVar(&Iterations, "iterations", 3, "How many times to run each refresh test. Higher number will be more accurate but slower")
+	scalingCmd.Flags().Int64Var(&Seed, "seed", 0, "Seed of the order instances are added to the subsets in. Defaults to a random seed, which is included in the report")
+	_ = scalingCmd.MarkFlagRequired("type")
+
+	// tf-bench generate
+	rootCmd.AddCommand(generateCmd)
+	generateCmd.Flags().StringVar(&GenerateResourceType, "type", "", "Resource type to generate, one of random_id, random_pet, random_string, random_integer, null_resource or time_static without a template")
+	generateCmd.Flags().IntVar(&GenerateCount, "count", 0, "Number of resources to generate")
+	generateCmd.Flags().StringVar(&GenerateTemplate, "template", "", "File with a resource block to generate, in which ${index} is replaced with the index of every resource")
+	generateCmd.Flags().StringVar(&GenerateOut, "out", "", "Directory to write the generated workspace to")
+	generateCmd.Flags().IntVar(&Iterations, "iterations", 3, "How many times to run each refresh test. Higher number will be more accurate but slower")
+	generateCmd.Flags().StringVar(&Method, "method", string(bench.MethodEventLog), "Method of measuring refresh: event-log, temp-dir or target")
+	generateCmd.Flags().StringVar(&GroupBy, "group-by", "type", "Aggregate event log measurements by type, module, provider or module+type")
+	generateCmd.Flags().BoolVar(&DataSources, "data-sources", true, "Measure data source reads as well as resource refreshes. Not supported by the temp-dir method")
+	for _, name := range []string{"count", "out"} {
+		_ = generateCmd.MarkFlagRequired(name)
+	}
+
+	// tf-bench history
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.AddCommand(historyListCmd, historyShowCmd, historyTrendCmd)
+	for _, c := range []*cobra.Command{historyListCmd, historyTrendCmd} {
+		c.Flags().StringVar(&HistoryWorkspace, "workspace", "", "Workspace directory whose runs to use. Defaults to the current directory")
+		c.Flags().BoolVar(&HistoryAllWorkspaces, "all-workspaces", false, "Use the runs of every workspace")
+	}
+	historyTrendCmd.Flags().StringVar(&HistoryResourceType, "type", "", "Resource type to follow, for example aviatrix_vpc, or data.aviatrix_account for a data source")
+	historyTrendCmd.Flags().StringVar(&HistoryCondition, "condition", "", "Follow the runs of comparisons taken under this condition, such as \"injected faults\". Defaults to the runs that are not part of a comparison")
+	historyTrendCmd.Flags().Float64Var(&HistoryThreshold, "threshold", history.DefaultThreshold, "t statistic a shift of the refresh time must exceed to be reported as a change point")
+	_ = historyTrendCmd.MarkFlagRequired("type")
+
+	// tf-bench serve
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().DurationVar(&ServeInterval, "interval", time.Hour, "How often to run the benchmark")
+	serveCmd.Flags().StringVar(&ServeListen, "listen", ":9100", "Address to serve the metrics on")
+	serveCmd.Flags().IntVar(&Iterations, "iterations", 3, "How many times to run each refresh test. Higher number will be more accurate but slower")
+	serveCmd.Flags().StringVar(&Method, "method", string(bench.MethodEventLog), "Method of measuring refresh: event-log, temp-dir or target")
+	serveCmd.Flags().BoolVar(&DataSources, "data-sources", true, "Measure data source reads as well as resource refreshes. Not supported by the temp-dir method")
+	serveCmd.Flags().IntVar(&Sample, "sample", 0, "Measure a random sample of this many instances of every resource type, and estimate the rest")
+	serveCmd.Flags().Float64Var(&SampleFraction, "sample-fraction", 0, "Measure a random sample of this fraction of the instances of every resource type, and estimate the rest")
+	serveCmd.Flags().Int64Var(&Seed, "seed", 0, "Seed of the random sample. Defaults to a new random seed for every run")
+	serveCmd.Flags().StringVar(&OTLPEndpoint, "otlp-endpoint", "", "Export every benchmark as a trace to this OTLP/HTTP endpoint, for example http://localhost:4318. Requires the event-log method")
+	serveCmd.Flags().StringArrayVar(&OTLPHeaders, "otlp-header", nil, "Header to send to the OTLP endpoint, in the form key=value. Can be repeated")
+
+	// tf-bench mock-provider
+	rootCmd.AddCommand(mockProviderCmd)
+
+	// tf-bench selftest
+	rootCmd.AddCommand(selftestCmd)
+	selftestCmd.Flags().StringVar(&SelftestMockConfig, "mock-config", "", "Mock provider config file with the latencies of its resource types. Defaults to a fixed, a normal and a lognormal resource type")
+	selftestCmd.Flags().IntVar(&SelftestCount, "count", 30, "Number of instances of every mock resource type")
+	selftestCmd.Flags().IntVar(&Iterations, "iterations", 3, "How many times to run each refresh test. Higher number will be more accurate but slower")
 }
 
 var rootCmd = &cobra.Command{
@@ -41,5 +213,90 @@ for the resources in your current workspace.
 }
 
 func Execute() {
+	// Terraform runs the mock provider through a link to this binary.
+	if isMockProvider() {
+		if err := serveMockProvider(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	// Generated configurations can contain secrets, never leave them
+	// behind when interrupted.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		util.RemoveTempDirs()
+		os.Exit(1)
+	}()
 	_ = rootCmd.Execute()
+	util.RemoveTempDirs()
+}
+
+// newLogger returns the logger benchmarks are run with.
+func newLogger() (*zap.Logger, error) {
+	if Verbose {
+		logger, err := zap.NewDevelopment()
+		if err != nil {
+			return nil, fmt.Errorf("could not initialize verbose logger: %w", err)
+		}
+		return logger, nil
+	}
+	logger, err := zap.NewProduction()
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize production logger: %w", err)
+	}
+	return logger, nil
+}
+
+// fileConfig loads the --config file, or the default config file if the
+// workspace has one.
+func fileConfig() (*bench.FileConfig, error) {
+	path := ConfigFile
+	if path == "" {
+		if _, err := os.Stat(bench.DefaultConfigFile); err != nil {
+			return &bench.FileConfig{}, nil
+		}
+		path = bench.DefaultConfigFile
+	}
+	return bench.LoadConfigFile(path)
+}
+
+// measurementMethod parses the --method flag of cmd. The deprecated
+// --event-log=false flag selects the temp-dir method unless --method is set.
+func measurementMethod(cmd *cobra.Command) (bench.Method, error) {
+	if !cmd.Flags().Changed("method") && cmd.Flags().Changed("event-log") && !EventLog {
+		return bench.MethodTempDir, nil
+	}
+	return bench.ParseMethod(Method)
+}
+
+// sampleSeed returns the --seed flag of cmd, or a new random seed when it is not set.
+func sampleSeed(cmd *cobra.Command) int64 {
+	if cmd.Flags().Changed("seed") {
+		return Seed
+	}
+	return time.Now().UnixNano()
+}
+
+// buildVersion returns the version of this build of tf-bench.
+func buildVersion() string {
+	if version == "" {
+		version = "development-build"
+	}
+	return version
+}
+
+// writeReport outputs the report to the console and saves it to a file named
+// after kind and the time the benchmark started.
+func writeReport(kind string, timestamp time.Time, reportString string) error {
+	fmt.Println(reportString)
+	filename := "tf-bench-" + kind + "-report-" + timestamp.Format(time.RFC3339)
+	err := os.WriteFile(filename, []byte(reportString), 0644)
+	if err != nil {
+		return fmt.Errorf("could not write report to file. The report has also been output to the console please recover the report from there: %w", err)
+	}
+	fmt.Printf("Wrote report to file %s\n", filename)
+	return nil
 }
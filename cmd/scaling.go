@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/CyrusJavan/tf-bench/bench"
+	"github.com/spf13/cobra"
+)
+
+var scalingCmd = &cobra.Command{
+	Use:   "scaling",
+	Short: "Measure how refresh time of a resource type grows with its number of instances",
+	Long: `
+Refresh subsets of 1, 2, 4 ... N of the N instances of a resource type
+by targeting them, and fit linear and power-law models of refresh time
+against the number of instances.
+`,
+	RunE:    scalingRun,
+	PreRunE: scalingPreRun,
+}
+
+func scalingRun(cmd *cobra.Command, args []string) error {
+	cfg := &bench.Config{
+		SkipControllerVersion: true,
+		Iterations:            Iterations,
+		VarFile:               VarFile,
+		Seed:                  sampleSeed(cmd),
+	}
+	scfg := &bench.ScalingConfig{
+		ResourceType: ScalingResourceType,
+	}
+	fmt.Printf("Starting scaling benchmark with configuration=%+v\n", scfg)
+	logger, err := newLogger()
+	if err != nil {
+		return err
+	}
+	tfRunner, err := bench.FindTerraform(TerraformBin)
+	if err != nil {
+		return err
+	}
+	report, err := bench.ScalingBenchmark(cfg, scfg, tfRunner, logger)
+	if err != nil {
+		return err
+	}
+	report.BuildVersion = buildVersion()
+	// Scaling is not recorded in the history: it measures targeted subsets of
+	// a resource type, not a refresh of the workspace, so its times would
+	// read as shifts in history trend.
+	return writeReport("scaling", report.Timestamp, report.String())
+}
+
+func scalingPreRun(cmd *cobra.Command, args []string) error {
+	return validateEnv(true)
+}
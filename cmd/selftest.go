@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/CyrusJavan/tf-bench/bench"
+	"github.com/spf13/cobra"
+)
+
+var selftestCmd = &cobra.Command{
+	Use:   "selftest",
+	Short: "Check the accuracy of tf-bench against a mock provider with known latencies",
+	Long: `
+Create a workspace of mock provider resources whose read latency follows
+the distributions of a mock provider config file, benchmark it with the
+event log method and check that the measured mean and standard deviation
+of every resource type match the configured ones. Needs no cloud access.
+`,
+	RunE:    selftestRun,
+	PreRunE: selftestPreRun,
+}
+
+func selftestRun(cmd *cobra.Command, args []string) error {
+	cfg := &bench.Config{
+		SkipControllerVersion: true,
+		Iterations:            Iterations,
+		MaxLoad:               MaxLoad,
+		MaxSteal:              MaxSteal,
+		AbortOnNoise:          AbortOnNoise,
+		Method:                bench.MethodEventLog,
+	}
+	providerPath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("could not find the tf-bench binary to serve the mock provider: %w", err)
+	}
+	scfg := &bench.SelftestConfig{
+		MockConfig:   SelftestMockConfig,
+		Count:        SelftestCount,
+		ProviderPath: providerPath,
+	}
+	fmt.Printf("Starting selftest with configuration=%+v\n", scfg)
+	logger, err := newLogger()
+	if err != nil {
+		return err
+	}
+	tfRunner, err := bench.FindTerraform(TerraformBin)
+	if err != nil {
+		return err
+	}
+	report, err := bench.Selftest(cfg, scfg, tfRunner, logger)
+	if err != nil {
+		return err
+	}
+	report.BuildVersion = buildVersion()
+	err = writeReport("selftest", report.Timestamp, report.String())
+	if err != nil {
+		return err
+	}
+	// The mock workspace is not recorded in the history, it is removed and
+	// would only join the series of the workspace selftest was run from.
+	if !report.Pass() {
+		return fmt.Errorf("measured refresh times do not match the mock provider config")
+	}
+	return nil
+}
+
+func selftestPreRun(cmd *cobra.Command, args []string) error {
+	return validateEnv(true)
+}
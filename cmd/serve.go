@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/CyrusJavan/tf-bench/bench"
+	"github.com/CyrusJavan/tf-bench/internal/metrics"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Benchmark refresh on a schedule and expose the latest results as Prometheus metrics",
+	Long: `
+Run the refresh benchmark of the workspace in the current directory
+every --interval, and serve the statistics of the latest successful run
+as Prometheus metrics on /metrics.
+`,
+	RunE:    serveRun,
+	PreRunE: servePreRun,
+}
+
+// serveState is the results of the scheduled benchmarks.
+type serveState struct {
+	handler     *metrics.Handler
+	report      *bench.RefreshReport // report of the latest successful run
+	successes   int
+	failures    int
+	lastSuccess time.Time
+}
+
+// update sets the metrics of the latest report and of the runs so far.
+func (s *serveState) update() {
+	var families []*metrics.Family
+	if s.report != nil {
+		families = s.report.Metrics()
+	}
+	runs := &metrics.Family{Name: "tfbench_runs_total", Help: "Number of scheduled benchmarks by result.", Type: metrics.TypeCounter}
+	runs.Add(float64(s.successes), "result", "success")
+	runs.Add(float64(s.failures), "result", "failure")
+	families = append(families, runs)
+	if !s.lastSuccess.IsZero() {
+		last := &metrics.Family{Name: "tfbench_last_success_timestamp_seconds", Help: "Time the latest successful benchmark finished at.", Type: metrics.TypeGauge}
+		last.Add(float64(s.lastSuccess.UnixNano()) / 1e9)
+		families = append(families, last)
+	}
+	s.handler.Set(families)
+}
+
+func serveRun(cmd *cobra.Command, args []string) error {
+	method, err := measurementMethod(cmd)
+	if err != nil {
+		return err
+	}
+	logger, err := newLogger()
+	if err != nil {
+		return err
+	}
+	tfRunner, err := bench.FindTerraform(TerraformBin)
+	if err != nil {
+		return err
+	}
+	state := &serveState{handler: &metrics.Handler{}}
+	state.update()
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", state.handler)
+	// Listen before the first benchmark, so a port in use fails right away.
+	listener, err := net.Listen("tcp", ServeListen)
+	if err != nil {
+		return fmt.Errorf("could not listen on %s: %w", ServeListen, err)
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- http.Serve(listener, mux)
+	}()
+	fmt.Printf("Serving metrics on http://%s/metrics, benchmarking every %s\n", listener.Addr(), ServeInterval)
+
+	ticker := time.NewTicker(ServeInterval)
+	defer ticker.Stop()
+	for {
+		cfg := &bench.Config{
+			SkipControllerVersion: SkipControllerVersion,
+			Iterations:            Iterations,
+			MaxLoad:               MaxLoad,
+			MaxSteal:              MaxSteal,
+			AbortOnNoise:          AbortOnNoise,
+			VarFile:               VarFile,
+			SecretsSafe:           SecretsSafe,
+			Method:                method,
+			GroupBy:               bench.GroupByType,
+			DataSources:           DataSources,
+			Sample:                Sample,
+			SampleFraction:        SampleFraction,
+			Seed:                  sampleSeed(cmd),
+		}
+		fmt.Printf("Starting benchmark with configuration=%+v\n", cfg)
+		report, err := bench.RefreshBenchmark(cfg, tfRunner, logger)
+		if err != nil {
+			// Keep serving the previous results, the next run may succeed.
+			logger.Error("Scheduled benchmark failed", zap.Error(err))
+			state.failures++
+		} else {
+			report.BuildVersion = buildVersion()
+			fmt.Printf("Benchmark finished, the whole workspace refreshed in %s\n", report.TotalTime.Round(time.Millisecond))
+			recordHistory(report, "", nil)
+			exportTrace(report, "")
+			state.report = report
+			state.successes++
+			state.lastSuccess = time.Now()
+		}
+		state.update()
+		select {
+		case <-ticker.C:
+		case err := <-serveErr:
+			return fmt.Errorf("metrics server stopped: %w", err)
+		}
+	}
+}
+
+func servePreRun(cmd *cobra.Command, args []string) error {
+	method, err := measurementMethod(cmd)
+	if err != nil {
+		return err
+	}
+	if err := validateOTLP(method); err != nil {
+		return err
+	}
+	if ServeInterval <= 0 {
+		return fmt.Errorf("--interval must be positive")
+	}
+	return validateEnv(SkipControllerVersion)
+}
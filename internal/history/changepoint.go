@@ -0,0 +1,143 @@
+package history
+
+import (
+	"math"
+	"sort"
+
+	"gonum.org/v1/gonum/stat"
+)
+
+const (
+	// DefaultThreshold is the t statistic a shift of the mean must exceed to
+	// be a change point. It is well above the usual significance levels,
+	// since the best of every possible split is tested.
+	DefaultThreshold = 4
+	// minSegment is the least number of values on each side of a change point.
+	minSegment = 3
+)
+
+// ChangePoint is where the mean of a series shifts.
+type ChangePoint struct {
+	Index  int     // Index of the first value after the shift
+	Before float64 // Before is the mean of the values since the previous change point
+	After  float64 // After is the mean of the values until the next change point
+	Score  float64 // Score is the t statistic of the shift
+}
+
+// ChangePoints finds the shifts of the mean of values by circular binary
+// segmentation: the split of a segment into an interval and the rest with the
+// largest t statistic between them gives one or two change points when the
+// statistic exceeds threshold, and every piece is searched again. Testing
+// intervals finds a shift that is later reverted, which a single split of the
+// segment would average away.
+func ChangePoints(values []float64, threshold float64) []*ChangePoint {
+	var cps []*ChangePoint
+	var segment func(lo, hi int)
+	segment = func(lo, hi int) {
+		splits, score := bestSplit(values[lo:hi])
+		if len(splits) == 0 || score <= threshold {
+			return
+		}
+		bounds := []int{lo}
+		for _, split := range splits {
+			cps = append(cps, &ChangePoint{Index: lo + split, Score: score})
+			bounds = append(bounds, lo+split)
+		}
+		bounds = append(bounds, hi)
+		for i := 1; i < len(bounds); i++ {
+			segment(bounds[i-1], bounds[i])
+		}
+	}
+	segment(0, len(values))
+	sort.Slice(cps, func(i, j int) bool {
+		return cps[i].Index < cps[j].Index
+	})
+	for i, cp := range cps {
+		lo, hi := 0, len(values)
+		if i > 0 {
+			lo = cps[i-1].Index
+		}
+		if i < len(cps)-1 {
+			hi = cps[i+1].Index
+		}
+		cp.Before = stat.Mean(values[lo:cp.Index], nil)
+		cp.After = stat.Mean(values[cp.Index:hi], nil)
+	}
+	return cps
+}
+
+// bestSplit returns the ends of the interval of values whose t statistic
+// against the rest of values is the largest, leaving out the ends that are
+// the ends of values, and the statistic. It returns no ends when values are
+// too few to split.
+//
+// The values are centered and scaled before summing, which leaves the t
+// statistic unchanged and keeps the sums of squares of large durations
+// precise, and prefix sums make the statistic of every interval O(1).
+func bestSplit(values []float64) ([]int, float64) {
+	n := len(values)
+	if n < 2*minSegment {
+		return nil, 0
+	}
+	mean := stat.Mean(values, nil)
+	var scale float64
+	for _, v := range values {
+		scale = math.Max(scale, math.Abs(v-mean))
+	}
+	if scale == 0 {
+		return nil, 0
+	}
+	sums := make([]float64, n+1)
+	squares := make([]float64, n+1)
+	for i, v := range values {
+		x := (v - mean) / scale
+		sums[i+1] = sums[i] + x
+		squares[i+1] = squares[i] + x*x
+	}
+	var best []int
+	bestScore := 0.0
+	for i := 0; i < n; i++ {
+		for j := i + minSegment; j <= n; j++ {
+			if n-(j-i) < minSegment {
+				continue
+			}
+			inside := segmentSums{n: float64(j - i), sum: sums[j] - sums[i], squares: squares[j] - squares[i]}
+			outside := segmentSums{n: float64(n) - inside.n, sum: sums[n] - inside.sum, squares: squares[n] - inside.squares}
+			score := tStatistic(inside, outside)
+			if best == nil || score > bestScore {
+				best, bestScore = best[:0], score
+				if i > 0 {
+					best = append(best, i)
+				}
+				if j < n {
+					best = append(best, j)
+				}
+			}
+		}
+	}
+	return best, bestScore
+}
+
+// segmentSums are the number, sum and sum of squares of values.
+type segmentSums struct {
+	n       float64
+	sum     float64
+	squares float64
+}
+
+// minPooledVariance is the pooled variance of centered and scaled values
+// below which it is taken to be zero, as rounding leaves some of it.
+const minPooledVariance = 1e-12
+
+// tStatistic is the two sample t statistic with pooled variance.
+func tStatistic(a, b segmentSums) float64 {
+	m1, m2 := a.sum/a.n, b.sum/b.n
+	if m1 == m2 {
+		return 0
+	}
+	pooled := (a.squares - a.sum*m1 + b.squares - b.sum*m2) / (a.n + b.n - 2)
+	if pooled < minPooledVariance {
+		return math.Inf(1)
+	}
+	return math.Abs(m1-m2) / math.Sqrt(pooled*(1/a.n+1/b.n))
+}
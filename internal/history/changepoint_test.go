@@ -0,0 +1,65 @@
+package history
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangePoints(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []float64
+		indexes []int
+	}{
+		{
+			name:   "steady",
+			values: []float64{10, 11, 9, 10, 12, 10, 9, 11, 10, 10},
+		},
+		{
+			name:    "one shift",
+			values:  []float64{10, 11, 9, 10, 12, 20, 21, 19, 20, 22},
+			indexes: []int{5},
+		},
+		{
+			name:    "shift and back",
+			values:  []float64{10, 11, 9, 10, 20, 21, 19, 20, 10, 9, 11, 10},
+			indexes: []int{4, 8},
+		},
+		{
+			name:   "too few values",
+			values: []float64{10, 20, 30, 40, 50},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cps := ChangePoints(tt.values, DefaultThreshold)
+			var indexes []int
+			for _, cp := range cps {
+				indexes = append(indexes, cp.Index)
+				require.Greater(t, cp.Score, float64(DefaultThreshold))
+			}
+			require.Equal(t, tt.indexes, indexes)
+		})
+	}
+
+	cps := ChangePoints([]float64{10, 10, 10, 20, 20, 20}, DefaultThreshold)
+	require.Len(t, cps, 1)
+	require.Equal(t, 10.0, cps[0].Before)
+	require.Equal(t, 20.0, cps[0].After)
+}
+
+func TestChangePointsLongSeries(t *testing.T) {
+	// Durations in nanoseconds of thousands of runs, as serve records them.
+	values := make([]float64, 3000)
+	for i := range values {
+		values[i] = 2e9 + float64(i%7)*1e7
+		if i >= 2000 {
+			values[i] += 5e8
+		}
+	}
+	cps := ChangePoints(values, DefaultThreshold)
+	require.Len(t, cps, 1)
+	require.Equal(t, 2000, cps[0].Index)
+	require.InDelta(t, 5e8, cps[0].After-cps[0].Before, 1e6)
+}
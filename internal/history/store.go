@@ -0,0 +1,215 @@
+// Package history stores benchmark runs in a local directory so they can be
+// listed and compared over time. It only uses the standard library, as
+// releases are built without cgo.
+package history
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// indexFileName is the file with a line of JSON for every run.
+	indexFileName = "runs.jsonl"
+	// reportsDirName is the directory with the text report of every run.
+	reportsDirName = "reports"
+)
+
+// ErrNotFound is returned for a run that is not in the store.
+var ErrNotFound = errors.New("run not found")
+
+// Run is a benchmark run in the history.
+type Run struct {
+	ID        string
+	Timestamp time.Time         // Timestamp is the start of the benchmark
+	Labels    map[string]string // Labels describe the run, such as the workspace, git branch and commit
+	TotalTime time.Duration     // TotalTime is the refresh time of the whole workspace
+	Types     []*TypeTime       // Types are the refresh times of the resource types
+	Report    string            `json:"-"` // Report is the text report, stored next to the index
+}
+
+// TypeTime is the refresh time of a resource type in a run.
+type TypeTime struct {
+	Name  string
+	Count int
+	Time  time.Duration // Time is the average refresh time reported for the type
+}
+
+// Type returns the refresh time of the resource type with the given name, nil
+// if the run did not measure it.
+func (r *Run) Type(name string) *TypeTime {
+	for _, t := range r.Types {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// Store is a history directory.
+type Store struct {
+	dir string
+}
+
+// DefaultDir returns ~/.tf-bench/history.
+func DefaultDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not find home dir: %w", err)
+	}
+	return filepath.Join(home, ".tf-bench", "history"), nil
+}
+
+// Open opens the history in dir, creating it when it does not exist.
+func Open(dir string) (*Store, error) {
+	err := os.MkdirAll(filepath.Join(dir, reportsDirName), 0700)
+	if err != nil {
+		return nil, fmt.Errorf("could not create history dir: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// newID returns a run ID that sorts by time.
+func newID(t time.Time) (string, error) {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return t.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b), nil
+}
+
+// Append adds a run to the history and sets its ID. The report is written
+// before the index line, so the index never names a missing report.
+func (s *Store) Append(run *Run) error {
+	id, err := newID(run.Timestamp)
+	if err != nil {
+		return fmt.Errorf("could not generate run ID: %w", err)
+	}
+	run.ID = id
+	err = os.WriteFile(s.reportPath(id), []byte(run.Report), 0600)
+	if err != nil {
+		return fmt.Errorf("could not write report to history: %w", err)
+	}
+	line, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("could not encode run: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(s.dir, indexFileName), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("could not open history index: %w", err)
+	}
+	// A line cut short by a crash has no newline, end it so this run does
+	// not become part of it.
+	terminated, err := endsWithNewline(f)
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("could not read history index: %w", err)
+	}
+	if !terminated {
+		line = append([]byte{'\n'}, line...)
+	}
+	// A single write of the whole line keeps concurrent appends from
+	// interleaving.
+	_, err = f.Write(append(line, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("could not append to history index: %w", err)
+	}
+	return nil
+}
+
+// endsWithNewline reports whether f is empty or ends with a newline.
+func endsWithNewline(f *os.File) (bool, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	if info.Size() == 0 {
+		return true, nil
+	}
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, info.Size()-1); err != nil {
+		return false, err
+	}
+	return last[0] == '\n', nil
+}
+
+// Runs returns the runs in the history in the order of their timestamps,
+// without their reports. Lines that cannot be decoded, such as one cut short
+// by a crash, are skipped.
+func (s *Store) Runs() ([]*Run, error) {
+	f, err := os.Open(filepath.Join(s.dir, indexFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not open history index: %w", err)
+	}
+	defer f.Close()
+	var runs []*Run
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			var run Run
+			if json.Unmarshal(line, &run) == nil && run.ID != "" {
+				runs = append(runs, &run)
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].Timestamp.Before(runs[j].Timestamp)
+	})
+	return runs, nil
+}
+
+// Run returns the run with the given ID, or the only run whose ID starts with
+// it, with its report.
+func (s *Store) Run(id string) (*Run, error) {
+	runs, err := s.Runs()
+	if err != nil {
+		return nil, err
+	}
+	var found []*Run
+	for _, run := range runs {
+		if run.ID == id {
+			found = []*Run{run}
+			break
+		}
+		if strings.HasPrefix(run.ID, id) {
+			found = append(found, run)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	case 1:
+	default:
+		return nil, fmt.Errorf("run ID %s is ambiguous, it matches %d runs", id, len(found))
+	}
+	run := found[0]
+	report, err := os.ReadFile(s.reportPath(run.ID))
+	if err != nil {
+		return nil, fmt.Errorf("could not read report of run %s: %w", run.ID, err)
+	}
+	run.Report = string(report)
+	return run, nil
+}
+
+func (s *Store) reportPath(id string) string {
+	return filepath.Join(s.dir, reportsDirName, id+".txt")
+}
@@ -0,0 +1,68 @@
+package history
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "history")
+	store, err := Open(dir)
+	require.NoError(t, err)
+	runs, err := store.Runs()
+	require.NoError(t, err)
+	require.Empty(t, runs)
+
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	second := &Run{
+		Timestamp: start.Add(time.Hour),
+		Labels:    map[string]string{"git-branch": "main"},
+		TotalTime: 2 * time.Second,
+		Types:     []*TypeTime{{Name: "aviatrix_vpc", Count: 3, Time: time.Second}},
+		Report:    "second report",
+	}
+	first := &Run{Timestamp: start, TotalTime: time.Second, Report: "first report"}
+	require.NoError(t, store.Append(second))
+	require.NoError(t, store.Append(first))
+	require.NotEqual(t, first.ID, second.ID)
+
+	// A line cut short by a crash is skipped.
+	f, err := os.OpenFile(filepath.Join(dir, indexFileName), os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"ID":"20240301T`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	third := &Run{Timestamp: start.Add(2 * time.Hour), TotalTime: 3 * time.Second, Report: "third report"}
+	require.NoError(t, store.Append(third))
+
+	runs, err = store.Runs()
+	require.NoError(t, err)
+	require.Len(t, runs, 3)
+	require.Equal(t, first.ID, runs[0].ID)
+	require.Equal(t, second.ID, runs[1].ID)
+	require.Equal(t, third.ID, runs[2].ID)
+	require.Equal(t, 3*time.Second, runs[2].TotalTime)
+	require.Empty(t, runs[1].Report)
+	require.Equal(t, "main", runs[1].Labels["git-branch"])
+	require.Equal(t, &TypeTime{Name: "aviatrix_vpc", Count: 3, Time: time.Second}, runs[1].Type("aviatrix_vpc"))
+	require.Nil(t, runs[1].Type("aviatrix_account"))
+
+	run, err := store.Run(second.ID)
+	require.NoError(t, err)
+	require.Equal(t, "second report", run.Report)
+	run, err = store.Run("20240301T1200")
+	require.NoError(t, err)
+	require.Equal(t, first.ID, run.ID)
+	require.Equal(t, "first report", run.Report)
+
+	_, err = store.Run("20240301")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "ambiguous")
+	_, err = store.Run("20230101")
+	require.True(t, errors.Is(err, ErrNotFound))
+}
@@ -0,0 +1,90 @@
+// Package host describes the machine a benchmark runs on and how busy it is.
+package host
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Info is the fingerprint of the machine and the tf-bench build. Fields that
+// cannot be read on the platform are empty.
+type Info struct {
+	OS        string
+	Arch      string
+	Kernel    string // Kernel is the kernel release
+	CPUModel  string
+	CPUs      int   // CPUs is the number of logical CPUs
+	Memory    int64 // Memory is the total memory in bytes
+	GoVersion string
+	Build     string // Build is the module version and VCS revision of tf-bench
+}
+
+// Collect returns the fingerprint of the current machine.
+func Collect() *Info {
+	info := &Info{
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		CPUs:      runtime.NumCPU(),
+		GoVersion: runtime.Version(),
+		Build:     buildInfo(),
+	}
+	collectPlatform(info)
+	return info
+}
+
+// buildInfo describes the build of tf-bench from the build info embedded in
+// the binary, which has a version when it was installed with go install.
+func buildInfo() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	build := bi.Main.Path + " " + bi.Main.Version
+	if bi.Main.Sum != "" {
+		build += " " + bi.Main.Sum
+	}
+	return build
+}
+
+func (i *Info) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "host: %s/%s", i.OS, i.Arch)
+	if i.Kernel != "" {
+		fmt.Fprintf(&b, " kernel %s", i.Kernel)
+	}
+	fmt.Fprintf(&b, ", %d CPUs", i.CPUs)
+	if i.CPUModel != "" {
+		fmt.Fprintf(&b, " (%s)", i.CPUModel)
+	}
+	if i.Memory > 0 {
+		fmt.Fprintf(&b, ", %.1fGiB memory", float64(i.Memory)/(1<<30))
+	}
+	fmt.Fprintf(&b, "\ngo runtime: %s", i.GoVersion)
+	if i.Build != "" {
+		fmt.Fprintf(&b, "\ntf-bench build: %s", i.Build)
+	}
+	return b.String()
+}
+
+// Load is how busy the machine is.
+type Load struct {
+	Load1 float64 // Load1 is the one minute load average, 0 when unknown
+	CPU   CPUTimes
+}
+
+// CPUTimes are the cumulative CPU times of all the CPUs, in clock ticks.
+type CPUTimes struct {
+	Total uint64
+	Steal uint64 // Steal is the time the hypervisor ran other virtual machines
+}
+
+// Steal returns the percentage of CPU time stolen by the hypervisor between
+// two readings of the load, 0 when unknown.
+func Steal(before, after Load) float64 {
+	if after.CPU.Total <= before.CPU.Total || after.CPU.Steal < before.CPU.Steal {
+		return 0
+	}
+	return float64(after.CPU.Steal-before.CPU.Steal) / float64(after.CPU.Total-before.CPU.Total) * 100
+}
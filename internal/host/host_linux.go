@@ -0,0 +1,113 @@
+//go:build linux
+// +build linux
+
+package host
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// collectPlatform reads the kernel, CPU and memory of the machine from /proc.
+func collectPlatform(info *Info) {
+	if b, err := os.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		info.Kernel = strings.TrimSpace(string(b))
+	}
+	if b, err := os.ReadFile("/proc/cpuinfo"); err == nil {
+		info.CPUModel = parseCPUModel(b)
+	}
+	if b, err := os.ReadFile("/proc/meminfo"); err == nil {
+		info.Memory = parseMemTotal(b)
+	}
+}
+
+// parseCPUModel returns the model name of the first CPU in /proc/cpuinfo.
+func parseCPUModel(b []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		// ARM CPUs have no model name, only their features and part numbers.
+		switch strings.TrimSpace(kv[0]) {
+		case "model name", "Model":
+			return strings.TrimSpace(kv[1])
+		}
+	}
+	return ""
+}
+
+// parseMemTotal returns MemTotal of /proc/meminfo in bytes.
+func parseMemTotal(b []byte) int64 {
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+		kb, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0
+		}
+		return kb * 1024
+	}
+	return 0
+}
+
+// ReadLoad returns the load average and CPU times of the machine.
+func ReadLoad() Load {
+	var load Load
+	if b, err := os.ReadFile("/proc/loadavg"); err == nil {
+		load.Load1 = parseLoadAvg(b)
+	}
+	if b, err := os.ReadFile("/proc/stat"); err == nil {
+		load.CPU = parseCPUTimes(b)
+	}
+	return load
+}
+
+// parseLoadAvg returns the one minute load average of /proc/loadavg.
+func parseLoadAvg(b []byte) float64 {
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return 0
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0
+	}
+	return load
+}
+
+// parseCPUTimes returns the CPU times of all the CPUs from the cpu line of
+// /proc/stat: user nice system idle iowait irq softirq steal. Guest time is
+// already included in user and nice.
+func parseCPUTimes(b []byte) CPUTimes {
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] != "cpu" {
+			continue
+		}
+		var times CPUTimes
+		for i, f := range fields[1:] {
+			if i == 8 {
+				break
+			}
+			v, err := strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				return CPUTimes{}
+			}
+			times.Total += v
+			if i == 7 {
+				times.Steal = v
+			}
+		}
+		return times
+	}
+	return CPUTimes{}
+}
@@ -0,0 +1,30 @@
+//go:build linux
+// +build linux
+
+package host
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProc(t *testing.T) {
+	require.Equal(t, "Intel(R) Xeon(R) CPU @ 2.20GHz", parseCPUModel([]byte("processor\t: 0\nvendor_id\t: GenuineIntel\nmodel\t\t: 79\nmodel name\t: Intel(R) Xeon(R) CPU @ 2.20GHz\n")))
+	require.Equal(t, "", parseCPUModel([]byte("processor\t: 0\nBogoMIPS\t: 50.00\n")))
+	require.Equal(t, int64(16<<30), parseMemTotal([]byte("MemTotal:       16777216 kB\nMemFree:         1000 kB\n")))
+	require.Equal(t, 1.25, parseLoadAvg([]byte("1.25 0.80 0.50 2/345 6789\n")))
+	require.Equal(t, CPUTimes{Total: 990, Steal: 30}, parseCPUTimes([]byte("cpu  500 10 200 200 40 5 5 30 100 0\ncpu0 250 5 100 100 20 2 3 15 50 0\n")))
+
+	require.Equal(t, 2.0, Steal(Load{CPU: CPUTimes{Total: 1000, Steal: 30}}, Load{CPU: CPUTimes{Total: 2000, Steal: 50}}))
+	require.Equal(t, 0.0, Steal(Load{}, Load{}))
+}
+
+func TestCollect(t *testing.T) {
+	info := Collect()
+	require.Equal(t, "linux", info.OS)
+	require.NotEmpty(t, info.Kernel)
+	require.Greater(t, info.CPUs, 0)
+	require.Greater(t, info.Memory, int64(0))
+	require.Contains(t, info.String(), "go runtime: go")
+}
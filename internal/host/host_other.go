@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package host
+
+// collectPlatform knows nothing more than the Go runtime on this platform.
+func collectPlatform(info *Info) {}
+
+// ReadLoad is not supported on this platform and returns an unknown load.
+func ReadLoad() Load {
+	return Load{}
+}
@@ -0,0 +1,156 @@
+// Package metrics exposes metrics in the Prometheus text format. It only
+// implements the parts of the format tf-bench needs, to not depend on the
+// Prometheus client library.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the Prometheus text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Types of metric families.
+const (
+	TypeGauge   = "gauge"
+	TypeCounter = "counter"
+	TypeSummary = "summary"
+)
+
+// Family is a metric and its samples.
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []*Sample
+}
+
+// Sample is a value of a metric with its labels.
+type Sample struct {
+	Suffix string // Suffix is added to the name of the family, such as _sum and _count of a summary
+	Labels map[string]string
+	Value  float64
+}
+
+// Add appends a sample with labels given as name and value pairs.
+func (f *Family) Add(value float64, labels ...string) {
+	f.AddSuffix("", value, labels...)
+}
+
+// AddSummary appends the quantiles of a summary, given as quantile and value
+// pairs in quantiles, with the _sum and _count of its observations.
+func (f *Family) AddSummary(quantiles map[float64]float64, sum float64, count int, labels ...string) {
+	var qs []float64
+	for q := range quantiles {
+		qs = append(qs, q)
+	}
+	sort.Float64s(qs)
+	for _, q := range qs {
+		f.AddSuffix("", quantiles[q], append(append([]string{}, labels...), "quantile", strconv.FormatFloat(q, 'g', -1, 64))...)
+	}
+	f.AddSuffix("_sum", sum, labels...)
+	f.AddSuffix("_count", float64(count), labels...)
+}
+
+// AddSuffix appends a sample of the name of the family with suffix added.
+func (f *Family) AddSuffix(suffix string, value float64, labels ...string) {
+	s := &Sample{Suffix: suffix, Value: value}
+	if len(labels) > 0 {
+		s.Labels = map[string]string{}
+		for i := 0; i+1 < len(labels); i += 2 {
+			s.Labels[labels[i]] = labels[i+1]
+		}
+	}
+	f.Samples = append(f.Samples, s)
+}
+
+// Write writes families in the text format. Families without samples are
+// left out.
+func Write(w io.Writer, families []*Family) error {
+	for _, f := range families {
+		if len(f.Samples) == 0 {
+			continue
+		}
+		_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.Name, escapeHelp(f.Help), f.Name, f.Type)
+		if err != nil {
+			return err
+		}
+		for _, s := range f.Samples {
+			_, err := fmt.Fprintf(w, "%s%s%s %s\n", f.Name, s.Suffix, formatLabels(s.Labels), formatValue(s.Value))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// formatLabels formats labels sorted by name.
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var names []string
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeLabel(labels[name]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Handler serves the latest families set on it.
+type Handler struct {
+	mu       sync.Mutex
+	families []*Family
+}
+
+// Set replaces the families served.
+func (h *Handler) Set(families []*Family) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.families = families
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	families := h.families
+	h.mu.Unlock()
+	w.Header().Set("Content-Type", ContentType)
+	_ = Write(w, families)
+}
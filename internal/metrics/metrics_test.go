@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	refresh := &Family{Name: "tfbench_resource_refresh_seconds", Help: "Refresh time\nof a resource.", Type: TypeGauge}
+	refresh.Add(1.5, "type", "aviatrix_vpc", "quantile", "0.5")
+	refresh.Add(math.Inf(1), "type", `a"b\c`, "quantile", "0.99")
+	runs := &Family{Name: "tfbench_runs_total", Help: "Runs.", Type: TypeCounter}
+	runs.Add(3)
+	empty := &Family{Name: "tfbench_empty", Help: "Empty.", Type: TypeGauge}
+	summary := &Family{Name: "tfbench_refresh_seconds", Help: "Refresh time.", Type: TypeSummary}
+	summary.AddSummary(map[float64]float64{0.9: 3, 0.5: 1}, 7.5, 5, "type", "aviatrix_vpc")
+
+	var b strings.Builder
+	require.NoError(t, Write(&b, []*Family{refresh, empty, runs, summary}))
+	require.Equal(t, `# HELP tfbench_resource_refresh_seconds Refresh time\nof a resource.
+# TYPE tfbench_resource_refresh_seconds gauge
+tfbench_resource_refresh_seconds{quantile="0.5",type="aviatrix_vpc"} 1.5
+tfbench_resource_refresh_seconds{quantile="0.99",type="a\"b\\c"} +Inf
+# HELP tfbench_runs_total Runs.
+# TYPE tfbench_runs_total counter
+tfbench_runs_total 3
+# HELP tfbench_refresh_seconds Refresh time.
+# TYPE tfbench_refresh_seconds summary
+tfbench_refresh_seconds{quantile="0.5",type="aviatrix_vpc"} 1
+tfbench_refresh_seconds{quantile="0.9",type="aviatrix_vpc"} 3
+tfbench_refresh_seconds_sum{type="aviatrix_vpc"} 7.5
+tfbench_refresh_seconds_count{type="aviatrix_vpc"} 5
+`, b.String())
+}
+
+func TestHandler(t *testing.T) {
+	h := &Handler{}
+	runs := &Family{Name: "tfbench_runs_total", Help: "Runs.", Type: TypeCounter}
+	runs.Add(1)
+	h.Set([]*Family{runs})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, ContentType, w.Header().Get("Content-Type"))
+	require.Contains(t, w.Body.String(), "tfbench_runs_total 1\n")
+}
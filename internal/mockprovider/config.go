@@ -0,0 +1,260 @@
+package mockprovider
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ConfigEnv is the environment variable with the path of the config file the
+// mock provider reads its resource types from.
+const ConfigEnv = "TF_BENCH_MOCK_CONFIG"
+
+// DefaultConfig is used when there is no config file.
+const DefaultConfig = `resource "mock_fixed" {
+  read {
+    distribution = "fixed"
+    mean         = "200ms"
+  }
+}
+
+resource "mock_normal" {
+  read {
+    distribution = "normal"
+    mean         = "300ms"
+    stddev       = "50ms"
+  }
+}
+
+resource "mock_lognormal" {
+  read {
+    distribution = "lognormal"
+    mean         = "250ms"
+    stddev       = "100ms"
+  }
+}
+`
+
+// Distribution of the latency of an operation.
+type Distribution string
+
+const (
+	DistributionFixed     Distribution = "fixed"
+	DistributionNormal    Distribution = "normal"
+	DistributionLognormal Distribution = "lognormal"
+)
+
+// Config is the content of a mock provider config file, for example
+//
+//	resource "mock_vpc" {
+//	  read {
+//	    distribution = "lognormal"
+//	    mean         = "250ms"
+//	    stddev       = "100ms"
+//	  }
+//	  create {
+//	    distribution = "fixed"
+//	    mean         = "1s"
+//	    error_rate   = 0.05
+//	  }
+//	}
+//
+// Every resource type is also a data source with the read latency.
+type Config struct {
+	Resources []*Resource // Resources in the order they are declared
+}
+
+// Resource is a mock resource type and the latencies of its operations.
+type Resource struct {
+	Type   string
+	Read   *Latency
+	Create *Latency
+	Delete *Latency
+}
+
+// Latency is the distribution of the duration of an operation and the
+// fraction of operations that fail.
+type Latency struct {
+	Distribution Distribution
+	Mean         time.Duration
+	StdDev       time.Duration
+	ErrorRate    float64
+}
+
+// noLatency is used for operations without a block in the config.
+var noLatency = &Latency{Distribution: DistributionFixed}
+
+// LoadConfig reads the config file at path, or DefaultConfig when path is empty.
+func LoadConfig(path string) (*Config, error) {
+	if path == "" {
+		return ParseConfig([]byte(DefaultConfig), "default")
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read mock provider config: %w", err)
+	}
+	return ParseConfig(src, path)
+}
+
+// ParseConfig parses the source of a config file.
+func ParseConfig(src []byte, filename string) (*Config, error) {
+	f, diags := hclsyntax.ParseConfig(src, filename, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("parsing mock provider config %s: %s", filename, diags.Error())
+	}
+	body := f.Body.(*hclsyntax.Body)
+	for name := range body.Attributes {
+		return nil, fmt.Errorf("unsupported argument %s in mock provider config %s", name, filename)
+	}
+	cfg := &Config{}
+	seen := map[string]bool{}
+	for _, block := range body.Blocks {
+		if block.Type != "resource" || len(block.Labels) != 1 {
+			return nil, fmt.Errorf("mock provider config %s must only contain resource blocks with a type label", filename)
+		}
+		r, err := parseResource(block)
+		if err != nil {
+			return nil, err
+		}
+		if seen[r.Type] {
+			return nil, fmt.Errorf("resource %s is declared more than once", r.Type)
+		}
+		seen[r.Type] = true
+		cfg.Resources = append(cfg.Resources, r)
+	}
+	if len(cfg.Resources) == 0 {
+		return nil, fmt.Errorf("mock provider config %s has no resources", filename)
+	}
+	return cfg, nil
+}
+
+// Resource returns the resource type named typeName, or nil.
+func (c *Config) Resource(typeName string) *Resource {
+	for _, r := range c.Resources {
+		if r.Type == typeName {
+			return r
+		}
+	}
+	return nil
+}
+
+func parseResource(block *hclsyntax.Block) (*Resource, error) {
+	r := &Resource{Type: block.Labels[0], Read: noLatency, Create: noLatency, Delete: noLatency}
+	for name := range block.Body.Attributes {
+		return nil, fmt.Errorf("unsupported argument %s in resource %s", name, r.Type)
+	}
+	for _, b := range block.Body.Blocks {
+		l, err := parseLatency(b.Body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s latency of %s: %w", b.Type, r.Type, err)
+		}
+		switch b.Type {
+		case "read":
+			r.Read = l
+		case "create":
+			r.Create = l
+		case "delete":
+			r.Delete = l
+		default:
+			return nil, fmt.Errorf("unsupported block %s in resource %s", b.Type, r.Type)
+		}
+	}
+	return r, nil
+}
+
+func parseLatency(body *hclsyntax.Body) (*Latency, error) {
+	l := &Latency{Distribution: DistributionFixed}
+	var names []string
+	for name := range body.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		val, diags := body.Attributes[name].Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("%s: %s", name, diags.Error())
+		}
+		switch name {
+		case "distribution", "mean", "stddev":
+			if val.IsNull() || val.Type() != cty.String {
+				return nil, fmt.Errorf("%s must be a string", name)
+			}
+		case "error_rate":
+			if val.IsNull() || val.Type() != cty.Number {
+				return nil, fmt.Errorf("%s must be a number", name)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported argument %s", name)
+		}
+		var err error
+		switch name {
+		case "distribution":
+			l.Distribution = Distribution(val.AsString())
+		case "mean":
+			l.Mean, err = time.ParseDuration(val.AsString())
+		case "stddev":
+			l.StdDev, err = time.ParseDuration(val.AsString())
+		case "error_rate":
+			l.ErrorRate, _ = val.AsBigFloat().Float64()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	switch l.Distribution {
+	case DistributionFixed:
+		if l.StdDev != 0 {
+			return nil, fmt.Errorf("a fixed latency has no stddev")
+		}
+	case DistributionNormal, DistributionLognormal:
+	default:
+		return nil, fmt.Errorf("distribution must be fixed, normal or lognormal, not %q", l.Distribution)
+	}
+	if l.Mean < 0 || l.StdDev < 0 {
+		return nil, fmt.Errorf("mean and stddev must not be negative")
+	}
+	if l.Distribution == DistributionLognormal && l.Mean == 0 {
+		return nil, fmt.Errorf("a lognormal latency needs a mean greater than zero")
+	}
+	if l.ErrorRate < 0 || l.ErrorRate > 1 {
+		return nil, fmt.Errorf("error_rate must be between 0 and 1")
+	}
+	return l, nil
+}
+
+// Sample draws a duration from the distribution. Normal samples are
+// clamped at zero.
+func (l *Latency) Sample(rnd *rand.Rand) time.Duration {
+	switch l.Distribution {
+	case DistributionNormal:
+		d := float64(l.Mean) + float64(l.StdDev)*rnd.NormFloat64()
+		if d < 0 {
+			return 0
+		}
+		return time.Duration(d)
+	case DistributionLognormal:
+		mu, sigma := l.lognormalParams()
+		return time.Duration(math.Exp(mu + sigma*rnd.NormFloat64()))
+	}
+	return l.Mean
+}
+
+// lognormalParams returns the parameters of the log of a lognormal latency,
+// chosen so that the latency itself has the configured mean and stddev.
+func (l *Latency) lognormalParams() (mu, sigma float64) {
+	mean, sd := float64(l.Mean), float64(l.StdDev)
+	variance := math.Log(1 + sd*sd/(mean*mean))
+	return math.Log(mean) - variance/2, math.Sqrt(variance)
+}
+
+// Fail draws whether an operation fails.
+func (l *Latency) Fail(rnd *rand.Rand) bool {
+	return l.ErrorRate > 0 && rnd.Float64() < l.ErrorRate
+}
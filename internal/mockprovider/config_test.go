@@ -0,0 +1,77 @@
+package mockprovider
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gonum.org/v1/gonum/stat"
+)
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`resource "mock_vpc" {
+  read {
+    distribution = "lognormal"
+    mean         = "250ms"
+    stddev       = "100ms"
+  }
+  create {
+    mean       = "1s"
+    error_rate = 0.05
+  }
+}
+`), "mock.hcl")
+	require.NoError(t, err)
+	r := cfg.Resource("mock_vpc")
+	require.NotNil(t, r)
+	require.Equal(t, &Latency{Distribution: DistributionLognormal, Mean: 250 * time.Millisecond, StdDev: 100 * time.Millisecond}, r.Read)
+	require.Equal(t, &Latency{Distribution: DistributionFixed, Mean: time.Second, ErrorRate: 0.05}, r.Create)
+	require.Equal(t, noLatency, r.Delete)
+	require.Nil(t, cfg.Resource("mock_subnet"))
+
+	cfg, err = LoadConfig("")
+	require.NoError(t, err)
+	require.Len(t, cfg.Resources, 3)
+
+	for _, src := range []string{
+		``,
+		`resource "mock_vpc" { update {} }`,
+		`resource "mock_vpc" { read { distribution = "uniform" } }`,
+		`resource "mock_vpc" { read { mean = "fast" } }`,
+		`resource "mock_vpc" { read { stddev = "1s" } }`,
+		`resource "mock_vpc" { read { error_rate = 2 } }`,
+		`resource "mock_vpc" {}
+resource "mock_vpc" {}`,
+	} {
+		_, err = ParseConfig([]byte(src), "mock.hcl")
+		require.Error(t, err, src)
+	}
+}
+
+func TestLatencySample(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, l := range []*Latency{
+		{Distribution: DistributionFixed, Mean: 200 * time.Millisecond},
+		{Distribution: DistributionNormal, Mean: 300 * time.Millisecond, StdDev: 50 * time.Millisecond},
+		{Distribution: DistributionLognormal, Mean: 250 * time.Millisecond, StdDev: 100 * time.Millisecond},
+	} {
+		var xs []float64
+		for i := 0; i < 20000; i++ {
+			xs = append(xs, float64(l.Sample(rnd)))
+		}
+		mean, sd := stat.MeanStdDev(xs, nil)
+		require.InEpsilon(t, float64(l.Mean), mean, 0.02, l.Distribution)
+		require.InDelta(t, float64(l.StdDev), sd, 0.05*float64(l.StdDev), l.Distribution)
+	}
+
+	l := &Latency{ErrorRate: 0.25}
+	failed := 0
+	for i := 0; i < 10000; i++ {
+		if l.Fail(rnd) {
+			failed++
+		}
+	}
+	require.InDelta(t, 2500, failed, 200)
+	require.False(t, noLatency.Fail(rnd))
+}
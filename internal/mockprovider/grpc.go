@@ -0,0 +1,237 @@
+package mockprovider
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Terraform starts providers through go-plugin, which checks a magic cookie,
+// negotiates mutual TLS and then talks gRPC over HTTP/2. The standard
+// library HTTP/2 server is enough for the unary calls of the provider
+// protocol.
+const (
+	magicCookieKey   = "TF_PLUGIN_MAGIC_COOKIE"
+	magicCookieValue = "d602bf8f470bc67ca7faa0386276bbdd4330efaf76d1a219cb4d6991ca9872b2"
+	protocolVersion  = 5
+)
+
+// gRPC status codes returned by the server.
+const (
+	codeOK            = 0
+	codeInvalidArg    = 3
+	codeUnimplemented = 12
+	codeInternal      = 13
+)
+
+// unaryHandler handles a decoded gRPC request message and returns the response message.
+type unaryHandler func(req []byte) (message, error)
+
+// grpcServer serves unary gRPC methods by their full path, for example
+// /tfplugin5.Provider/GetSchema.
+type grpcServer struct {
+	methods      map[string]unaryHandler
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+}
+
+func newGRPCServer(methods map[string]unaryHandler) *grpcServer {
+	s := &grpcServer{methods: methods, shutdown: make(chan struct{})}
+	for path, handler := range s.pluginMethods() {
+		s.methods[path] = handler
+	}
+	return s
+}
+
+func (s *grpcServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/grpc")
+	handler, ok := s.methods[r.URL.Path]
+	if !ok {
+		// Streaming methods such as the go-plugin broker are not
+		// supported, and their body is never closed, so do not read it.
+		writeStatus(w, codeUnimplemented, "method "+r.URL.Path+" is not implemented by the mock provider")
+		return
+	}
+	req, err := readFrame(r.Body)
+	if err != nil {
+		writeStatus(w, codeInvalidArg, err.Error())
+		return
+	}
+	resp, err := handler(req)
+	if err != nil {
+		writeStatus(w, codeInternal, err.Error())
+		return
+	}
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(frame(resp))
+	writeStatus(w, codeOK, "")
+}
+
+// writeStatus sets the gRPC status of a response, in the trailers after a
+// message or in the headers of a response without one.
+func writeStatus(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		w.Header().Set("Grpc-Message", msg)
+	}
+}
+
+// readFrame reads a length prefixed gRPC message.
+func readFrame(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	_, err := io.ReadFull(r, prefix[:])
+	if err != nil {
+		return nil, fmt.Errorf("could not read gRPC message: %w", err)
+	}
+	if prefix[0] != 0 {
+		return nil, fmt.Errorf("compressed gRPC messages are not supported")
+	}
+	b := make([]byte, binary.BigEndian.Uint32(prefix[1:]))
+	_, err = io.ReadFull(r, b)
+	if err != nil {
+		return nil, fmt.Errorf("could not read gRPC message: %w", err)
+	}
+	return b, nil
+}
+
+// frame length prefixes a gRPC message.
+func frame(m message) []byte {
+	b := make([]byte, 5, 5+len(m))
+	binary.BigEndian.PutUint32(b[1:], uint32(len(m)))
+	return append(b, m...)
+}
+
+// pluginMethods are the go-plugin services every plugin serves next to its own.
+func (s *grpcServer) pluginMethods() map[string]unaryHandler {
+	return map[string]unaryHandler{
+		"/grpc.health.v1.Health/Check": func(req []byte) (message, error) {
+			var resp message
+			resp.varint(1, 1) // SERVING
+			return resp, nil
+		},
+		"/plugin.GRPCController/Shutdown": func(req []byte) (message, error) {
+			s.shutdownOnce.Do(func() {
+				close(s.shutdown)
+			})
+			return nil, nil
+		},
+	}
+}
+
+// serve serves TLS connections from ln until the plugin is shut down.
+func (s *grpcServer) serve(ln net.Listener, tlsConfig *tls.Config) error {
+	srv := &http.Server{
+		Handler:   s,
+		TLSConfig: tlsConfig,
+		// Errors on stderr would end up in the terraform log as plugin output.
+		ErrorLog: log.New(ioutil.Discard, "", 0),
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ServeTLS(ln, "", "")
+	}()
+	select {
+	case err := <-errs:
+		return fmt.Errorf("mock provider server: %w", err)
+	case <-s.shutdown:
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_ = srv.Shutdown(ctx)
+	return nil
+}
+
+// serveGRPC performs the go-plugin handshake on stdout and serves methods
+// until terraform shuts the plugin down.
+func serveGRPC(methods map[string]unaryHandler) error {
+	if os.Getenv(magicCookieKey) != magicCookieValue {
+		return fmt.Errorf("the mock provider is a terraform plugin and is not meant to be run directly, use it through dev_overrides")
+	}
+	if versions := os.Getenv("PLUGIN_PROTOCOL_VERSIONS"); versions != "" && !containsVersion(versions, protocolVersion) {
+		return fmt.Errorf("terraform does not support plugin protocol version %d, only %s", protocolVersion, versions)
+	}
+	clientCert := os.Getenv("PLUGIN_CLIENT_CERT")
+	if clientCert == "" {
+		return fmt.Errorf("terraform did not pass a client certificate, the mock provider only supports mutual TLS")
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM([]byte(clientCert)) {
+		return fmt.Errorf("could not parse the client certificate passed by terraform")
+	}
+	cert, err := generateCert()
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("could not listen: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+		MinVersion:   tls.VersionTLS12,
+	}
+	fmt.Printf("1|%d|tcp|%s|grpc|%s\n", protocolVersion, ln.Addr().String(),
+		base64.RawStdEncoding.EncodeToString(cert.Certificate[0]))
+	return newGRPCServer(methods).serve(ln, tlsConfig)
+}
+
+// containsVersion reports whether a comma separated list of protocol versions contains v.
+func containsVersion(versions string, v int) bool {
+	for _, s := range strings.Split(versions, ",") {
+		if strings.TrimSpace(s) == strconv.Itoa(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// generateCert returns a self-signed certificate for localhost, which
+// terraform trusts because it is passed in the handshake.
+func generateCert() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("could not generate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("could not generate serial number: %w", err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "localhost", Organization: []string{"tf-bench"}},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             now.Add(-30 * time.Second),
+		NotAfter:              now.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("could not create certificate: %w", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -0,0 +1,138 @@
+package mockprovider
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"math/rand"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProtobufRoundTrip(t *testing.T) {
+	var inner message
+	inner.bytes(1, []byte{0xc0})
+	var m message
+	m.string(1, "mock_vpc")
+	m.embed(2, inner)
+	m.varint(3, 300)
+	m.bool(4, false)
+	m.embed(5, nil)
+
+	f, err := decode(m)
+	require.NoError(t, err)
+	require.Equal(t, "mock_vpc", f.string(1))
+	dv, err := f.embedded(2)
+	require.NoError(t, err)
+	require.True(t, isNull(dv))
+	require.Equal(t, []byte{0xac, 0x02}, f.bytes(3))
+	require.NotContains(t, f, 4)
+	require.Contains(t, f, 5)
+
+	_, err = decode([]byte{0x0a, 0x05, 'm'})
+	require.Error(t, err)
+}
+
+func TestGRPCServer(t *testing.T) {
+	serverCert, err := generateCert()
+	require.NoError(t, err)
+	clientCert, err := generateCert()
+	require.NoError(t, err)
+	clientCAs, roots := x509.NewCertPool(), x509.NewCertPool()
+	leaf, err := x509.ParseCertificate(clientCert.Certificate[0])
+	require.NoError(t, err)
+	clientCAs.AddCert(leaf)
+	leaf, err = x509.ParseCertificate(serverCert.Certificate[0])
+	require.NoError(t, err)
+	roots.AddCert(leaf)
+
+	cfg, err := LoadConfig("")
+	require.NoError(t, err)
+	p := &provider{cfg: cfg, rnd: rand.New(rand.NewSource(1))}
+	s := newGRPCServer(p.methods())
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	served := make(chan error, 1)
+	go func() {
+		served <- s.serve(ln, &tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    clientCAs,
+		})
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{
+			Certificates: []tls.Certificate{clientCert},
+			RootCAs:      roots,
+			ServerName:   "localhost",
+		},
+		ForceAttemptHTTP2: true,
+	}}
+	call := func(method string, req message) (fields, string) {
+		resp, err := client.Post("https://"+ln.Addr().String()+method, "application/grpc", bytes.NewReader(frame(req)))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, 2, resp.ProtoMajor)
+		if status := resp.Header.Get("Grpc-Status"); status != "" {
+			return nil, status
+		}
+		b, err := readFrame(resp.Body)
+		require.NoError(t, err)
+		f, err := decode(b)
+		require.NoError(t, err)
+		_, _ = resp.Body.Read(make([]byte, 1))
+		return f, resp.Trailer.Get("Grpc-Status")
+	}
+
+	f, status := call("/grpc.health.v1.Health/Check", nil)
+	require.Equal(t, "0", status)
+	require.Equal(t, []byte{1}, f.bytes(1))
+
+	f, status = call("/tfplugin5.Provider/GetSchema", nil)
+	require.Equal(t, "0", status)
+	require.Len(t, f[2], 3)
+	require.Len(t, f[3], 3)
+	entry, err := decode(f[2][0])
+	require.NoError(t, err)
+	require.Equal(t, "mock_fixed", entry.string(1))
+
+	var state message
+	state.bytes(1, []byte{0x81, 0xa4, 'n', 'a', 'm', 'e', 0xa1, 'a'})
+	var req message
+	req.string(1, "mock_vpc")
+	req.embed(2, state)
+	f, status = call("/tfplugin5.Provider/ReadResource", req)
+	require.Equal(t, "0", status)
+	diag, err := f.embedded(2)
+	require.NoError(t, err)
+	require.Contains(t, diag.string(2), "mock_vpc")
+
+	req = nil
+	req.string(1, "mock_fixed")
+	req.embed(2, state)
+	req.bytes(3, []byte("private"))
+	start := time.Now()
+	f, status = call("/tfplugin5.Provider/ReadResource", req)
+	require.Equal(t, "0", status)
+	require.GreaterOrEqual(t, int64(time.Since(start)), int64(200*time.Millisecond))
+	require.Equal(t, []byte(state), f.bytes(1))
+	require.Equal(t, "private", f.string(3))
+	require.NotContains(t, f, 2)
+
+	_, status = call("/plugin.GRPCBroker/StartStream", nil)
+	require.Equal(t, "12", status)
+
+	_, status = call("/plugin.GRPCController/Shutdown", nil)
+	require.Equal(t, "0", status)
+	select {
+	case err := <-served:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+}
@@ -0,0 +1,134 @@
+package mockprovider
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// The plugin protocol is protobuf over gRPC. The mock provider only needs a
+// handful of messages, so it encodes and decodes them by field number
+// instead of depending on generated code.
+
+const (
+	wireVarint = 0
+	wire64     = 1
+	wireBytes  = 2
+	wire32     = 5
+)
+
+// message is an encoded protobuf message.
+type message []byte
+
+func (m *message) tag(field, wire int) {
+	*m = appendUvarint(*m, uint64(field)<<3|uint64(wire))
+}
+
+// varint appends a varint field, omitting the default zero as proto3 does.
+func (m *message) varint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	m.tag(field, wireVarint)
+	*m = appendUvarint(*m, v)
+}
+
+func (m *message) bool(field int, v bool) {
+	if v {
+		m.varint(field, 1)
+	}
+}
+
+// bytes appends a bytes field, omitting the default empty value.
+func (m *message) bytes(field int, b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	m.embed(field, b)
+}
+
+func (m *message) string(field int, s string) {
+	m.bytes(field, []byte(s))
+}
+
+// embed appends a message field. It is written even when empty, because an
+// empty message is not the same as an absent one.
+func (m *message) embed(field int, b []byte) {
+	m.tag(field, wireBytes)
+	*m = appendUvarint(*m, uint64(len(b)))
+	*m = append(*m, b...)
+}
+
+// appendUvarint appends the varint encoding of v to b.
+func appendUvarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// fields is a decoded message, the length delimited values of every field
+// number in the order they were encoded. Scalar fields are kept encoded.
+type fields map[int][][]byte
+
+// decode splits an encoded message into its fields.
+func decode(b []byte) (fields, error) {
+	f := fields{}
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid protobuf field key")
+		}
+		b = b[n:]
+		field, wire := int(key>>3), int(key&7)
+		switch wire {
+		case wireVarint:
+			_, n = binary.Uvarint(b)
+			if n <= 0 {
+				return nil, fmt.Errorf("invalid protobuf varint in field %d", field)
+			}
+			f[field] = append(f[field], b[:n])
+			b = b[n:]
+		case wire64, wire32:
+			size := 8
+			if wire == wire32 {
+				size = 4
+			}
+			if len(b) < size {
+				return nil, fmt.Errorf("truncated protobuf field %d", field)
+			}
+			f[field] = append(f[field], b[:size])
+			b = b[size:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return nil, fmt.Errorf("truncated protobuf field %d", field)
+			}
+			b = b[n:]
+			f[field] = append(f[field], b[:l])
+			b = b[l:]
+		default:
+			return nil, fmt.Errorf("unsupported protobuf wire type %d in field %d", wire, field)
+		}
+	}
+	return f, nil
+}
+
+// bytes returns the last value of a length delimited field, as protobuf
+// merges repeated occurrences of a singular field.
+func (f fields) bytes(field int) []byte {
+	values := f[field]
+	if len(values) == 0 {
+		return nil
+	}
+	return values[len(values)-1]
+}
+
+func (f fields) string(field int) string {
+	return string(f.bytes(field))
+}
+
+// embedded decodes the last value of a message field.
+func (f fields) embedded(field int) (fields, error) {
+	return decode(f.bytes(field))
+}
@@ -0,0 +1,224 @@
+package mockprovider
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// provider implements the tfplugin5 provider service. Its resources store
+// their configuration as they are and only wait for the configured latency
+// of every operation.
+type provider struct {
+	cfg *Config
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// Serve runs the mock provider as a terraform plugin until terraform shuts it down.
+func Serve(cfg *Config) error {
+	p := &provider{cfg: cfg, rnd: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	return serveGRPC(p.methods())
+}
+
+func (p *provider) methods() map[string]unaryHandler {
+	empty := func(req []byte) (message, error) {
+		return nil, nil
+	}
+	return map[string]unaryHandler{
+		"/tfplugin5.Provider/GetSchema":                  p.getSchema,
+		"/tfplugin5.Provider/PrepareProviderConfig":      p.prepareProviderConfig,
+		"/tfplugin5.Provider/ValidateResourceTypeConfig": empty,
+		"/tfplugin5.Provider/ValidateDataSourceConfig":   empty,
+		"/tfplugin5.Provider/UpgradeResourceState":       p.upgradeResourceState,
+		"/tfplugin5.Provider/Configure":                  empty,
+		"/tfplugin5.Provider/ReadResource":               p.readResource,
+		"/tfplugin5.Provider/PlanResourceChange":         p.planResourceChange,
+		"/tfplugin5.Provider/ApplyResourceChange":        p.applyResourceChange,
+		"/tfplugin5.Provider/ImportResourceState":        p.importResourceState,
+		"/tfplugin5.Provider/ReadDataSource":             p.readDataSource,
+		"/tfplugin5.Provider/Stop":                       empty,
+	}
+}
+
+// resourceSchema is the schema of every mock resource and data source, a
+// single optional name to tell instances apart.
+func resourceSchema() message {
+	var attr message
+	attr.string(1, "name")
+	attr.bytes(2, []byte(`"string"`))
+	attr.bool(5, true)
+	var block message
+	block.embed(2, attr)
+	var schema message
+	schema.embed(2, block)
+	return schema
+}
+
+func (p *provider) getSchema(req []byte) (message, error) {
+	var providerSchema message
+	providerSchema.embed(2, nil)
+	var resp message
+	resp.embed(1, providerSchema)
+	for _, r := range p.cfg.Resources {
+		var entry message
+		entry.string(1, r.Type)
+		entry.embed(2, resourceSchema())
+		resp.embed(2, entry)
+		resp.embed(3, entry)
+	}
+	return resp, nil
+}
+
+func (p *provider) prepareProviderConfig(req []byte) (message, error) {
+	f, err := decode(req)
+	if err != nil {
+		return nil, err
+	}
+	var resp message
+	resp.embed(1, f.bytes(1))
+	return resp, nil
+}
+
+func (p *provider) upgradeResourceState(req []byte) (message, error) {
+	f, err := decode(req)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := f.embedded(3)
+	if err != nil {
+		return nil, err
+	}
+	// The schema never changes, so the stored JSON is the upgraded state.
+	var state message
+	state.bytes(2, raw.bytes(1))
+	var resp message
+	resp.embed(1, state)
+	return resp, nil
+}
+
+func (p *provider) readResource(req []byte) (message, error) {
+	f, err := decode(req)
+	if err != nil {
+		return nil, err
+	}
+	var resp message
+	r, err := p.resource(f.string(1))
+	if err == nil {
+		err = p.wait(r.Read, "read")
+	}
+	if err != nil {
+		resp.embed(2, diagnostic(err))
+		return resp, nil
+	}
+	resp.embed(1, f.bytes(2))
+	resp.bytes(3, f.bytes(3))
+	return resp, nil
+}
+
+func (p *provider) planResourceChange(req []byte) (message, error) {
+	f, err := decode(req)
+	if err != nil {
+		return nil, err
+	}
+	var resp message
+	if _, err := p.resource(f.string(1)); err != nil {
+		resp.embed(4, diagnostic(err))
+		return resp, nil
+	}
+	resp.embed(1, f.bytes(3))
+	return resp, nil
+}
+
+func (p *provider) applyResourceChange(req []byte) (message, error) {
+	f, err := decode(req)
+	if err != nil {
+		return nil, err
+	}
+	var resp message
+	r, err := p.resource(f.string(1))
+	if err == nil {
+		prior, err1 := decode(f.bytes(2))
+		planned, err2 := decode(f.bytes(3))
+		switch {
+		case err1 != nil || err2 != nil:
+			err = fmt.Errorf("invalid state in apply request")
+		case isNull(planned):
+			err = p.wait(r.Delete, "delete")
+		case isNull(prior):
+			err = p.wait(r.Create, "create")
+		}
+	}
+	if err != nil {
+		resp.embed(3, diagnostic(err))
+		return resp, nil
+	}
+	resp.embed(1, f.bytes(3))
+	return resp, nil
+}
+
+func (p *provider) importResourceState(req []byte) (message, error) {
+	var resp message
+	resp.embed(2, diagnostic(fmt.Errorf("mock resources can not be imported")))
+	return resp, nil
+}
+
+func (p *provider) readDataSource(req []byte) (message, error) {
+	f, err := decode(req)
+	if err != nil {
+		return nil, err
+	}
+	var resp message
+	r, err := p.resource(f.string(1))
+	if err == nil {
+		err = p.wait(r.Read, "read")
+	}
+	if err != nil {
+		resp.embed(2, diagnostic(err))
+		return resp, nil
+	}
+	resp.embed(1, f.bytes(2))
+	return resp, nil
+}
+
+func (p *provider) resource(typeName string) (*Resource, error) {
+	r := p.cfg.Resource(typeName)
+	if r == nil {
+		return nil, fmt.Errorf("resource type %s is not in the mock provider config", typeName)
+	}
+	return r, nil
+}
+
+// wait sleeps for a latency drawn from l, and returns an error for the
+// configured fraction of operations.
+func (p *provider) wait(l *Latency, operation string) error {
+	p.mu.Lock()
+	d := l.Sample(p.rnd)
+	fail := l.Fail(p.rnd)
+	p.mu.Unlock()
+	time.Sleep(d)
+	if fail {
+		return fmt.Errorf("injected %s error after %s", operation, d)
+	}
+	return nil
+}
+
+// isNull reports whether a decoded DynamicValue is null, which is how
+// terraform passes the state of a resource that does not exist.
+func isNull(dv fields) bool {
+	msgpack, json := dv.bytes(1), dv.bytes(2)
+	if len(msgpack) > 0 {
+		return len(msgpack) == 1 && msgpack[0] == 0xc0
+	}
+	return len(json) == 0 || string(json) == "null"
+}
+
+// diagnostic encodes err as an error diagnostic.
+func diagnostic(err error) message {
+	var d message
+	d.varint(1, 1) // ERROR
+	d.string(2, err.Error())
+	return d
+}
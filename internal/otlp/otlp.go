@@ -0,0 +1,252 @@
+// Package otlp exports traces over OTLP/HTTP with the JSON encoding. It only
+// implements the parts of the protocol tf-bench needs, to not depend on the
+// OpenTelemetry SDK.
+package otlp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tracesPath is the path traces are posted to under an OTLP/HTTP endpoint.
+const tracesPath = "/v1/traces"
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// SpanID identifies a span in a trace.
+type SpanID [8]byte
+
+// NewTraceID returns a random trace ID.
+func NewTraceID() (TraceID, error) {
+	var id TraceID
+	_, err := rand.Read(id[:])
+	return id, err
+}
+
+// NewSpanID returns a random span ID.
+func NewSpanID() (SpanID, error) {
+	var id SpanID
+	_, err := rand.Read(id[:])
+	return id, err
+}
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanID) isZero() bool {
+	return id == SpanID{}
+}
+
+// Attribute is a key and a value of type string, int64, float64 or bool.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string attribute.
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int returns an integer attribute.
+func Int(key string, value int64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Float returns a floating point attribute.
+func Float(key string, value float64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Bool returns a boolean attribute.
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Span is a timed operation in a trace.
+type Span struct {
+	TraceID      TraceID
+	SpanID       SpanID
+	ParentSpanID SpanID // ParentSpanID is zero for the root span
+	Name         string
+	Start        time.Time
+	End          time.Time
+	Attributes   []Attribute
+	Error        string // Error sets the status of the span to error with this message
+}
+
+// Exporter posts traces to an OTLP/HTTP endpoint.
+type Exporter struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+// NewExporter returns an exporter to the OTLP/HTTP endpoint, such as
+// http://localhost:4318. /v1/traces is added to the endpoint unless it ends
+// with it already. The headers are sent with every request, for example to
+// authenticate.
+func NewExporter(endpoint string, headers map[string]string) (*Exporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q: %w", endpoint, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q: must be an http or https URL", endpoint)
+	}
+	if !strings.HasSuffix(u.Path, tracesPath) {
+		u.Path = strings.TrimSuffix(u.Path, "/") + tracesPath
+	}
+	return &Exporter{
+		url:     u.String(),
+		headers: headers,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Export posts spans as one trace request, with the resource attributes
+// describing the service that produced them.
+func (e *Exporter) Export(resource []Attribute, scope string, version string, spans []*Span) error {
+	body, err := json.Marshal(newRequest(resource, scope, version, spans))
+	if err != nil {
+		return fmt.Errorf("could not encode trace: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("could not create OTLP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not export trace to %s: %w", e.url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("could not export trace to %s: %s: %s", e.url, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// The JSON encoding of ExportTraceServiceRequest. IDs are hex strings, 64 bit
+// integers are decimal strings and enums are numbers.
+type (
+	exportRequest struct {
+		ResourceSpans []resourceSpans `json:"resourceSpans"`
+	}
+	resourceSpans struct {
+		Resource   resource     `json:"resource"`
+		ScopeSpans []scopeSpans `json:"scopeSpans"`
+	}
+	resource struct {
+		Attributes []keyValue `json:"attributes"`
+	}
+	scopeSpans struct {
+		Scope scope      `json:"scope"`
+		Spans []jsonSpan `json:"spans"`
+	}
+	scope struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+	}
+	jsonSpan struct {
+		TraceID           string     `json:"traceId"`
+		SpanID            string     `json:"spanId"`
+		ParentSpanID      string     `json:"parentSpanId,omitempty"`
+		Name              string     `json:"name"`
+		Kind              int        `json:"kind"`
+		StartTimeUnixNano string     `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+		Attributes        []keyValue `json:"attributes,omitempty"`
+		Status            status     `json:"status"`
+	}
+	status struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+	keyValue struct {
+		Key   string   `json:"key"`
+		Value anyValue `json:"value"`
+	}
+	anyValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+	}
+)
+
+const (
+	spanKindInternal = 1
+	statusCodeUnset  = 0
+	statusCodeError  = 2
+)
+
+func newRequest(resourceAttributes []Attribute, scopeName, version string, spans []*Span) *exportRequest {
+	jsonSpans := make([]jsonSpan, len(spans))
+	for i, s := range spans {
+		js := jsonSpan{
+			TraceID:           s.TraceID.String(),
+			SpanID:            s.SpanID.String(),
+			Name:              s.Name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        keyValues(s.Attributes),
+			Status:            status{Code: statusCodeUnset},
+		}
+		if !s.ParentSpanID.isZero() {
+			js.ParentSpanID = s.ParentSpanID.String()
+		}
+		if s.Error != "" {
+			js.Status = status{Code: statusCodeError, Message: s.Error}
+		}
+		jsonSpans[i] = js
+	}
+	return &exportRequest{ResourceSpans: []resourceSpans{{
+		Resource:   resource{Attributes: keyValues(resourceAttributes)},
+		ScopeSpans: []scopeSpans{{Scope: scope{Name: scopeName, Version: version}, Spans: jsonSpans}},
+	}}}
+}
+
+func keyValues(attributes []Attribute) []keyValue {
+	var kvs []keyValue
+	for _, a := range attributes {
+		var v anyValue
+		switch value := a.Value.(type) {
+		case string:
+			v.StringValue = &value
+		case int64:
+			s := strconv.FormatInt(value, 10)
+			v.IntValue = &s
+		case float64:
+			v.DoubleValue = &value
+		case bool:
+			v.BoolValue = &value
+		default:
+			s := fmt.Sprint(value)
+			v.StringValue = &s
+		}
+		kvs = append(kvs, keyValue{Key: a.Key, Value: v})
+	}
+	return kvs
+}
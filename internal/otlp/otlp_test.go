@@ -0,0 +1,99 @@
+package otlp
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewExporter(t *testing.T) {
+	for endpoint, want := range map[string]string{
+		"http://localhost:4318":                   "http://localhost:4318/v1/traces",
+		"https://otel.example.com/otlp/":          "https://otel.example.com/otlp/v1/traces",
+		"http://localhost:4318/v1/traces":         "http://localhost:4318/v1/traces",
+		"https://otel.example.com/otlp/v1/traces": "https://otel.example.com/otlp/v1/traces",
+	} {
+		e, err := NewExporter(endpoint, nil)
+		require.NoError(t, err, endpoint)
+		require.Equal(t, want, e.url)
+	}
+	for _, endpoint := range []string{"localhost:4318", "grpc://localhost:4317", "http://"} {
+		_, err := NewExporter(endpoint, nil)
+		require.Error(t, err, endpoint)
+	}
+}
+
+func TestExport(t *testing.T) {
+	var body map[string]interface{}
+	var header http.Header
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/traces", r.URL.Path)
+		header = r.Header
+		b, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(b, &body))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	traceID, err := NewTraceID()
+	require.NoError(t, err)
+	rootID, err := NewSpanID()
+	require.NoError(t, err)
+	childID, err := NewSpanID()
+	require.NoError(t, err)
+	start := time.Unix(1700000000, 0)
+	spans := []*Span{
+		{TraceID: traceID, SpanID: rootID, Name: "root", Start: start, End: start.Add(time.Second),
+			Attributes: []Attribute{String("a", "b"), Int("n", 3), Float("f", 1.5), Bool("ok", true)}},
+		{TraceID: traceID, SpanID: childID, ParentSpanID: rootID, Name: "child", Start: start, End: start.Add(time.Millisecond), Error: "failed"},
+	}
+	e, err := NewExporter(collector.URL, map[string]string{"Authorization": "Bearer token"})
+	require.NoError(t, err)
+	require.NoError(t, e.Export([]Attribute{String("service.name", "tf-bench")}, "tf-bench", "v1.0.0", spans))
+	require.Equal(t, "application/json", header.Get("Content-Type"))
+	require.Equal(t, "Bearer token", header.Get("Authorization"))
+
+	resourceSpans := body["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	require.Equal(t, map[string]interface{}{"attributes": []interface{}{
+		map[string]interface{}{"key": "service.name", "value": map[string]interface{}{"stringValue": "tf-bench"}},
+	}}, resourceSpans["resource"])
+	scopeSpans := resourceSpans["scopeSpans"].([]interface{})[0].(map[string]interface{})
+	require.Equal(t, map[string]interface{}{"name": "tf-bench", "version": "v1.0.0"}, scopeSpans["scope"])
+	got := scopeSpans["spans"].([]interface{})
+	require.Len(t, got, 2)
+	root := got[0].(map[string]interface{})
+	require.Equal(t, traceID.String(), root["traceId"])
+	require.Len(t, root["traceId"], 32)
+	require.Equal(t, rootID.String(), root["spanId"])
+	require.NotContains(t, root, "parentSpanId")
+	require.Equal(t, "1700000000000000000", root["startTimeUnixNano"])
+	require.Equal(t, "1700000001000000000", root["endTimeUnixNano"])
+	require.Equal(t, []interface{}{
+		map[string]interface{}{"key": "a", "value": map[string]interface{}{"stringValue": "b"}},
+		map[string]interface{}{"key": "n", "value": map[string]interface{}{"intValue": "3"}},
+		map[string]interface{}{"key": "f", "value": map[string]interface{}{"doubleValue": 1.5}},
+		map[string]interface{}{"key": "ok", "value": map[string]interface{}{"boolValue": true}},
+	}, root["attributes"])
+	require.Equal(t, map[string]interface{}{"code": 0.0}, root["status"])
+	child := got[1].(map[string]interface{})
+	require.Equal(t, rootID.String(), child["parentSpanId"])
+	require.Equal(t, map[string]interface{}{"code": 2.0, "message": "failed"}, child["status"])
+}
+
+func TestExportError(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer collector.Close()
+	e, err := NewExporter(collector.URL, nil)
+	require.NoError(t, err)
+	err = e.Export(nil, "tf-bench", "", nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "400 Bad Request: bad request")
+}
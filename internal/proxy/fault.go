@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultFaultStatus is the status of injected errors when none is configured.
+const defaultFaultStatus = http.StatusServiceUnavailable
+
+// RegistryHosts are the hosts providers and modules are installed from. Rules
+// without a host should not slow down or fail installing them, see
+// Options.ExemptHosts.
+var RegistryHosts = []string{"registry.terraform.io", "registry.opentofu.org", "releases.hashicorp.com"}
+
+// Fault is latency and errors injected into the API calls to matching hosts.
+type Fault struct {
+	Host      string        // Host is a glob of the hosts the fault applies to, empty for every host but the exempt hosts
+	Latency   time.Duration // Latency added to every call
+	Jitter    time.Duration // Jitter is the maximum random latency added on top of Latency
+	ErrorRate float64       // ErrorRate is the fraction of calls answered with Status instead of being forwarded
+	Status    int           // Status of injected errors, 503 when not set
+}
+
+// ParseFault parses a fault rule such as
+// host=controller.example.com,latency=200ms,jitter=50ms,error-rate=0.05,status=429.
+func ParseFault(s string) (*Fault, error) {
+	f := &Fault{}
+	for _, part := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("fault rule %q must be comma separated key=value pairs", s)
+		}
+		var err error
+		switch kv[0] {
+		case "host":
+			f.Host = kv[1]
+			_, err = path.Match(f.Host, "")
+		case "latency":
+			f.Latency, err = time.ParseDuration(kv[1])
+		case "jitter":
+			f.Jitter, err = time.ParseDuration(kv[1])
+		case "error-rate":
+			f.ErrorRate, err = strconv.ParseFloat(kv[1], 64)
+		case "status":
+			f.Status, err = strconv.Atoi(kv[1])
+		default:
+			return nil, fmt.Errorf("unknown key %s in fault rule %q, must be host, latency, jitter, error-rate or status", kv[0], s)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in fault rule %q: %w", kv[0], s, err)
+		}
+	}
+	return f, f.Validate()
+}
+
+// Validate checks that the fault can be injected.
+func (f *Fault) Validate() error {
+	if f.Latency < 0 || f.Jitter < 0 {
+		return fmt.Errorf("injected latency and jitter must not be negative")
+	}
+	if f.ErrorRate < 0 || f.ErrorRate > 1 {
+		return fmt.Errorf("injected error rate must be between 0 and 1")
+	}
+	if f.Status != 0 && (f.Status < 400 || f.Status > 599) {
+		return fmt.Errorf("injected status %d must be an HTTP error status", f.Status)
+	}
+	return nil
+}
+
+func (f *Fault) String() string {
+	host := f.Host
+	if host == "" {
+		host = "all hosts but the registry and state backend"
+	}
+	return fmt.Sprintf("%s: latency %s, jitter %s, error rate %g with status %d", host, f.Latency, f.Jitter, f.ErrorRate, f.status())
+}
+
+func (f *Fault) status() int {
+	if f.Status == 0 {
+		return defaultFaultStatus
+	}
+	return f.Status
+}
+
+func (f *Fault) matches(host string) bool {
+	if f.Host == "" {
+		return true
+	}
+	ok, _ := path.Match(f.Host, host)
+	return ok
+}
+
+// fault returns the first fault that applies to host, or nil. Rules without a
+// host do not apply to the exempt hosts.
+func (p *Proxy) fault(host string) *Fault {
+	for _, f := range p.faults {
+		if f.Host == "" && p.exempt(host) {
+			continue
+		}
+		if f.matches(host) {
+			return f
+		}
+	}
+	return nil
+}
+
+func (p *Proxy) exempt(host string) bool {
+	for _, glob := range p.exemptHosts {
+		if ok, _ := path.Match(glob, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// inject delays a call by the latency of f, and returns the response of an
+// injected error or nil when the call should be forwarded.
+func (p *Proxy) inject(f *Fault, r *http.Request) *http.Response {
+	p.mu.Lock()
+	delay := f.Latency
+	if f.Jitter > 0 {
+		delay += time.Duration(p.rnd.Int63n(int64(f.Jitter) + 1))
+	}
+	fail := f.ErrorRate > 0 && p.rnd.Float64() < f.ErrorRate
+	p.mu.Unlock()
+	time.Sleep(delay)
+	if !fail {
+		return nil
+	}
+	body := "error injected by tf-bench\n"
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.status(), http.StatusText(f.status())),
+		StatusCode:    f.status(),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       r,
+	}
+}
@@ -0,0 +1,465 @@
+// Package proxy is a local HTTP(S) forward proxy that records the API calls
+// of terraform providers. HTTPS is intercepted with certificates signed by a
+// generated CA, which the child process trusts through SSL_CERT_FILE.
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/big"
+	mathrand "math/rand"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Record is one API call made through the proxy. Query strings and bodies
+// are never recorded, as they can contain credentials.
+type Record struct {
+	Start    time.Time
+	Duration time.Duration // Duration until the response was forwarded to the client
+	Method   string
+	Host     string
+	Path     string
+	Action   string // Action of RPC style APIs, such as the action parameter of Aviatrix or the Action of AWS query APIs
+	Status   int    // Status of the response, 0 when the request failed
+	Injected bool   // Injected is whether the response is an injected error
+}
+
+// Name is the action of the call, or its method and path for REST APIs.
+func (r *Record) Name() string {
+	if r.Action != "" {
+		return r.Action
+	}
+	return r.Method + " " + r.Path
+}
+
+// systemCertFiles are where Linux distributions keep their CA bundle, in the
+// order crypto/x509 looks for it.
+var systemCertFiles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/pki/tls/cacert.pem",
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem",
+	"/etc/ssl/cert.pem",
+}
+
+// Proxy is a running recording proxy.
+type Proxy struct {
+	ln          net.Listener
+	srv         *http.Server
+	transport   http.RoundTripper
+	ca          *x509.Certificate
+	caKey       *ecdsa.PrivateKey
+	leafKey     *ecdsa.PrivateKey
+	certFile    string
+	faults      []*Fault
+	exemptHosts []string
+
+	mu      sync.Mutex
+	records []Record
+	certs   map[string]*tls.Certificate
+	rnd     *mathrand.Rand
+}
+
+// Options configure a proxy.
+type Options struct {
+	InsecureUpstream bool     // InsecureUpstream skips verifying the certificates of the APIs, for controllers with self-signed certificates
+	Faults           []*Fault // Faults are injected into calls to matching hosts, the first match applies
+	ExemptHosts      []string // ExemptHosts are globs of the hosts rules without a host do not apply to, such as the registry and the state backend
+	Seed             int64    // Seed of the random jitter and injected errors
+}
+
+// Supported returns an error on operating systems where the proxy can not
+// intercept the HTTPS calls of providers.
+func Supported() error {
+	return supported(runtime.GOOS)
+}
+
+// supported returns an error for macOS and Windows, where Go programs such as
+// providers ignore SSL_CERT_FILE and verify certificates with the trust store
+// of the system, so they would reject the certificates of the proxy.
+func supported(goos string) error {
+	switch goos {
+	case "darwin", "ios", "windows":
+		return fmt.Errorf("the API proxy is not supported on %s, where providers ignore SSL_CERT_FILE and would reject its certificates", goos)
+	}
+	return nil
+}
+
+// Start starts a proxy on a local port. The CA bundle the child process
+// trusts is written to dir.
+func Start(dir string, opts Options) (*Proxy, error) {
+	if err := Supported(); err != nil {
+		return nil, err
+	}
+	p := &Proxy{
+		transport: &http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: opts.InsecureUpstream},
+			ForceAttemptHTTP2: true,
+		},
+		faults:      opts.Faults,
+		exemptHosts: opts.ExemptHosts,
+		certs:       map[string]*tls.Certificate{},
+		rnd:         mathrand.New(mathrand.NewSource(opts.Seed)),
+	}
+	err := p.generateCA()
+	if err != nil {
+		return nil, err
+	}
+	p.certFile = filepath.Join(dir, "ca-bundle.pem")
+	err = os.WriteFile(p.certFile, p.caBundle(), 0600)
+	if err != nil {
+		return nil, fmt.Errorf("could not write proxy CA bundle: %w", err)
+	}
+	p.ln, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("could not listen: %w", err)
+	}
+	p.srv = &http.Server{
+		Handler:  p,
+		ErrorLog: log.New(ioutil.Discard, "", 0),
+	}
+	go func() {
+		_ = p.srv.Serve(p.ln)
+	}()
+	return p, nil
+}
+
+// Env returns the environment variables that send the API calls of a child
+// process through the proxy.
+func (p *Proxy) Env() []string {
+	proxyURL := "http://" + p.ln.Addr().String()
+	return []string{
+		"HTTP_PROXY=" + proxyURL,
+		"HTTPS_PROXY=" + proxyURL,
+		"http_proxy=" + proxyURL,
+		"https_proxy=" + proxyURL,
+		"SSL_CERT_FILE=" + p.certFile,
+	}
+}
+
+// Records returns the calls recorded so far, in the order they completed.
+func (p *Proxy) Records() []Record {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Record{}, p.records...)
+}
+
+// Close stops the proxy.
+func (p *Proxy) Close() error {
+	return p.srv.Close()
+}
+
+func (p *Proxy) record(r Record) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.records = append(p.records, r)
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.intercept(w, r)
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "tf-bench API proxy only forwards proxy requests", http.StatusBadRequest)
+		return
+	}
+	resp, rec := p.forward(r)
+	if resp == nil {
+		http.Error(w, "tf-bench API proxy: upstream request failed", http.StatusBadGateway)
+		p.record(rec)
+		return
+	}
+	defer resp.Body.Close()
+	removeHopHeaders(resp.Header)
+	for k, vs := range resp.Header {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+	rec.Duration = time.Since(rec.Start)
+	p.record(rec)
+}
+
+// intercept terminates the TLS connection of a CONNECT request with a
+// certificate for its host, and forwards the requests sent over it.
+func (p *Proxy) intercept(w http.ResponseWriter, r *http.Request) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "tf-bench API proxy can not intercept this connection", http.StatusInternalServerError)
+		return
+	}
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+	if err != nil {
+		return
+	}
+	host := r.URL.Host
+	tlsConn := tls.Server(conn, &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			name := hello.ServerName
+			if name == "" {
+				name, _, _ = net.SplitHostPort(host)
+			}
+			return p.leafCert(name)
+		},
+		NextProtos: []string{"http/1.1"},
+	})
+	defer tlsConn.Close()
+	reader := bufio.NewReader(tlsConn)
+	for {
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			return
+		}
+		req.URL.Scheme = "https"
+		req.URL.Host = req.Host
+		if req.URL.Host == "" {
+			req.URL.Host = host
+		}
+		resp, rec := p.forward(req)
+		if resp == nil {
+			resp = &http.Response{
+				StatusCode: http.StatusBadGateway,
+				ProtoMajor: 1,
+				ProtoMinor: 1,
+				Header:     http.Header{},
+				Body:       ioutil.NopCloser(strings.NewReader("")),
+				Close:      true,
+			}
+		}
+		removeHopHeaders(resp.Header)
+		// The upstream response can be HTTP/2, the client speaks HTTP/1.1.
+		resp.Proto, resp.ProtoMajor, resp.ProtoMinor = "HTTP/1.1", 1, 1
+		if resp.ContentLength < 0 {
+			resp.TransferEncoding = []string{"chunked"}
+		}
+		err = resp.Write(tlsConn)
+		resp.Body.Close()
+		rec.Duration = time.Since(rec.Start)
+		p.record(rec)
+		if err != nil || resp.Close || req.Close {
+			return
+		}
+	}
+}
+
+// forward sends a request upstream. The returned response is nil when the
+// request failed.
+func (p *Proxy) forward(r *http.Request) (*http.Response, Record) {
+	rec := Record{
+		Start:  time.Now(),
+		Method: r.Method,
+		Host:   r.URL.Hostname(),
+		Path:   r.URL.Path,
+	}
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	removeHopHeaders(out.Header)
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, rec
+		}
+	}
+	out.Body = http.NoBody
+	if len(body) > 0 {
+		out.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	out.ContentLength = int64(len(body))
+	rec.Action = action(r, body)
+	if f := p.fault(rec.Host); f != nil {
+		if resp := p.inject(f, r); resp != nil {
+			rec.Status = resp.StatusCode
+			rec.Injected = true
+			return resp, rec
+		}
+	}
+	resp, err := p.transport.RoundTrip(out)
+	if err != nil {
+		return nil, rec
+	}
+	rec.Status = resp.StatusCode
+	return resp, rec
+}
+
+// action finds the operation of RPC style APIs, which send every call to
+// the same path: the action parameter of Aviatrix, the Action of AWS query
+// APIs and the X-Amz-Target of AWS JSON APIs.
+func action(r *http.Request, body []byte) string {
+	if target := r.Header.Get("X-Amz-Target"); target != "" {
+		return target
+	}
+	query := r.URL.Query()
+	for _, key := range []string{"action", "Action"} {
+		if a := query.Get(key); a != "" {
+			return a
+		}
+	}
+	if len(body) == 0 {
+		return ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return ""
+		}
+		for _, key := range []string{"action", "Action"} {
+			if a := form.Get(key); a != "" {
+				return a
+			}
+		}
+	case "application/json":
+		var fields map[string]interface{}
+		if json.Unmarshal(body, &fields) != nil {
+			return ""
+		}
+		for _, key := range []string{"action", "Action"} {
+			if a, ok := fields[key].(string); ok && a != "" {
+				return a
+			}
+		}
+	}
+	return ""
+}
+
+// hopHeaders only apply to a single connection and are not forwarded.
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+func removeHopHeaders(h http.Header) {
+	for _, k := range hopHeaders {
+		h.Del(k)
+	}
+}
+
+// generateCA generates the CA that signs the certificates of intercepted hosts.
+func (p *Proxy) generateCA() error {
+	var err error
+	p.caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("could not generate proxy CA key: %w", err)
+	}
+	p.leafKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("could not generate proxy certificate key: %w", err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "tf-bench API proxy CA", Organization: []string{"tf-bench"}},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &p.caKey.PublicKey, p.caKey)
+	if err != nil {
+		return fmt.Errorf("could not create proxy CA: %w", err)
+	}
+	p.ca, err = x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("could not parse proxy CA: %w", err)
+	}
+	return nil
+}
+
+// CACert returns the PEM encoded CA certificate of the proxy.
+func (p *Proxy) CACert() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: p.ca.Raw})
+}
+
+// caBundle returns the CA certificates trusted by the system and the proxy
+// CA, so that calls which are not intercepted still verify.
+func (p *Proxy) caBundle() []byte {
+	files := systemCertFiles
+	if f := os.Getenv("SSL_CERT_FILE"); f != "" {
+		files = append([]string{f}, files...)
+	}
+	var bundle []byte
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err == nil {
+			bundle = append(b, '\n')
+			break
+		}
+	}
+	return append(bundle, p.CACert()...)
+}
+
+// leafCert returns a certificate for host signed by the proxy CA.
+func (p *Proxy) leafCert(host string) (*tls.Certificate, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cert, ok := p.certs[host]; ok {
+		return cert, nil
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("could not generate serial number: %w", err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, p.ca, &p.leafKey.PublicKey, p.caKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not create certificate for %s: %w", host, err)
+	}
+	cert := &tls.Certificate{Certificate: [][]byte{der, p.ca.Raw}, PrivateKey: p.leafKey}
+	p.certs[host] = cert
+	return cert, nil
+}
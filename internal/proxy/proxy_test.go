@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxy(t *testing.T) {
+	if err := Supported(); err != nil {
+		t.Skip(err)
+	}
+	upstream := func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		_, _ = w.Write([]byte("result of " + r.Form.Get("action")))
+	}
+	tlsUpstream := httptest.NewTLSServer(http.HandlerFunc(upstream))
+	defer tlsUpstream.Close()
+	plainUpstream := httptest.NewServer(http.HandlerFunc(upstream))
+	defer plainUpstream.Close()
+
+	p, err := Start(t.TempDir(), Options{InsecureUpstream: true})
+	require.NoError(t, err)
+	defer p.Close()
+	env := p.Env()
+	require.Len(t, env, 5)
+	proxyURL, err := url.Parse(strings.TrimPrefix(env[0], "HTTP_PROXY="))
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(p.CACert()))
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(proxyURL),
+		TLSClientConfig: &tls.Config{RootCAs: roots},
+	}}
+
+	resp, err := client.PostForm(tlsUpstream.URL+"/v1/api", url.Values{"action": {"list_vpcs"}, "CID": {"secret"}})
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, "result of list_vpcs", string(body))
+
+	resp, err = client.Get(plainUpstream.URL + "/v1/api?action=get_vpc&CID=secret")
+	require.NoError(t, err)
+	body, err = ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, "result of get_vpc", string(body))
+
+	records := p.Records()
+	require.Len(t, records, 2)
+	require.Equal(t, "POST", records[0].Method)
+	require.Equal(t, "127.0.0.1", records[0].Host)
+	require.Equal(t, "/v1/api", records[0].Path)
+	require.Equal(t, "list_vpcs", records[0].Name())
+	require.Equal(t, http.StatusOK, records[0].Status)
+	require.Equal(t, "get_vpc", records[1].Action)
+	for _, r := range records {
+		require.NotContains(t, r.Path, "secret")
+	}
+}
+
+func TestSupported(t *testing.T) {
+	require.NoError(t, supported("linux"))
+	require.NoError(t, supported("freebsd"))
+	require.Error(t, supported("darwin"))
+	require.Error(t, supported("windows"))
+}
+
+func TestAction(t *testing.T) {
+	r := httptest.NewRequest("POST", "https://ec2.amazonaws.com/", nil)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	require.Equal(t, "DescribeVpcs", action(r, []byte("Action=DescribeVpcs&Version=2016-11-15")))
+
+	r = httptest.NewRequest("POST", "https://controller/v2/api", nil)
+	r.Header.Set("Content-Type", "application/json")
+	require.Equal(t, "get_vpc_by_name", action(r, []byte(`{"action":"get_vpc_by_name","CID":"secret"}`)))
+
+	r = httptest.NewRequest("POST", "https://dynamodb.amazonaws.com/", nil)
+	r.Header.Set("X-Amz-Target", "DynamoDB_20120810.DescribeTable")
+	require.Equal(t, "DynamoDB_20120810.DescribeTable", action(r, nil))
+
+	r = httptest.NewRequest("GET", "https://management.azure.com/subscriptions/1/resourceGroups/rg", nil)
+	require.Equal(t, "", action(r, nil))
+	rec := &Record{Method: "GET", Path: "/subscriptions/1/resourceGroups/rg"}
+	require.Equal(t, "GET /subscriptions/1/resourceGroups/rg", rec.Name())
+}
+
+func TestProxyFaults(t *testing.T) {
+	if err := Supported(); err != nil {
+		t.Skip(err)
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	p, err := Start(t.TempDir(), Options{Seed: 1, Faults: []*Fault{
+		{Host: "localhost", ErrorRate: 1, Status: http.StatusTooManyRequests},
+		{Host: "127.0.0.*", Latency: 50 * time.Millisecond, Jitter: 10 * time.Millisecond, ErrorRate: 0.5},
+	}})
+	require.NoError(t, err)
+	defer p.Close()
+	proxyURL, err := url.Parse(strings.TrimPrefix(p.Env()[0], "HTTP_PROXY="))
+	require.NoError(t, err)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	statuses := map[int]int{}
+	for i := 0; i < 20; i++ {
+		start := time.Now()
+		resp, err := client.Get(upstream.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.GreaterOrEqual(t, int64(time.Since(start)), int64(50*time.Millisecond))
+		statuses[resp.StatusCode]++
+	}
+	require.Len(t, statuses, 2)
+	require.Greater(t, statuses[http.StatusServiceUnavailable], 0)
+	var injected int
+	for _, r := range p.Records() {
+		if r.Injected {
+			injected++
+			require.Equal(t, http.StatusServiceUnavailable, r.Status)
+		}
+	}
+	require.Equal(t, statuses[http.StatusServiceUnavailable], injected)
+
+	port := strings.Split(upstream.URL, ":")[2]
+	resp, err := client.Get("http://localhost:" + port)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+}
+
+func TestParseFault(t *testing.T) {
+	f, err := ParseFault("host=*.example.com,latency=200ms,jitter=50ms,error-rate=0.05,status=429")
+	require.NoError(t, err)
+	require.Equal(t, &Fault{Host: "*.example.com", Latency: 200 * time.Millisecond, Jitter: 50 * time.Millisecond,
+		ErrorRate: 0.05, Status: 429}, f)
+	require.True(t, f.matches("controller.example.com"))
+	require.False(t, f.matches("example.org"))
+	require.True(t, (&Fault{}).matches("example.org"))
+
+	p := &Proxy{
+		faults:      []*Fault{{Host: "registry.terraform.io", Latency: time.Second}, {Latency: time.Millisecond}},
+		exemptHosts: append(RegistryHosts, "*.s3.amazonaws.com"),
+	}
+	require.Equal(t, p.faults[1], p.fault("controller.example.com"))
+	require.Nil(t, p.fault("tfstate.s3.amazonaws.com"))
+	require.Nil(t, p.fault("releases.hashicorp.com"))
+	require.Equal(t, p.faults[0], p.fault("registry.terraform.io"), "rules with a host apply to exempt hosts")
+
+	for _, s := range []string{"latency", "latency=fast", "error-rate=2", "status=200", "speed=1", "host=[", "jitter=-1s"} {
+		_, err = ParseFault(s)
+		require.Error(t, err, s)
+	}
+}
@@ -0,0 +1,166 @@
+//go:build linux
+// +build linux
+
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is the unit of CPU times in /proc, USER_HZ, which is 100 on
+// every Linux architecture tf-bench runs on.
+const clockTicks = 100
+
+// procStat is the part of /proc/<pid>/stat that tf-bench uses.
+type procStat struct {
+	comm    string // comm is the command name, truncated to 15 bytes
+	ppid    int
+	cpuTime time.Duration // cpuTime is the user and system CPU time
+}
+
+// parseProcStat parses /proc/<pid>/stat. The command name is in parentheses
+// and may itself contain spaces and parentheses.
+func parseProcStat(b []byte) (procStat, error) {
+	open, i := bytes.IndexByte(b, '('), bytes.LastIndexByte(b, ')')
+	if open == -1 || i < open {
+		return procStat{}, fmt.Errorf("no command name in stat")
+	}
+	// The fields after the command name start with the state, field 3.
+	fields := strings.Fields(string(b[i+1:]))
+	if len(fields) < 13 {
+		return procStat{}, fmt.Errorf("stat has %d fields after the command name", len(fields))
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return procStat{}, fmt.Errorf("invalid ppid: %w", err)
+	}
+	utime, err := strconv.ParseInt(fields[11], 10, 64)
+	if err != nil {
+		return procStat{}, fmt.Errorf("invalid utime: %w", err)
+	}
+	stime, err := strconv.ParseInt(fields[12], 10, 64)
+	if err != nil {
+		return procStat{}, fmt.Errorf("invalid stime: %w", err)
+	}
+	return procStat{comm: string(b[open+1 : i]), ppid: ppid, cpuTime: time.Duration(utime+stime) * time.Second / clockTicks}, nil
+}
+
+// parsePeakRSS returns VmHWM of /proc/<pid>/status in bytes.
+func parsePeakRSS(b []byte) int64 {
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "VmHWM:") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "VmHWM:"))
+		if len(fields) == 0 {
+			return 0
+		}
+		kb, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return 0
+		}
+		return kb * 1024
+	}
+	return 0
+}
+
+// readChildren returns the current usage of the direct child processes of
+// pid. Processes that exit while they are read are skipped.
+func readChildren(pid int) []*ChildUsage {
+	pids, ok := childPIDs(pid)
+	if !ok {
+		pids = scanChildPIDs(pid)
+	}
+	var children []*ChildUsage
+	for _, child := range pids {
+		if cu := readChild(pid, child); cu != nil {
+			children = append(children, cu)
+		}
+	}
+	return children
+}
+
+// childPIDs returns the children of pid listed in /proc/<pid>/task/<tid>/children
+// for every thread of pid, which only reads the files of pid rather than
+// those of every process. ok is false when the kernel has no children files.
+func childPIDs(pid int) ([]int, bool) {
+	files, err := filepath.Glob(filepath.Join("/proc", strconv.Itoa(pid), "task", "*", "children"))
+	if err != nil || len(files) == 0 {
+		return nil, false
+	}
+	var pids []int
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		pids = append(pids, parseChildren(b)...)
+	}
+	return pids, true
+}
+
+// parseChildren parses the space separated PIDs of a children file.
+func parseChildren(b []byte) []int {
+	var pids []int
+	for _, field := range strings.Fields(string(b)) {
+		if pid, err := strconv.Atoi(field); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// scanChildPIDs returns the children of pid by reading the stat of every
+// process, for kernels without children files.
+func scanChildPIDs(pid int) []int {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	var pids []int
+	for _, e := range entries {
+		child, err := strconv.Atoi(e.Name())
+		if err != nil || !e.IsDir() {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join("/proc", e.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		if stat, err := parseProcStat(b); err == nil && stat.ppid == pid {
+			pids = append(pids, child)
+		}
+	}
+	return pids
+}
+
+// readChild returns the usage of the child process of pid, nil when it
+// exited or is no longer a child of pid.
+func readChild(pid, child int) *ChildUsage {
+	dir := filepath.Join("/proc", strconv.Itoa(child))
+	b, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return nil
+	}
+	stat, err := parseProcStat(b)
+	if err != nil || stat.ppid != pid {
+		return nil
+	}
+	cu := &ChildUsage{PID: child, Name: stat.comm, CPUTime: stat.cpuTime}
+	if b, err := os.ReadFile(filepath.Join(dir, "status")); err == nil {
+		cu.MaxRSS = parsePeakRSS(b)
+	}
+	if cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline")); err == nil && len(cmdline) > 0 {
+		cu.Name = filepath.Base(string(bytes.SplitN(cmdline, []byte{0}, 2)[0]))
+	}
+	return cu
+}
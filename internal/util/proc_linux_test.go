@@ -0,0 +1,64 @@
+//go:build linux
+// +build linux
+
+package util
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProcStat(t *testing.T) {
+	stat, err := parseProcStat([]byte("4242 (terraform-provi) (x) S 4200 4242 4200 0 -1 4194560 1845 0 0 0 250 40 0 0 20 0 12 0 123 812345344 9876 18446744073709551615\n"))
+	require.NoError(t, err)
+	require.Equal(t, "terraform-provi) (x", stat.comm)
+	require.Equal(t, 4200, stat.ppid)
+	require.Equal(t, 2900*time.Millisecond, stat.cpuTime)
+
+	_, err = parseProcStat([]byte("4242 terraform S"))
+	require.Error(t, err)
+
+	require.Equal(t, int64(52428800), parsePeakRSS([]byte("Name:\tterraform\nVmPeak:\t  900000 kB\nVmHWM:\t   51200 kB\nVmRSS:\t   40000 kB\n")))
+	require.Equal(t, int64(0), parsePeakRSS([]byte("Name:\tkthreadd\n")))
+}
+
+func TestChildPIDs(t *testing.T) {
+	require.Equal(t, []int{123, 4567}, parseChildren([]byte("123 4567 ")))
+	require.Empty(t, parseChildren([]byte("")))
+
+	c := exec.Command("sleep", "5")
+	require.NoError(t, c.Start())
+	defer func() {
+		_ = c.Process.Kill()
+		_ = c.Wait()
+	}()
+	pids, ok := childPIDs(os.Getpid())
+	if !ok {
+		t.Skip("the kernel has no /proc/<pid>/task/<tid>/children files")
+	}
+	require.Contains(t, pids, c.Process.Pid)
+	require.Contains(t, scanChildPIDs(os.Getpid()), c.Process.Pid)
+	cu := readChild(os.Getpid(), c.Process.Pid)
+	require.NotNil(t, cu)
+	require.Equal(t, "sleep", cu.Name)
+	require.Nil(t, readChild(os.Getpid()+1<<20, c.Process.Pid))
+}
+
+func TestRunCommandWithUsage(t *testing.T) {
+	out, usage, err := RunCommandWithUsage("", nil, "/bin/sh", "-c", "sleep 0.5; echo done")
+	require.NoError(t, err)
+	require.Equal(t, "done\n", string(out))
+	require.NotNil(t, usage)
+	require.Greater(t, usage.MaxRSS, int64(0))
+	require.Len(t, usage.Children, 1)
+	require.Equal(t, "sleep", usage.Children[0].Name)
+	require.Greater(t, usage.Children[0].MaxRSS, int64(0))
+
+	_, usage, err = RunCommandWithUsage("", nil, "/bin/sh", "-c", "exit 3")
+	require.Error(t, err)
+	require.NotNil(t, usage)
+}
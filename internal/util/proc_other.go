@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package util
+
+// readChildren is not supported without /proc.
+func readChildren(pid int) []*ChildUsage {
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build darwin
+// +build darwin
+
+package util
+
+import (
+	"os"
+	"syscall"
+)
+
+// maxRSS returns the peak resident set size of a finished process, which
+// macOS reports in bytes.
+func maxRSS(ps *os.ProcessState) int64 {
+	if ru, ok := ps.SysUsage().(*syscall.Rusage); ok {
+		return ru.Maxrss
+	}
+	return 0
+}
@@ -0,0 +1,18 @@
+//go:build linux
+// +build linux
+
+package util
+
+import (
+	"os"
+	"syscall"
+)
+
+// maxRSS returns the peak resident set size of a finished process, which
+// Linux reports in kilobytes.
+func maxRSS(ps *os.ProcessState) int64 {
+	if ru, ok := ps.SysUsage().(*syscall.Rusage); ok {
+		return ru.Maxrss * 1024
+	}
+	return 0
+}
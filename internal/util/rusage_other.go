@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package util
+
+import "os"
+
+// maxRSS is unknown on this platform.
+func maxRSS(ps *os.ProcessState) int64 {
+	return 0
+}
@@ -0,0 +1,155 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"time"
+)
+
+// ChildSampleInterval is how often the child processes of a monitored command
+// are sampled.
+const ChildSampleInterval = 100 * time.Millisecond
+
+// Usage is the CPU time and memory used by a command.
+type Usage struct {
+	UserTime   time.Duration // UserTime includes the child processes the command waited for
+	SystemTime time.Duration // SystemTime includes the child processes the command waited for
+	MaxRSS     int64         // MaxRSS is the peak resident set size in bytes of the command or its largest child, 0 when unknown
+	Children   []*ChildUsage // Children are the direct child processes seen while sampling, such as provider plugins
+}
+
+// CPUTime is the user and system CPU time of the command.
+func (u *Usage) CPUTime() time.Duration {
+	return u.UserTime + u.SystemTime
+}
+
+// ChildUsage is the CPU time and peak memory of a child process of a command,
+// sampled while it ran. CPU time spent after the last sample is missing.
+type ChildUsage struct {
+	PID     int
+	Name    string // Name is the base name of the executable
+	CPUTime time.Duration
+	MaxRSS  int64 // MaxRSS is the peak resident set size in bytes
+}
+
+// MonitoredCommand is a started command whose child processes are sampled
+// until it finishes.
+type MonitoredCommand struct {
+	cmd      *exec.Cmd
+	stop     chan struct{}
+	children chan []*ChildUsage
+}
+
+// StartMonitored starts c and samples its child processes until Wait.
+// Sampling child processes is only supported on Linux.
+func StartMonitored(c *exec.Cmd) (*MonitoredCommand, error) {
+	if err := c.Start(); err != nil {
+		return nil, err
+	}
+	m := &MonitoredCommand{cmd: c, stop: make(chan struct{}), children: make(chan []*ChildUsage, 1)}
+	go func() {
+		m.children <- sampleChildren(c.Process.Pid, m.stop)
+	}()
+	return m, nil
+}
+
+// Wait waits for the command to finish and returns its usage. The usage is
+// returned even when the command failed.
+func (m *MonitoredCommand) Wait() (*Usage, error) {
+	err := m.cmd.Wait()
+	close(m.stop)
+	children := <-m.children
+	usage := processUsage(m.cmd.ProcessState)
+	if usage != nil {
+		usage.Children = children
+	}
+	return usage, err
+}
+
+// processUsage returns the usage of a finished process, nil if it did not start.
+func processUsage(ps *os.ProcessState) *Usage {
+	if ps == nil {
+		return nil
+	}
+	return &Usage{
+		UserTime:   ps.UserTime(),
+		SystemTime: ps.SystemTime(),
+		MaxRSS:     maxRSS(ps),
+	}
+}
+
+// sampleChildren samples the direct child processes of pid every
+// ChildSampleInterval until stop is closed.
+func sampleChildren(pid int, stop <-chan struct{}) []*ChildUsage {
+	seen := map[int]*ChildUsage{}
+	ticker := time.NewTicker(ChildSampleInterval)
+	defer ticker.Stop()
+	for {
+		for _, child := range readChildren(pid) {
+			cu, ok := seen[child.PID]
+			if !ok {
+				seen[child.PID] = child
+				continue
+			}
+			// A child sampled between fork and exec has the name of its parent.
+			cu.Name = child.Name
+			if child.CPUTime > cu.CPUTime {
+				cu.CPUTime = child.CPUTime
+			}
+			if child.MaxRSS > cu.MaxRSS {
+				cu.MaxRSS = child.MaxRSS
+			}
+		}
+		select {
+		case <-stop:
+			children := make([]*ChildUsage, 0, len(seen))
+			for _, cu := range seen {
+				children = append(children, cu)
+			}
+			sort.Slice(children, func(i, j int) bool {
+				return children[i].PID < children[j].PID
+			})
+			return children
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunCommandWithUsage is RunCommandInDir that also returns the usage of the command. It samples
+// the child processes every ChildSampleInterval, so it is meant for the commands that are measured.
+func RunCommandWithUsage(dir string, env []string, name string, arg ...string) ([]byte, *Usage, error) {
+	c := exec.Command(name, arg...)
+	c.Dir = dir
+	if len(env) > 0 {
+		c.Env = append(os.Environ(), env...)
+	}
+	var out bytes.Buffer
+	c.Stdout = &out
+	c.Stderr = &out
+	m, err := StartMonitored(c)
+	if err != nil {
+		return nil, nil, fmt.Errorf("running command: %w", err)
+	}
+	usage, err := m.Wait()
+	if err != nil {
+		return nil, usage, fmt.Errorf("running command: %w output: %s", err, out.String())
+	}
+	return out.Bytes(), usage, nil
+}
+
+// FormatBytes formats a size in bytes for reports, for example 12.3MiB.
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTP"[exp])
+}
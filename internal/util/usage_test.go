@@ -0,0 +1,14 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatBytes(t *testing.T) {
+	require.Equal(t, "512B", FormatBytes(512))
+	require.Equal(t, "1.5KiB", FormatBytes(1536))
+	require.Equal(t, "50.0MiB", FormatBytes(52428800))
+	require.Equal(t, "2.0GiB", FormatBytes(2<<30))
+}
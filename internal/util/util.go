@@ -2,14 +2,31 @@ package util
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
+	"sync"
 	"time"
 
 	"github.com/jedib0t/go-pretty/v6/progress"
 )
 
 func RunCommand(name string, arg ...string) ([]byte, error) {
+	return RunCommandWithEnv(nil, name, arg...)
+}
+
+// RunCommandWithEnv runs the command with env added to the environment of the current process.
+func RunCommandWithEnv(env []string, name string, arg ...string) ([]byte, error) {
+	return RunCommandInDir("", env, name, arg...)
+}
+
+// RunCommandInDir runs the command in dir with env added to the environment of the current process.
+// It does not sample the usage of the command, use RunCommandWithUsage for commands that are measured.
+func RunCommandInDir(dir string, env []string, name string, arg ...string) ([]byte, error) {
 	c := exec.Command(name, arg...)
+	c.Dir = dir
+	if len(env) > 0 {
+		c.Env = append(os.Environ(), env...)
+	}
 	out, err := c.CombinedOutput()
 	if err != nil {
 		return nil, fmt.Errorf("running command: %w output: %s", err, string(out))
@@ -47,3 +64,44 @@ func ProgressWriter() progress.Writer {
 	pw.Style().Options.PercentFormat = "%4.1f%%"
 	return pw
 }
+
+var (
+	tempDirsMu sync.Mutex
+	tempDirs   = map[string]bool{}
+)
+
+// MkdirTemp creates a directory only the current user can access. It is
+// removed by RemoveTempDir, or by RemoveTempDirs if tf-bench is interrupted.
+func MkdirTemp(pattern string) (string, error) {
+	dir, err := os.MkdirTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	err = os.Chmod(dir, 0700)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return "", err
+	}
+	tempDirsMu.Lock()
+	tempDirs[dir] = true
+	tempDirsMu.Unlock()
+	return dir, nil
+}
+
+// RemoveTempDir removes a directory created by MkdirTemp.
+func RemoveTempDir(dir string) {
+	tempDirsMu.Lock()
+	delete(tempDirs, dir)
+	tempDirsMu.Unlock()
+	_ = os.RemoveAll(dir)
+}
+
+// RemoveTempDirs removes every directory created by MkdirTemp that has not been removed yet.
+func RemoveTempDirs() {
+	tempDirsMu.Lock()
+	defer tempDirsMu.Unlock()
+	for dir := range tempDirs {
+		_ = os.RemoveAll(dir)
+		delete(tempDirs, dir)
+	}
+}